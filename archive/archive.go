@@ -0,0 +1,137 @@
+// Package archive reads and writes feed archives.
+//
+// An archive is a gzip compressed stream of newline delimited JSON.
+// The first line is the Manifest, every following line is a signed message, exactly as it was published by it's author.
+// The messages of one feed are in order, so that they can be verified and appended one after the other.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb"
+)
+
+// Format identifies the manifest of an archive
+const Format = "ssb-feed-archive"
+
+// Version of the archive format written by this package
+const Version = 1
+
+// Manifest is the first line of an archive
+type Manifest struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+
+	Feeds []FeedRange `json:"feeds"`
+}
+
+// FeedRange describes which messages of a feed are in an archive
+type FeedRange struct {
+	ID   *ssb.FeedRef `json:"id"`
+	From int64        `json:"from"`
+	To   int64        `json:"to"`
+}
+
+// Messages returns the total number of messages the manifest lists
+func (m Manifest) Messages() int64 {
+	var n int64
+	for _, fr := range m.Feeds {
+		n += fr.To - fr.From + 1
+	}
+	return n
+}
+
+// Writer writes an archive
+type Writer struct {
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+// NewWriter writes the manifest to w and returns a Writer for the messages
+func NewWriter(w io.Writer, m Manifest) (*Writer, error) {
+	m.Format = Format
+	m.Version = Version
+	if m.Created.IsZero() {
+		m.Created = time.Now()
+	}
+
+	gz := gzip.NewWriter(w)
+	aw := &Writer{
+		gz:  gz,
+		enc: json.NewEncoder(gz),
+	}
+	// don't touch the contents of messages
+	aw.enc.SetEscapeHTML(false)
+	if err := aw.enc.Encode(m); err != nil {
+		return nil, errors.Wrap(err, "archive: failed to write manifest")
+	}
+	return aw, nil
+}
+
+// WriteMessage adds the raw signed message to the archive.
+// It is written as a single line, the signature stays valid since it is computed over the canonical encoding.
+func (w *Writer) WriteMessage(raw json.RawMessage) error {
+	err := w.enc.Encode(raw)
+	return errors.Wrap(err, "archive: failed to write message")
+}
+
+// Close flushes the compressor. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	return errors.Wrap(w.gz.Close(), "archive: failed to flush")
+}
+
+// Reader reads an archive
+type Reader struct {
+	gz  *gzip.Reader
+	dec *json.Decoder
+
+	manifest Manifest
+}
+
+// NewReader reads and checks the manifest from r
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, errors.Wrap(err, "archive: not a compressed archive")
+	}
+
+	ar := &Reader{
+		gz:  gz,
+		dec: json.NewDecoder(gz),
+	}
+	if err := ar.dec.Decode(&ar.manifest); err != nil {
+		return nil, errors.Wrap(err, "archive: failed to read manifest")
+	}
+	if ar.manifest.Format != Format {
+		return nil, errors.Errorf("archive: unexpected format %q", ar.manifest.Format)
+	}
+	if ar.manifest.Version > Version {
+		return nil, errors.Errorf("archive: version %d is not supported (max %d)", ar.manifest.Version, Version)
+	}
+	return ar, nil
+}
+
+// Manifest returns the manifest of the archive
+func (r *Reader) Manifest() Manifest { return r.manifest }
+
+// Next returns the next raw message of the archive or io.EOF
+func (r *Reader) Next() (json.RawMessage, error) {
+	var raw json.RawMessage
+	err := r.dec.Decode(&raw)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	return raw, errors.Wrap(err, "archive: failed to read message")
+}
+
+// Close closes the decompressor. It doesn't close the underlying reader.
+func (r *Reader) Close() error {
+	return r.gz.Close()
+}
@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.TODO()
+	r := require.New(t)
+
+	srcPath, err := ioutil.TempDir("", t.Name()+"-src")
+	r.NoError(err)
+	defer os.RemoveAll(srcPath)
+	srcRepo := repo.New(srcPath)
+
+	srcLog, err := repo.OpenLog(srcRepo)
+	r.NoError(err)
+	srcFeeds, _, srcServe, err := multilogs.OpenUserFeeds(srcRepo)
+	r.NoError(err)
+
+	staticRand := rand.New(rand.NewSource(42))
+	var authors []*ssb.FeedRef
+	for a := 0; a < 2; a++ {
+		kp, err := ssb.NewKeyPair(staticRand)
+		r.NoError(err)
+		authors = append(authors, kp.Id)
+
+		publish, err := multilogs.OpenPublishLog(srcLog, srcFeeds, *kp)
+		r.NoError(err)
+		for i := 0; i < 10; i++ {
+			_, err := publish.Append(map[string]interface{}{"type": "test", "i": i, "html": "<b>&</b>"})
+			r.NoError(err)
+			// publish looks up the previous message via userFeeds
+			r.NoError(srcServe(ctx, srcLog, false))
+		}
+	}
+
+	var buf bytes.Buffer
+	m, err := Export(ctx, &buf, srcLog, srcFeeds, authors)
+	r.NoError(err)
+	r.Len(m.Feeds, 2)
+	r.EqualValues(20, m.Messages())
+
+	dstPath, err := ioutil.TempDir("", t.Name()+"-dst")
+	r.NoError(err)
+	defer os.RemoveAll(dstPath)
+	dstRepo := repo.New(dstPath)
+
+	dstLog, err := repo.OpenLog(dstRepo)
+	r.NoError(err)
+	dstFeeds, _, dstServe, err := multilogs.OpenUserFeeds(dstRepo)
+	r.NoError(err)
+
+	rep, err := Import(ctx, bytes.NewReader(buf.Bytes()), dstLog, dstFeeds, nil)
+	r.NoError(err)
+	r.EqualValues(20, rep.Appended)
+	r.EqualValues(0, rep.Skipped)
+
+	seq, err := dstLog.Seq().Value()
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(19), seq)
+
+	// a second import doesn't add anything
+	r.NoError(dstServe(ctx, dstLog, false))
+	rep, err = Import(ctx, bytes.NewReader(buf.Bytes()), dstLog, dstFeeds, nil)
+	r.NoError(err)
+	r.EqualValues(0, rep.Appended)
+	r.EqualValues(20, rep.Skipped)
+
+	// messages signed for a different network are refused
+	var otherNet [32]byte
+	otherNet[0] = 1
+	emptyPath, err := ioutil.TempDir("", t.Name()+"-empty")
+	r.NoError(err)
+	defer os.RemoveAll(emptyPath)
+	emptyRepo := repo.New(emptyPath)
+	emptyLog, err := repo.OpenLog(emptyRepo)
+	r.NoError(err)
+	emptyFeeds, _, _, err := multilogs.OpenUserFeeds(emptyRepo)
+	r.NoError(err)
+	_, err = Import(ctx, bytes.NewReader(buf.Bytes()), emptyLog, emptyFeeds, &otherNet)
+	r.Error(err)
+}
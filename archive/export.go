@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/mutil"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// Export writes the complete feeds to w, using the userFeeds multilog to find their messages in the rootLog.
+// Feeds that have no messages are left out of the manifest.
+func Export(ctx context.Context, w io.Writer, rootLog margaret.Log, userFeeds multilog.MultiLog, feeds []*ssb.FeedRef) (*Manifest, error) {
+	var (
+		m        = Manifest{Created: time.Now()}
+		sublogs  []margaret.Log
+		included = make(map[string]struct{})
+	)
+	for _, fr := range feeds {
+		if _, has := included[fr.Ref()]; has {
+			continue
+		}
+		included[fr.Ref()] = struct{}{}
+
+		sublog, err := userFeeds.Get(librarian.Addr(fr.ID))
+		if err != nil {
+			return nil, errors.Wrapf(err, "archive/export: failed to open sublog of %s", fr.Ref())
+		}
+		v, err := sublog.Seq().Value()
+		if err != nil {
+			return nil, errors.Wrapf(err, "archive/export: failed to get length of %s", fr.Ref())
+		}
+		seq, ok := v.(margaret.Seq)
+		if !ok || seq.Seq() < 0 {
+			continue // nothing stored
+		}
+		m.Feeds = append(m.Feeds, FeedRange{
+			ID:   fr,
+			From: 1,
+			To:   seq.Seq() + 1, // sublogs are 0-indexed
+		})
+		sublogs = append(sublogs, mutil.Indirect(rootLog, sublog))
+	}
+
+	m.Format, m.Version = Format, Version
+	aw, err := NewWriter(w, m)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, sublog := range sublogs {
+		fr := m.Feeds[i]
+		src, err := sublog.Query(margaret.Limit(int(fr.To)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "archive/export: failed to query %s", fr.ID.Ref())
+		}
+
+		var expect = fr.From
+		snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+			if err != nil {
+				if luigi.IsEOS(err) {
+					return nil
+				}
+				return err
+			}
+			if err, ok := v.(error); ok {
+				if margaret.IsErrNulled(err) {
+					return errors.Errorf("message %d is nulled, rebuild the indexes first", expect)
+				}
+				return err
+			}
+			msg, ok := v.(message.StoredMessage)
+			if !ok {
+				return errors.Errorf("unexpected message type: %T", v)
+			}
+			if msg.Sequence.Seq() != expect {
+				return errors.Errorf("expected message %d but got %d", expect, msg.Sequence.Seq())
+			}
+			expect++
+			return aw.WriteMessage(msg.Raw)
+		})
+		if err := luigi.Pump(ctx, snk, src); err != nil {
+			return nil, errors.Wrapf(err, "archive/export: failed to write %s", fr.ID.Ref())
+		}
+		if expect != fr.To+1 {
+			return nil, errors.Errorf("archive/export: %s ended at %d, expected %d", fr.ID.Ref(), expect-1, fr.To)
+		}
+	}
+
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
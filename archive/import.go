@@ -0,0 +1,122 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb/message"
+)
+
+// ImportReport sums up what Import did
+type ImportReport struct {
+	Manifest Manifest `json:"manifest"`
+
+	Appended int64 `json:"appended"` // new messages
+	Skipped  int64 `json:"skipped"`  // messages that were already stored
+}
+
+// Import verifies the messages from the archive in r and appends the ones that are new to rootLog.
+// Every message goes through the same checks as replicated ones (see message.ValidateNext).
+//
+// userFeeds is only used to find the latest stored message of a feed and needs to be up to date with rootLog.
+// Import keeps track of what it appended itself, so userFeeds doesn't need to be served while importing.
+// It must not run concurrently with replication of the same feeds.
+func Import(ctx context.Context, r io.Reader, rootLog margaret.Log, userFeeds multilog.MultiLog, hmacSecret *[32]byte) (*ImportReport, error) {
+	ar, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	rep := ImportReport{Manifest: ar.Manifest()}
+
+	// latest is the current message of each feed, nil if there is none
+	latest := make(map[librarian.Addr]*message.StoredMessage)
+
+	for i := 0; ; i++ {
+		select {
+		case <-ctx.Done():
+			return &rep, ctx.Err()
+		default:
+		}
+
+		raw, err := ar.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return &rep, errors.Wrapf(err, "archive/import: message %d", i)
+		}
+
+		var dmsg message.DeserializedMessage
+		if err := json.Unmarshal(raw, &dmsg); err != nil {
+			return &rep, errors.Wrapf(err, "archive/import: message %d is not a message", i)
+		}
+
+		addr := librarian.Addr(dmsg.Author.ID)
+		current, has := latest[addr]
+		if !has {
+			current, err = latestMessage(rootLog, userFeeds, addr)
+			if err != nil {
+				return &rep, errors.Wrapf(err, "archive/import: failed to get latest message of %s", dmsg.Author.Ref())
+			}
+			latest[addr] = current
+		}
+
+		if current != nil && dmsg.Sequence <= current.Sequence {
+			rep.Skipped++
+			continue
+		}
+
+		next, err := message.ValidateNext(current, raw, hmacSecret)
+		if err != nil {
+			return &rep, errors.Wrapf(err, "archive/import: invalid message %s:%d", dmsg.Author.Ref(), dmsg.Sequence)
+		}
+
+		if _, err := rootLog.Append(*next); err != nil {
+			return &rep, errors.Wrapf(err, "archive/import: failed to append %s:%d", dmsg.Author.Ref(), dmsg.Sequence)
+		}
+		latest[addr] = next
+		rep.Appended++
+	}
+
+	return &rep, nil
+}
+
+// latestMessage returns the last stored message of a feed or nil if there is none
+func latestMessage(rootLog margaret.Log, userFeeds multilog.MultiLog, addr librarian.Addr) (*message.StoredMessage, error) {
+	sublog, err := userFeeds.Get(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open sublog")
+	}
+	v, err := sublog.Seq().Value()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get sublog length")
+	}
+	seq, ok := v.(margaret.Seq)
+	if !ok || seq.Seq() < 0 {
+		return nil, nil
+	}
+
+	rootSeq, err := sublog.Get(seq)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up root seq of latest message")
+	}
+	mv, err := rootLog.Get(rootSeq.(margaret.Seq))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get latest message")
+	}
+	msg, ok := mv.(message.StoredMessage)
+	if !ok {
+		return nil, errors.Errorf("unexpected message type: %T", mv)
+	}
+	if msg.Sequence.Seq() != seq.Seq()+1 {
+		return nil, errors.Errorf("consistency error: sublog has %d entries but latest message is %d", seq.Seq()+1, msg.Sequence)
+	}
+	return &msg, nil
+}
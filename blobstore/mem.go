@@ -0,0 +1,122 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/ssb"
+)
+
+// NewMemory returns a blob store that keeps the blobs in memory
+func NewMemory() ssb.BlobStore {
+	bs := &memStore{
+		blobs: make(map[string][]byte),
+	}
+	bs.sink, bs.bcast = luigi.NewBroadcast()
+	return bs
+}
+
+type memStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte // keyed by ref.Ref()
+
+	sink  luigi.Sink
+	bcast luigi.Broadcast
+}
+
+func (store *memStore) Get(ref *ssb.BlobRef) (io.Reader, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	b, ok := store.blobs[ref.Ref()]
+	if !ok {
+		return nil, ErrNoSuchBlob
+	}
+	return bytes.NewReader(b), nil
+}
+
+func (store *memStore) Put(blob io.Reader) (*ssb.BlobRef, error) {
+	var buf bytes.Buffer
+	h := sha256.New()
+	_, err := io.Copy(io.MultiWriter(&buf, h), blob)
+	if err != nil && !luigi.IsEOS(err) {
+		return nil, errors.Wrap(err, "blobstore.Put: error copying")
+	}
+
+	ref := &ssb.BlobRef{
+		Hash: h.Sum(nil),
+		Algo: "sha256",
+	}
+
+	store.mu.Lock()
+	store.blobs[ref.Ref()] = buf.Bytes()
+	store.mu.Unlock()
+
+	err = store.sink.Pour(context.TODO(), ssb.BlobStoreNotification{
+		Op:  ssb.BlobStoreOpPut,
+		Ref: ref,
+	})
+	return ref, errors.Wrap(err, "blobstore.Put: error in notification handler")
+}
+
+func (store *memStore) Delete(ref *ssb.BlobRef) error {
+	store.mu.Lock()
+	_, ok := store.blobs[ref.Ref()]
+	delete(store.blobs, ref.Ref())
+	store.mu.Unlock()
+	if !ok {
+		return ErrNoSuchBlob
+	}
+
+	err := store.sink.Pour(context.TODO(), ssb.BlobStoreNotification{
+		Op:  ssb.BlobStoreOpRm,
+		Ref: ref,
+	})
+	return errors.Wrap(err, "error in delete notification handlers")
+}
+
+// List returns the blobs that are stored when it's called, sorted by their ref
+func (store *memStore) List() luigi.Source {
+	store.mu.Lock()
+	refs := make([]string, 0, len(store.blobs))
+	for r := range store.blobs {
+		refs = append(refs, r)
+	}
+	store.mu.Unlock()
+	sort.Strings(refs)
+
+	var (
+		l sync.Mutex
+		i int
+	)
+	return luigi.FuncSource(func(ctx context.Context) (interface{}, error) {
+		l.Lock()
+		defer l.Unlock()
+		if i >= len(refs) {
+			return nil, luigi.EOS{}
+		}
+		br, err := parseBlobRef(refs[i])
+		i++
+		return br, err
+	})
+}
+
+func (store *memStore) Size(ref *ssb.BlobRef) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	b, ok := store.blobs[ref.Ref()]
+	if !ok {
+		return 0, ErrNoSuchBlob
+	}
+	return int64(len(b)), nil
+}
+
+func (store *memStore) Changes() luigi.Broadcast {
+	return store.bcast
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -168,6 +169,39 @@ func (c client) Publish(v interface{}) (*ssb.MessageRef, error) {
 	return msgRef, errors.Wrap(err, "failed to parse new message reference")
 }
 
+func (c client) Get(ref ssb.MessageRef) (json.RawMessage, error) {
+	v, err := c.handler.Async(c.rootCtx, json.RawMessage{}, muxrpc.Method{"get"}, ref.Ref())
+	if err != nil {
+		return nil, errors.Wrap(err, "ssbClient: get failed")
+	}
+	resp, ok := v.(json.RawMessage)
+	if !ok {
+		return nil, errors.Errorf("ssbClient: wrong reply type: %T", v)
+	}
+	return resp, nil
+}
+
+func (c client) GetByAuthorSeq(author ssb.FeedRef, seq int64) (json.RawMessage, error) {
+	v, err := c.handler.Async(c.rootCtx, json.RawMessage{}, muxrpc.Method{"getByAuthorSeq"}, author.Ref(), seq)
+	if err != nil {
+		return nil, errors.Wrap(err, "ssbClient: getByAuthorSeq failed")
+	}
+	resp, ok := v.(json.RawMessage)
+	if !ok {
+		return nil, errors.Errorf("ssbClient: wrong reply type: %T", v)
+	}
+	return resp, nil
+}
+
+func (c client) GetMany(refs []ssb.MessageRef) (luigi.Source, error) {
+	keys := make([]string, len(refs))
+	for i, ref := range refs {
+		keys[i] = ref.Ref()
+	}
+	src, err := c.handler.Source(c.rootCtx, message.KeyValueRaw{}, muxrpc.Method{"getMany"}, keys)
+	return src, errors.Wrap(err, "failed to create stream")
+}
+
 func (c client) CreateLogStream(opts message.CreateHistArgs) (luigi.Source, error) {
 	opts.Keys = true
 	src, err := c.handler.Source(c.rootCtx, message.KeyValueRaw{}, muxrpc.Method{"createLogStream"}, opts)
@@ -196,6 +230,21 @@ func (c client) Tangles(root ssb.MessageRef, o message.CreateHistArgs) (luigi.So
 	return src, errors.Wrap(err, "failed to create stream")
 }
 
+func (c client) TangleTips(name string, root ssb.MessageRef) ([]*ssb.MessageRef, error) {
+	args := map[string]interface{}{"name": name, "root": root.Ref()}
+	v, err := c.handler.Async(c.rootCtx, json.RawMessage{}, muxrpc.Method{"tangles", "tips"}, args)
+	if err != nil {
+		return nil, errors.Wrap(err, "ssbClient: tangles.tips failed")
+	}
+	resp, ok := v.(json.RawMessage)
+	if !ok {
+		return nil, errors.Errorf("ssbClient: wrong reply type: %T", v)
+	}
+	var tips []*ssb.MessageRef
+	err = json.Unmarshal(resp, &tips)
+	return tips, errors.Wrap(err, "ssbClient: failed to decode tips")
+}
+
 type noopHandler struct {
 	logger log.Logger
 }
@@ -2,6 +2,7 @@ package client_test
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
@@ -251,3 +252,79 @@ func TestTangles(t *testing.T) {
 	r.NoError(srv.Close())
 	r.NoError(<-srvErrc)
 }
+
+func TestGetByAuthorSeqAndMany(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+	srvLog, _ := logtest.KitLogger("srv", t)
+	srv, err := sbot.New(
+		sbot.WithInfo(srvLog),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+	srvAddr := srv.Network.GetListenAddr()
+
+	c, err := client.NewTCP(context.TODO(), kp, srvAddr)
+	r.NoError(err, "failed to make client connection")
+	// end test boilerplate
+
+	var refs []ssb.MessageRef
+	for i := 0; i < 3; i++ {
+		ref, err := c.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err, "failed to call publish")
+		refs = append(refs, *ref)
+	}
+
+	raw, err := c.Get(refs[1])
+	r.NoError(err)
+	var dmsg message.DeserializedMessage
+	r.NoError(json.Unmarshal(raw, &dmsg))
+	a.EqualValues(2, dmsg.Sequence)
+
+	raw, err = c.GetByAuthorSeq(*kp.Id, 3)
+	r.NoError(err)
+	r.NoError(json.Unmarshal(raw, &dmsg))
+	a.EqualValues(3, dmsg.Sequence)
+
+	_, err = c.GetByAuthorSeq(*kp.Id, 4)
+	a.Error(err, "not published yet")
+
+	unknown := ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)}
+	src, err := c.GetMany([]ssb.MessageRef{refs[2], unknown, refs[0]})
+	r.NoError(err)
+	for _, want := range []ssb.MessageRef{refs[2], refs[0]} {
+		v, err := src.Next(context.TODO())
+		r.NoError(err)
+		kv, ok := v.(message.KeyValueRaw)
+		r.True(ok, "got %T", v)
+		a.Equal(want.Ref(), kv.Key.Ref())
+	}
+	v, err := src.Next(context.TODO())
+	a.Nil(v)
+	a.Equal(luigi.EOS{}, errors.Cause(err))
+
+	msgs, err := srv.GetMany([]ssb.MessageRef{unknown, refs[1]})
+	r.NoError(err)
+	a.Nil(msgs[0])
+	a.Equal(refs[1].Ref(), msgs[1].Key.Ref())
+
+	a.NoError(c.Close())
+
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
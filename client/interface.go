@@ -1,6 +1,7 @@
 package client
 
 import (
+	"encoding/json"
 	"io"
 
 	"go.cryptoscope.co/luigi"
@@ -18,6 +19,11 @@ type Interface interface {
 
 	Publish(interface{}) (*ssb.MessageRef, error)
 
+	Get(ssb.MessageRef) (json.RawMessage, error)
+	GetByAuthorSeq(ssb.FeedRef, int64) (json.RawMessage, error)
+	// GetMany streams message.KeyValueRaw values, unknown keys are skipped
+	GetMany([]ssb.MessageRef) (luigi.Source, error)
+
 	// PrivatePublish(interface{}, ...ssb.FeedRef) (margaret.Seq, error)
 	// PrivateRead() (luigi.Source, error)
 
@@ -25,6 +31,8 @@ type Interface interface {
 	CreateLogStream(message.CreateHistArgs) (luigi.Source, error)
 	CreateHistoryStream(opts message.CreateHistArgs, as interface{}) (luigi.Source, error)
 	Tangles(ssb.MessageRef, message.CreateHistArgs) (luigi.Source, error)
+	// TangleTips returns what a new message in the named tangle of root lists as previous
+	TangleTips(name string, root ssb.MessageRef) ([]*ssb.MessageRef, error)
 
 	ReplicateUpTo() (luigi.Source, error)
 }
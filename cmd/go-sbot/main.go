@@ -38,6 +38,10 @@ var (
 	repoDir      string
 	dbgLogDir    string
 
+	flagQuota         uint64
+	flagEvictInterval time.Duration
+	flagPinned        string
+
 	// helper
 	log        logging.Interface
 	checkFatal = logging.CheckFatal
@@ -71,6 +75,10 @@ func init() {
 
 	flag.StringVar(&repoDir, "repo", filepath.Join(u.HomeDir, ".ssb-go"), "where to put the log and indexes")
 
+	flag.Uint64Var(&flagQuota, "quota", 0, "if set, evict feeds that are out of hops once the log uses more than this many megabytes")
+	flag.DurationVar(&flagEvictInterval, "evictinterval", mksbot.DefaultEvictionInterval, "how often to check the log size against the quota")
+	flag.StringVar(&flagPinned, "pin", "", "comma separated list of feeds that are never evicted")
+
 	flag.StringVar(&debugAddr, "dbg", "localhost:6078", "listen addr for metrics and pprof HTTP server")
 	flag.StringVar(&dbgLogDir, "dbgdir", "", "where to write debug output to")
 
@@ -151,6 +159,18 @@ func main() {
 		opts = append(opts, mksbot.WithHMACSigning(hcbytes))
 	}
 
+	if flagQuota > 0 {
+		opts = append(opts, mksbot.WithDiskQuota(int64(flagQuota)*1024*1024, flagEvictInterval))
+	}
+
+	if flagPinned != "" {
+		for _, ref := range strings.Split(flagPinned, ",") {
+			fr, err := ssb.ParseFeedRef(strings.TrimSpace(ref))
+			checkFatal(err)
+			opts = append(opts, mksbot.WithPinnedFeeds(fr))
+		}
+	}
+
 	if flagsReindex {
 		opts = append(opts,
 			mksbot.DisableNetworkNode(),
@@ -4,6 +4,7 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -19,6 +20,7 @@ import (
 	kitlog "github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 	goon "github.com/shurcooL/go-goon"
+	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/muxrpc"
 	"go.cryptoscope.co/muxrpc/debug"
 	"go.cryptoscope.co/netwrap"
@@ -66,12 +68,26 @@ var app = cli.App{
 	Before: initClient,
 	Commands: []*cli.Command{
 		logStreamCmd,
+		feedStreamCmd,
 		typeStreamCmd,
 		historyStreamCmd,
 		replicateUptoCmd,
 		callCmd,
 		connectCmd,
+		reindexCmd,
+		backupCmd,
+		exportCmd,
+		importCmd,
 		queryCmd,
+		linksCmd,
+		backlinksCmd,
+		searchCmd,
+		threadsCmd,
+		aboutCmd,
+		namesCmd,
+		votesCmd,
+		channelsCmd,
+		notificationsCmd,
 		privateCmd,
 		publishCmd,
 	},
@@ -184,7 +200,7 @@ func (h noopHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp mu
 }
 
 func getStreamArgs(ctx *cli.Context) message.CreateHistArgs {
-	return message.CreateHistArgs{
+	args := message.CreateHistArgs{
 		Id:      ctx.String("id"),
 		Limit:   ctx.Int64("limit"),
 		Seq:     ctx.Int64("seq"),
@@ -192,7 +208,23 @@ func getStreamArgs(ctx *cli.Context) message.CreateHistArgs {
 		Reverse: ctx.Bool("reverse"),
 		Keys:    ctx.Bool("keys"),
 		Values:  ctx.Bool("values"),
+
+		ReceivedFrom:   ctx.String("receivedFrom"),
+		ReceivedAfter:  ctx.Int64("receivedAfter"),
+		ReceivedBefore: ctx.Int64("receivedBefore"),
+		Provenance:     ctx.Bool("provenance"),
+
+		Gt:   ctx.Int64("gt"),
+		Gte:  ctx.Int64("gte"),
+		Lt:   ctx.Int64("lt"),
+		Lte:  ctx.Int64("lte"),
+		Sync: ctx.Bool("sync"),
 	}
+	if ctx.IsSet("old") {
+		old := ctx.Bool("old")
+		args.Old = &old
+	}
+	return args
 }
 
 var callCmd = &cli.Command{
@@ -255,9 +287,133 @@ var connectCmd = &cli.Command{
 	},
 }
 
+var reindexCmd = &cli.Command{
+	Name:      "reindex",
+	Usage:     "rebuild one index while the bot keeps running",
+	ArgsUsage: "name of the index (get, msgTypes, tangles)",
+	Action: func(ctx *cli.Context) error {
+		name := ctx.Args().First()
+		if name == "" {
+			return errors.New("reindex: index name argument can't be empty")
+		}
+		src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"ctrl", "reindex"}, name)
+		if err != nil {
+			return errors.Wrap(err, "reindex: source stream call failed")
+		}
+		err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+		return errors.Wrap(err, "reindex failed")
+	},
+}
+
+var backupCmd = &cli.Command{
+	Name:      "backup",
+	Usage:     "write a snapshot of the repo into an empty folder on the bots machine",
+	ArgsUsage: "<folder>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "secret", Usage: "include the secret of the bot"},
+	},
+	Action: func(ctx *cli.Context) error {
+		pth, err := filepath.Abs(ctx.Args().First())
+		if ctx.Args().First() == "" || err != nil {
+			return errors.New("backup: folder argument can't be empty")
+		}
+		var val interface{}
+		val, err = client.Async(longctx, val, muxrpc.Method{"ctrl", "backup"}, pth, map[string]interface{}{"secret": ctx.Bool("secret")})
+		if err != nil {
+			return errors.Wrapf(err, "backup: async call failed.")
+		}
+		goon.Dump(val)
+		return nil
+	},
+}
+
+var exportCmd = &cli.Command{
+	Name:      "export",
+	Usage:     "write feeds into an archive file on the bots machine",
+	ArgsUsage: "<file> [@feed=...]",
+	Flags: []cli.Flag{
+		&cli.IntFlag{Name: "hops", Value: -1, Usage: "export all feeds within this many hops of the bot"},
+	},
+	Action: func(ctx *cli.Context) error {
+		pth, err := filepath.Abs(ctx.Args().First())
+		if ctx.Args().First() == "" || err != nil {
+			return errors.New("export: archive path argument can't be empty")
+		}
+		args := map[string]interface{}{
+			"path": pth,
+		}
+		if h := ctx.Int("hops"); h >= 0 {
+			args["hops"] = h
+		}
+		if feeds := ctx.Args().Tail(); len(feeds) > 0 {
+			for _, f := range feeds {
+				if _, err := ssb.ParseFeedRef(f); err != nil {
+					return errors.Wrapf(err, "export: invalid feed %q", f)
+				}
+			}
+			args["feeds"] = feeds
+		}
+		var val interface{}
+		val, err = client.Async(longctx, val, muxrpc.Method{"archive", "export"}, args)
+		if err != nil {
+			return errors.Wrapf(err, "export: async call failed.")
+		}
+		goon.Dump(val)
+		return nil
+	},
+}
+
+var importCmd = &cli.Command{
+	Name:      "import",
+	Usage:     "load an archive file on the bots machine",
+	ArgsUsage: "<file>",
+	Action: func(ctx *cli.Context) error {
+		pth, err := filepath.Abs(ctx.Args().First())
+		if ctx.Args().First() == "" || err != nil {
+			return errors.New("import: archive path argument can't be empty")
+		}
+		var val interface{}
+		val, err = client.Async(longctx, val, muxrpc.Method{"archive", "import"}, map[string]interface{}{"path": pth})
+		if err != nil {
+			return errors.Wrapf(err, "import: async call failed.")
+		}
+		goon.Dump(val)
+		return nil
+	},
+}
+
 var queryCmd = &cli.Command{
-	Name:   "qry",
-	Action: todo, //query,
+	Name:      "qry",
+	UsageText: "aka query.read, takes a filter like '{\"value\": {\"content\": {\"type\": \"post\"}}}'",
+	Flags: []cli.Flag{
+		&cli.IntFlag{Name: "limit", Value: -1},
+		&cli.BoolFlag{Name: "reverse"},
+		&cli.BoolFlag{Name: "live"},
+		&cli.BoolFlag{Name: "keys", Value: true},
+		&cli.StringFlag{Name: "sort", Usage: "path to order the messages by, like value.timestamp"},
+	},
+	Action: func(ctx *cli.Context) error {
+		var filter map[string]interface{}
+		if err := json.Unmarshal([]byte(ctx.Args().First()), &filter); err != nil {
+			return errors.Wrap(err, "qry: filter needs to be a JSON object")
+		}
+		args := map[string]interface{}{
+			"query":   []interface{}{map[string]interface{}{"$filter": filter}},
+			"limit":   ctx.Int("limit"),
+			"reverse": ctx.Bool("reverse"),
+			"live":    ctx.Bool("live"),
+			"keys":    ctx.Bool("keys"),
+		}
+		if srt := ctx.String("sort"); srt != "" {
+			args["sort"] = srt
+		}
+		src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"query", "read"}, args)
+		if err != nil {
+			return errors.Wrap(err, "source stream call failed")
+		}
+		err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+		return errors.Wrap(err, "qry failed")
+	},
 }
 
 var privateCmd = &cli.Command{
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/muxrpc"
+	"go.cryptoscope.co/ssb"
+	cli "gopkg.in/urfave/cli.v2"
+)
+
+var namesCmd = &cli.Command{
+	Name: "names",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "search",
+			UsageText: "the feeds with a name or petname that starts with the argument",
+			Flags:     []cli.Flag{&cli.IntFlag{Name: "limit", Value: 10}},
+			Action: func(ctx *cli.Context) error {
+				args := map[string]interface{}{"prefix": ctx.Args().First(), "limit": ctx.Int("limit")}
+				var val interface{}
+				val, err := client.Async(longctx, val, muxrpc.Method{"names", "search"}, args)
+				if err != nil {
+					return errors.Wrap(err, "names.search: async call failed")
+				}
+				b, err := json.MarshalIndent(val, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "names.search: failed to encode matches")
+				}
+				_, err = fmt.Println(string(b))
+				return err
+			},
+		},
+		{
+			Name:      "set",
+			ArgsUsage: "@feed.ed25519 petname",
+			UsageText: "gives a feed a local petname, without a name it is removed",
+			Action: func(ctx *cli.Context) error {
+				feed, err := resolveFeed(ctx.Args().Get(0))
+				if err != nil {
+					return errors.Wrap(err, "names.set")
+				}
+				var val interface{}
+				_, err = client.Async(longctx, val, muxrpc.Method{"names", "set"}, feed.Ref(), ctx.Args().Get(1))
+				return errors.Wrap(err, "names.set: async call failed")
+			},
+		},
+	},
+}
+
+// resolveFeed parses ref as a feed reference or looks it up by name, so that @alice works as well
+func resolveFeed(ref string) (*ssb.FeedRef, error) {
+	if feed, err := ssb.ParseFeedRef(ref); err == nil {
+		return feed, nil
+	}
+	if !strings.HasPrefix(ref, "@") {
+		return nil, errors.Errorf("invalid feed ref: %q", ref)
+	}
+
+	var matches []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	v, err := client.Async(longctx, json.RawMessage{}, muxrpc.Method{"names", "search"}, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up %s", ref)
+	}
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		return nil, errors.Errorf("names.search: unexpected reply type %T", v)
+	}
+	if err := json.Unmarshal(raw, &matches); err != nil {
+		return nil, errors.Wrap(err, "names.search: failed to decode matches")
+	}
+
+	// Search returns the best ones first, only take those that are called exactly that
+	norm := normalizeName(ref)
+	for _, m := range matches {
+		if normalizeName(m.Name) == norm {
+			return ssb.ParseFeedRef(m.ID)
+		}
+	}
+	return nil, errors.Errorf("nobody is called %s", ref)
+}
+
+// resolveTarget is resolveFeed for feeds, message and blob references are returned as they are
+func resolveTarget(ref string) (string, error) {
+	if !strings.HasPrefix(ref, "@") {
+		return ref, nil
+	}
+	feed, err := resolveFeed(ref)
+	if err != nil {
+		return "", err
+	}
+	return feed.Ref(), nil
+}
+
+// normalizeName is indexes.NormalizeName, without pulling the indexes into the client
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
@@ -146,13 +146,13 @@ var publishVoteCmd = &cli.Command{
 
 var publishAboutCmd = &cli.Command{
 	Name:      "about",
-	ArgsUsage: "@aboutkeypair.ed25519",
+	ArgsUsage: "@aboutkeypair.ed25519 or @name",
 	Flags: []cli.Flag{
 		&cli.StringFlag{Name: "name", Usage: "what name to give"},
 		&cli.StringFlag{Name: "image", Usage: "image blob ref"},
 	},
 	Action: func(ctx *cli.Context) error {
-		aboutRef, err := ssb.ParseFeedRef(ctx.Args().First())
+		aboutRef, err := resolveFeed(ctx.Args().First())
 		if err != nil {
 			return errors.Wrapf(err, "publish/about: invalid feed ref")
 		}
@@ -183,7 +183,7 @@ var publishAboutCmd = &cli.Command{
 
 var publishContactCmd = &cli.Command{
 	Name:      "contact",
-	ArgsUsage: "@contactKeypair.ed25519",
+	ArgsUsage: "@contactKeypair.ed25519 or @name",
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "following"},
 		&cli.BoolFlag{Name: "blocking"},
@@ -191,7 +191,7 @@ var publishContactCmd = &cli.Command{
 		&cli.StringSliceFlag{Name: "recps", Usage: "as a PM to these feeds"},
 	},
 	Action: func(ctx *cli.Context) error {
-		cref, err := ssb.ParseFeedRef(ctx.Args().First())
+		cref, err := resolveFeed(ctx.Args().First())
 		if err != nil {
 			return errors.Wrapf(err, "publish/contact: invalid feed ref")
 		}
@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/muxrpc"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
 	cli "gopkg.in/urfave/cli.v2"
 )
 
@@ -20,6 +23,12 @@ var streamFlags = []cli.Flag{
 	&cli.BoolFlag{Name: "live"},
 	&cli.BoolFlag{Name: "keys", Value: false},
 	&cli.BoolFlag{Name: "values", Value: false},
+	&cli.Int64Flag{Name: "gt", Usage: "only messages after this timestamp (milliseconds since 1970)"},
+	&cli.Int64Flag{Name: "gte"},
+	&cli.Int64Flag{Name: "lt", Usage: "only messages before this timestamp (milliseconds since 1970)"},
+	&cli.Int64Flag{Name: "lte"},
+	&cli.BoolFlag{Name: "old", Value: true, Usage: "send the messages that are already stored, use --old=false for only live ones"},
+	&cli.BoolFlag{Name: "sync", Usage: "send {sync: true} between old and live messages"},
 }
 
 type mapMsg map[string]interface{}
@@ -43,6 +52,13 @@ var historyStreamCmd = &cli.Command{
 	Flags: append(streamFlags, &cli.StringFlag{Name: "id"}),
 	Action: func(ctx *cli.Context) error {
 		var args = getStreamArgs(ctx)
+		if args.Id != "" {
+			feed, err := resolveFeed(args.Id)
+			if err != nil {
+				return errors.Wrap(err, "feed hist")
+			}
+			args.Id = feed.Ref()
+		}
 		src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"createHistoryStream"}, args)
 		if err != nil {
 			return errors.Wrap(err, "source stream call failed")
@@ -53,8 +69,13 @@ var historyStreamCmd = &cli.Command{
 }
 
 var logStreamCmd = &cli.Command{
-	Name:  "log",
-	Flags: streamFlags,
+	Name: "log",
+	Flags: append(streamFlags,
+		&cli.StringFlag{Name: "receivedFrom", Usage: "only messages that this peer sent us"},
+		&cli.Int64Flag{Name: "receivedAfter", Usage: "only messages received after this time (milliseconds since 1970)"},
+		&cli.Int64Flag{Name: "receivedBefore", Usage: "only messages received before this time (milliseconds since 1970)"},
+		&cli.BoolFlag{Name: "provenance", Usage: "add the peer that sent each message"},
+	),
 	Action: func(ctx *cli.Context) error {
 		var args = getStreamArgs(ctx)
 		src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"createLogStream"}, args)
@@ -66,6 +87,306 @@ var logStreamCmd = &cli.Command{
 	},
 }
 
+var feedStreamCmd = &cli.Command{
+	Name:      "feed",
+	UsageText: "aka createFeedStream, ordered by the timestamps the authors claim",
+	Flags:     streamFlags,
+	Action: func(ctx *cli.Context) error {
+		var args = getStreamArgs(ctx)
+		src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"createFeedStream"}, args)
+		if err != nil {
+			return errors.Wrap(err, "source stream call failed")
+		}
+		err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+		return errors.Wrap(err, "feed failed")
+	},
+}
+
+var linksCmd = &cli.Command{
+	Name:      "links",
+	UsageText: "references between messages, feeds and blobs. dest can also be @, % or & for all of one kind",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "source", Usage: "only references by this feed"},
+		&cli.StringFlag{Name: "dest", Usage: "only references to this message, feed or blob"},
+		&cli.StringFlag{Name: "rel", Usage: "only references in this field of the content, like root or mentions"},
+		&cli.BoolFlag{Name: "values", Usage: "add the referencing messages"},
+		&cli.IntFlag{Name: "limit", Value: -1},
+	},
+	Action: func(ctx *cli.Context) error {
+		args := map[string]interface{}{
+			"values": ctx.Bool("values"),
+		}
+		for _, f := range []string{"source", "dest", "rel"} {
+			if v := ctx.String(f); v != "" {
+				args[f] = v
+			}
+		}
+		if l := ctx.Int("limit"); l >= 0 {
+			args["limit"] = l
+		}
+		src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"links"}, args)
+		if err != nil {
+			return errors.Wrap(err, "source stream call failed")
+		}
+		err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+		return errors.Wrap(err, "links failed")
+	},
+}
+
+var backlinksCmd = &cli.Command{
+	Name:      "backlinks",
+	UsageText: "messages that reference the message, feed or blob passed as argument",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "rel", Usage: "only references in this field of the content, like root or mentions"},
+		&cli.BoolFlag{Name: "reverse"},
+		&cli.BoolFlag{Name: "keys", Value: true},
+		&cli.IntFlag{Name: "limit", Value: -1},
+	},
+	Action: func(ctx *cli.Context) error {
+		args := map[string]interface{}{
+			"dest":    ctx.Args().First(),
+			"rel":     ctx.String("rel"),
+			"reverse": ctx.Bool("reverse"),
+			"keys":    ctx.Bool("keys"),
+			"limit":   ctx.Int("limit"),
+		}
+		src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"backlinks"}, args)
+		if err != nil {
+			return errors.Wrap(err, "source stream call failed")
+		}
+		err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+		return errors.Wrap(err, "backlinks failed")
+	},
+}
+
+var searchCmd = &cli.Command{
+	Name:      "search",
+	UsageText: "aka search.query, posts and about descriptions with all the words, best matches first",
+	Flags: []cli.Flag{
+		&cli.IntFlag{Name: "limit", Value: 20},
+		&cli.IntFlag{Name: "hops", Value: -2, Usage: "only feeds within this distance, -1 for all (default: the hops of the bot)"},
+		&cli.BoolFlag{Name: "keys", Value: true},
+	},
+	Action: func(ctx *cli.Context) error {
+		args := map[string]interface{}{
+			"query": strings.Join(ctx.Args().Slice(), " "),
+			"limit": ctx.Int("limit"),
+			"keys":  ctx.Bool("keys"),
+		}
+		if h := ctx.Int("hops"); h >= -1 {
+			args["hops"] = h
+		}
+		src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"search", "query"}, args)
+		if err != nil {
+			return errors.Wrap(err, "source stream call failed")
+		}
+		err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+		return errors.Wrap(err, "search failed")
+	},
+}
+
+var threadsCmd = &cli.Command{
+	Name: "threads",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "get",
+			UsageText: "the root message passed as argument and the replies to it, in causal order",
+			Action: func(ctx *cli.Context) error {
+				var val interface{}
+				val, err := client.Async(longctx, val, muxrpc.Method{"threads", "get"}, ctx.Args().First())
+				if err != nil {
+					return errors.Wrap(err, "threads.get: async call failed")
+				}
+				b, err := json.MarshalIndent(val, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "threads.get: failed to encode thread")
+				}
+				_, err = fmt.Println(string(b))
+				return err
+			},
+		},
+		{
+			Name:      "recent",
+			UsageText: "summaries of the threads with the latest replies",
+			Flags:     []cli.Flag{&cli.IntFlag{Name: "limit", Value: 10}},
+			Action: func(ctx *cli.Context) error {
+				args := map[string]interface{}{"limit": ctx.Int("limit")}
+				src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"threads", "recent"}, args)
+				if err != nil {
+					return errors.Wrap(err, "source stream call failed")
+				}
+				err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+				return errors.Wrap(err, "threads.recent failed")
+			},
+		},
+	},
+}
+
+var aboutCmd = &cli.Command{
+	Name: "about",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "get",
+			UsageText: "everything about messages say about the feed, message or blob passed as argument",
+			Action: func(ctx *cli.Context) error {
+				target, err := resolveTarget(ctx.Args().First())
+				if err != nil {
+					return errors.Wrap(err, "about.get")
+				}
+				var val interface{}
+				val, err = client.Async(longctx, val, muxrpc.Method{"about", "get"}, target)
+				if err != nil {
+					return errors.Wrap(err, "about.get: async call failed")
+				}
+				b, err := json.MarshalIndent(val, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "about.get: failed to encode attributes")
+				}
+				_, err = fmt.Println(string(b))
+				return err
+			},
+		},
+		{
+			Name:      "latest",
+			UsageText: "the value of a key (name, image, description...) of the target passed as first argument",
+			Action: func(ctx *cli.Context) error {
+				target, err := resolveTarget(ctx.Args().Get(0))
+				if err != nil {
+					return errors.Wrap(err, "about.latestValue")
+				}
+				var val interface{}
+				val, err = client.Async(longctx, val, muxrpc.Method{"about", "latestValue"}, target, ctx.Args().Get(1))
+				if err != nil {
+					return errors.Wrap(err, "about.latestValue: async call failed")
+				}
+				b, err := json.Marshal(val)
+				if err != nil {
+					return errors.Wrap(err, "about.latestValue: failed to encode value")
+				}
+				_, err = fmt.Println(string(b))
+				return err
+			},
+		},
+		{
+			Name:      "stream",
+			UsageText: "the attributes of every about message",
+			Flags:     streamFlags,
+			Action: func(ctx *cli.Context) error {
+				src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"about", "stream"}, getStreamArgs(ctx))
+				if err != nil {
+					return errors.Wrap(err, "source stream call failed")
+				}
+				err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+				return errors.Wrap(err, "about.stream failed")
+			},
+		},
+	},
+}
+
+var votesCmd = &cli.Command{
+	Name: "votes",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "get",
+			UsageText: "the votes on the message passed as argument",
+			Flags:     []cli.Flag{&cli.IntFlag{Name: "hops", Value: -2, Usage: "only voters within this distance, -1 for all (default: the hops of the bot)"}},
+			Action: func(ctx *cli.Context) error {
+				args := map[string]interface{}{"id": ctx.Args().First()}
+				if h := ctx.Int("hops"); h != -2 {
+					args["hops"] = h
+				}
+				var val interface{}
+				val, err := client.Async(longctx, val, muxrpc.Method{"votes", "get"}, args)
+				if err != nil {
+					return errors.Wrap(err, "votes.get: async call failed")
+				}
+				b, err := json.MarshalIndent(val, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "votes.get: failed to encode summary")
+				}
+				_, err = fmt.Println(string(b))
+				return err
+			},
+		},
+		{
+			Name:      "stream",
+			UsageText: "every vote, or only the ones on the message passed as argument",
+			Flags:     streamFlags,
+			Action: func(ctx *cli.Context) error {
+				args := getStreamArgs(ctx)
+				args.Id = ctx.Args().First()
+				src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"votes", "stream"}, args)
+				if err != nil {
+					return errors.Wrap(err, "source stream call failed")
+				}
+				err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+				return errors.Wrap(err, "votes.stream failed")
+			},
+		},
+	},
+}
+
+var channelsCmd = &cli.Command{
+	Name: "channels",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "list",
+			UsageText: "the channels we have messages of",
+			Action: func(ctx *cli.Context) error {
+				var val interface{}
+				val, err := client.Async(longctx, val, muxrpc.Method{"channels", "list"})
+				if err != nil {
+					return errors.Wrap(err, "channels.list: async call failed")
+				}
+				b, err := json.MarshalIndent(val, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "channels.list: failed to encode channels")
+				}
+				_, err = fmt.Println(string(b))
+				return err
+			},
+		},
+		{
+			Name:      "read",
+			UsageText: "the messages of the channel passed as argument",
+			Flags:     streamFlags,
+			Action: func(ctx *cli.Context) error {
+				args := struct {
+					message.CreateHistArgs
+					Name string `json:"name"`
+				}{getStreamArgs(ctx), ctx.Args().First()}
+				src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"channels", "read"}, args)
+				if err != nil {
+					return errors.Wrap(err, "source stream call failed")
+				}
+				err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+				return errors.Wrap(err, "channels.read failed")
+			},
+		},
+		{
+			Name:      "subscriptions",
+			UsageText: "the channels the feed passed as argument subscribed to",
+			Action: func(ctx *cli.Context) error {
+				feed, err := resolveFeed(ctx.Args().First())
+				if err != nil {
+					return errors.Wrap(err, "channels.subscriptions")
+				}
+				var val interface{}
+				val, err = client.Async(longctx, val, muxrpc.Method{"channels", "subscriptions"}, feed.Ref())
+				if err != nil {
+					return errors.Wrap(err, "channels.subscriptions: async call failed")
+				}
+				b, err := json.Marshal(val)
+				if err != nil {
+					return errors.Wrap(err, "channels.subscriptions: failed to encode channels")
+				}
+				_, err = fmt.Println(string(b))
+				return err
+			},
+		},
+	},
+}
+
 var privateReadCmd = &cli.Command{
 	Name:  "read",
 	Flags: streamFlags,
@@ -115,18 +436,61 @@ func jsonDrain(w io.Writer) luigi.Sink {
 	})
 }
 
-/*
-
-func query(ctx *cli.Context) error {
-	reply := make(chan map[string]interface{})
-	go func() {
-		for r := range reply {
-			goon.Dump(r)
-		}
-	}()
-	if err := client.Source("query.read", reply, ctx.Args().Get(0)); err != nil {
-		return errors.Wrap(err, "source stream call failed")
-	}
-	return client.Close()
+var notificationsCmd = &cli.Command{
+	Name: "notifications",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "client", Value: "sbotcli", Usage: "the read state is kept for each client"},
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:      "stream",
+			UsageText: "replies, mentions, votes, follows and private messages for us",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "old", Value: true},
+				&cli.BoolFlag{Name: "live"},
+				&cli.BoolFlag{Name: "unread", Usage: "only the ones that were not marked as read"},
+			},
+			Action: func(ctx *cli.Context) error {
+				args := map[string]interface{}{
+					"client": ctx.String("client"),
+					"old":    ctx.Bool("old"),
+					"live":   ctx.Bool("live"),
+					"unread": ctx.Bool("unread"),
+				}
+				src, err := client.Source(longctx, mapMsg{}, muxrpc.Method{"notifications", "stream"}, args)
+				if err != nil {
+					return errors.Wrap(err, "source stream call failed")
+				}
+				err = luigi.Pump(longctx, jsonDrain(os.Stdout), src)
+				return errors.Wrap(err, "notifications.stream failed")
+			},
+		},
+		{
+			Name:      "read",
+			UsageText: "marks the notifications for the message keys passed as arguments as read, or all of them",
+			Flags:     []cli.Flag{&cli.BoolFlag{Name: "all"}},
+			Action: func(ctx *cli.Context) error {
+				args := map[string]interface{}{"client": ctx.String("client")}
+				if ctx.Bool("all") {
+					args["all"] = true
+				} else {
+					if ctx.Args().Len() == 0 {
+						return errors.Errorf("notifications read: pass the message keys to mark or --all")
+					}
+					var keys []string
+					for _, k := range ctx.Args().Slice() {
+						ref, err := ssb.ParseMessageRef(k)
+						if err != nil {
+							return errors.Wrapf(err, "notifications read: invalid message key %q", k)
+						}
+						keys = append(keys, ref.Ref())
+					}
+					args["keys"] = keys
+				}
+				var val interface{}
+				_, err := client.Async(longctx, val, muxrpc.Method{"notifications", "markRead"}, args)
+				return errors.Wrap(err, "notifications.markRead: async call failed")
+			},
+		},
+	},
 }
-*/
@@ -0,0 +1,44 @@
+// ssb-compact removes nulled entries (from ssb-drop-feed or ssb-fsck -repair) from the log of a repo
+// and rebuilds the indexes. the bot must not be running while this is used.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	fmt.Fprintln(os.Stderr, "occurred at")
+	debug.PrintStack()
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <repo>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	lck, err := repo.Lock(repo.New(os.Args[1]))
+	check(err)
+	defer lck.Close()
+
+	start := time.Now()
+	rep, err := sbot.Compact(os.Args[1])
+	check(err)
+	log.Printf("removed %d of %d entries, reclaimed %d bytes (%d -> %d) (took %v)",
+		rep.Dropped, rep.Entries, rep.Reclaimed(), rep.SizeBefore, rep.SizeAfter, time.Since(start))
+}
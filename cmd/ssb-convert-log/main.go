@@ -0,0 +1,54 @@
+// ssb-convert-log rewrites the log of a repo with another codec, for instance to compress it.
+// the sequences stay the same, so the indexes don't need to be rebuilt. the bot must not be running while this is used.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	fmt.Fprintln(os.Stderr, "occurred at")
+	debug.PrintStack()
+	os.Exit(1)
+}
+
+var flagCodec string
+
+func main() {
+	flag.StringVar(&flagCodec, "codec", repo.LogCodecDeflate, fmt.Sprintf("codec to convert to (%s or %s)", repo.LogCodecMsgpack, repo.LogCodecDeflate))
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s [-codec name] <repo>\n", os.Args[0])
+		os.Exit(1)
+	}
+	r := repo.New(flag.Arg(0))
+
+	lck, err := repo.Lock(r)
+	check(err)
+	defer lck.Close()
+
+	start := time.Now()
+	rep, err := repo.ConvertLog(r, flagCodec)
+	check(err)
+	if rep.From == rep.To {
+		log.Printf("log already uses %s", rep.To)
+		return
+	}
+	log.Printf("converted %d entries from %s to %s: %d -> %d bytes (took %v)",
+		rep.Entries, rep.From, rep.To, rep.SizeBefore, rep.SizeAfter, time.Since(start))
+}
@@ -38,6 +38,11 @@ func main() {
 
 	r := repo.New(os.Args[1])
 
+	// held until the indexes are rebuilt
+	lck, err := repo.Lock(r)
+	check(err)
+	defer lck.Close()
+
 	var refs []*ssb.FeedRef
 	if os.Args[2] == "-" {
 		s := bufio.NewScanner(os.Stdin)
@@ -63,7 +68,7 @@ func main() {
 	}
 
 	start := time.Now()
-	err := sbot.DropIndicies(r)
+	err = sbot.DropIndicies(r)
 	check(err)
 	log.Println("idexes dropped", time.Since(start))
 
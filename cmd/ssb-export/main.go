@@ -0,0 +1,98 @@
+// ssb-export writes the feeds of a repo into an archive that can be loaded with ssb-import.
+// either pass the feeds to export or use -hops to export everything within that distance of the repos identity.
+// the bot shouldn't be running while this is used.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/archive"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	fmt.Fprintln(os.Stderr, "occurred at")
+	debug.PrintStack()
+	os.Exit(1)
+}
+
+var (
+	hops    int
+	outPath string
+)
+
+func main() {
+	flag.IntVar(&hops, "hops", -1, "export all feeds within this many hops of the repos identity")
+	flag.StringVar(&outPath, "o", "-", "where to write the archive to")
+	flag.Parse()
+
+	if flag.NArg() < 1 || (hops < 0 && flag.NArg() < 2) {
+		fmt.Fprintf(os.Stderr, "usage: %s [-o out.gz] [-hops n] <repo> [@feed=...]\n", os.Args[0])
+		os.Exit(1)
+	}
+	r := repo.New(flag.Arg(0))
+
+	var feeds []*ssb.FeedRef
+	for _, a := range flag.Args()[1:] {
+		fr, err := ssb.ParseFeedRef(a)
+		check(errors.Wrapf(err, "failed to parse %q argument", a))
+		feeds = append(feeds, fr)
+	}
+
+	// not read-only, the user feeds are brought up to date
+	lck, err := repo.Lock(r)
+	check(err)
+	defer lck.Close()
+
+	rootLog, err := repo.OpenLog(r)
+	check(errors.Wrap(err, "failed to open root log"))
+
+	userFeeds, _, serveUF, err := multilogs.OpenUserFeeds(r)
+	check(errors.Wrap(err, "failed to open user feeds"))
+	check(errors.Wrap(serveUF(context.TODO(), rootLog, false), "failed to update user feeds"))
+
+	if hops >= 0 {
+		kp, err := repo.OpenKeyPair(r)
+		check(errors.Wrap(err, "failed to open key pair"))
+
+		gb, _, _, err := indexes.OpenContacts(kitlog.NewNopLogger(), r)
+		check(errors.Wrap(err, "failed to open contacts"))
+
+		lst, err := gb.Hops(kp.Id, hops).List()
+		check(errors.Wrap(err, "failed to get hops"))
+		feeds = append(feeds, lst...)
+	}
+
+	var out io.Writer = os.Stdout
+	if outPath != "-" {
+		f, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		check(errors.Wrap(err, "failed to create archive file"))
+		defer f.Close()
+		out = f
+	}
+
+	start := time.Now()
+	m, err := archive.Export(context.TODO(), out, rootLog, userFeeds, feeds)
+	check(err)
+	log.Printf("exported %d messages of %d feeds (took %v)", m.Messages(), len(m.Feeds), time.Since(start))
+}
@@ -0,0 +1,93 @@
+// ssb-fsck checks the consistency of a repo
+// it re-verifies all the messages in the log and cross-checks the indexes against it.
+// with -repair it nulls invalid entries and rebuilds broken indexes
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	fmt.Fprintln(os.Stderr, "occurred at")
+	debug.PrintStack()
+	os.Exit(1)
+}
+
+var (
+	flagRepair bool
+	hmacSec    string
+)
+
+func main() {
+	flag.BoolVar(&flagRepair, "repair", false, "null invalid entries and rebuild the broken indexes")
+	flag.StringVar(&hmacSec, "hmac", "", "if set, verify messages using this hmac key")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s [-repair] [-hmac key] <repo>\n", os.Args[0])
+		os.Exit(1)
+	}
+	repoPath := flag.Arg(0)
+
+	var hmacKey *[32]byte
+	if hmacSec != "" {
+		hcbytes, err := base64.StdEncoding.DecodeString(hmacSec)
+		check(errors.Wrap(err, "failed to decode hmac key"))
+		if n := len(hcbytes); n != 32 {
+			check(errors.Errorf("wrong hmac key length (%d)", n))
+		}
+		var k [32]byte
+		copy(k[:], hcbytes)
+		hmacKey = &k
+	}
+
+	// only open it for writing if we are going to change the repo
+	r, lock := repo.NewReadOnly(repoPath), repo.LockReadOnly
+	if flagRepair {
+		r, lock = repo.New(repoPath), repo.Lock
+	}
+	lck, err := lock(r)
+	check(err)
+	defer lck.Close()
+
+	start := time.Now()
+	rep, err := sbot.FSCK(r, hmacKey)
+	check(err)
+
+	for _, p := range rep.Problems {
+		fmt.Println(p)
+	}
+	log.Printf("checked %d messages (%d nulled) in %v: %d problems", rep.Messages, rep.Nulled, time.Since(start), len(rep.Problems))
+
+	if len(rep.Problems) == 0 {
+		return
+	}
+
+	if !flagRepair {
+		log.Printf("invalid log entries: %d, broken indexes: %v", len(rep.InvalidEntries()), rep.BrokenIndexes())
+		os.Exit(1)
+	}
+
+	start = time.Now()
+	err = sbot.FSCKRepair(r, repoPath, rep)
+	check(err)
+	log.Println("repaired", time.Since(start))
+}
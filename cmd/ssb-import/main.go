@@ -0,0 +1,93 @@
+// ssb-import loads an archive written by ssb-export into a repo.
+// every message is verified like it would be when it's replicated, messages that are already stored are skipped.
+// the bot shouldn't be running while this is used, it updates its indexes on the next start.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb/archive"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	fmt.Fprintln(os.Stderr, "occurred at")
+	debug.PrintStack()
+	os.Exit(1)
+}
+
+var hmacSec string
+
+func main() {
+	flag.StringVar(&hmacSec, "hmac", "", "if set, verify messages using this hmac key")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [-hmac key] <repo> <archive.gz|->\n", os.Args[0])
+		os.Exit(1)
+	}
+	r := repo.New(flag.Arg(0))
+
+	var hmacKey *[32]byte
+	if hmacSec != "" {
+		hcbytes, err := base64.StdEncoding.DecodeString(hmacSec)
+		check(errors.Wrap(err, "failed to decode hmac key"))
+		if n := len(hcbytes); n != 32 {
+			check(errors.Errorf("wrong hmac key length (%d)", n))
+		}
+		var k [32]byte
+		copy(k[:], hcbytes)
+		hmacKey = &k
+	}
+
+	var in io.Reader = os.Stdin
+	if p := flag.Arg(1); p != "-" {
+		f, err := os.Open(p)
+		check(errors.Wrap(err, "failed to open archive"))
+		defer f.Close()
+		in = f
+	}
+
+	lck, err := repo.Lock(r)
+	check(err)
+	defer lck.Close()
+
+	_, runs, err := repo.Migrate(r)
+	check(errors.Wrap(err, "failed to migrate repo"))
+	for _, run := range runs {
+		log.Printf("migrated repo to version %d using %s (backup in %s)", run.Version, run.Name, run.Backup)
+	}
+
+	rootLog, err := repo.OpenLog(r)
+	check(errors.Wrap(err, "failed to open root log"))
+
+	userFeeds, _, serveUF, err := multilogs.OpenUserFeeds(r)
+	check(errors.Wrap(err, "failed to open user feeds"))
+	check(errors.Wrap(serveUF(context.TODO(), rootLog, false), "failed to update user feeds"))
+
+	start := time.Now()
+	rep, err := archive.Import(context.TODO(), in, rootLog, userFeeds, hmacKey)
+	if rep != nil {
+		log.Printf("appended %d messages, skipped %d (took %v)", rep.Appended, rep.Skipped, time.Since(start))
+	}
+	check(err)
+	check(errors.Wrap(userFeeds.Close(), "failed to close user feeds"))
+}
@@ -0,0 +1,64 @@
+// ssb-restore creates a repo from a backup made with sbotcli backup (ctrl.backup).
+// the restored repo is checked with fsck before it's considered usable.
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	fmt.Fprintln(os.Stderr, "occurred at")
+	debug.PrintStack()
+	os.Exit(1)
+}
+
+var hmacSec string
+
+func main() {
+	flag.StringVar(&hmacSec, "hmac", "", "if set, verify messages using this hmac key")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [-hmac key] <backup> <new repo>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	var hmacKey *[32]byte
+	if hmacSec != "" {
+		hcbytes, err := base64.StdEncoding.DecodeString(hmacSec)
+		check(errors.Wrap(err, "failed to decode hmac key"))
+		if n := len(hcbytes); n != 32 {
+			check(errors.Errorf("wrong hmac key length (%d)", n))
+		}
+		var k [32]byte
+		copy(k[:], hcbytes)
+		hmacKey = &k
+	}
+
+	start := time.Now()
+	rep, err := sbot.Restore(flag.Arg(0), flag.Arg(1), hmacKey)
+	if rep != nil {
+		for _, p := range rep.Problems {
+			fmt.Println(p)
+		}
+	}
+	check(err)
+	log.Printf("restored %d messages (%d nulled) (took %v)", rep.Messages, rep.Nulled, time.Since(start))
+}
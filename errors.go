@@ -8,6 +8,9 @@ import (
 
 var ErrShuttingDown = errors.Errorf("ssb: shutting down now") // this is fine
 
+// ErrNotFound is returned for messages that aren't stored
+var ErrNotFound = errors.Errorf("ssb: message not found")
+
 type ErrOutOfReach struct {
 	Dist int
 	Max  int
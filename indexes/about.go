@@ -3,8 +3,11 @@ package indexes
 import (
 	"bytes"
 	"context"
+	"encoding"
+	"encoding/binary"
 	"encoding/json"
-	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/dgraph-io/badger"
 	kitlog "github.com/go-kit/kit/log"
@@ -18,12 +21,212 @@ import (
 	"go.cryptoscope.co/ssb/repo"
 )
 
+// AboutStore holds what about messages say about feeds, messages and blobs.
+// Every field of an about message except type and about is an attribute, like name, image, description or location.
+// Only the latest value of every author counts, a null value takes it back.
 type AboutStore interface {
+	// GetName returns the name, description and image of a feed
 	GetName(*ssb.FeedRef) (*AboutInfo, error)
+
+	// Get returns all the attributes of target, by key
+	Get(target ssb.Ref) (map[string]AboutValues, error)
+
+	// LatestValue returns the value of key that the target assigned itself,
+	// or the latest one anybody assigned if there is none. The error is ssb.ErrNotFound if nobody did.
+	LatestValue(target ssb.Ref, key string) (json.RawMessage, error)
+}
+
+// AboutValues are the values that were assigned to one key of a target
+type AboutValues struct {
+	// Self is the value a feed assigned itself, nil for other targets
+	Self json.RawMessage `json:"self,omitempty"`
+
+	// Claims are the current values of every author, in the order we received them
+	Claims []AboutClaim `json:"claims"`
+}
+
+// Latest returns the value of Self or, if that is unset, the value of the latest claim
+func (av AboutValues) Latest() json.RawMessage {
+	if av.Self != nil {
+		return av.Self
+	}
+	if len(av.Claims) == 0 {
+		return nil
+	}
+	return av.Claims[len(av.Claims)-1].Value
+}
+
+// AboutClaim is a value that an author assigned to a key
+type AboutClaim struct {
+	Author *ssb.FeedRef    `json:"author"`
+	Value  json.RawMessage `json:"value"`
+	Seq    int64           `json:"seq"` // of the about message in the root log
+}
+
+// AboutAttributes returns the target and the attributes of the content of an about message.
+// Attributes with a null value are taken back.
+func AboutAttributes(content []byte) (ssb.Ref, map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, nil, errors.Wrap(err, "about: not an object")
+	}
+	var tipe, about string
+	if err := json.Unmarshal(fields["type"], &tipe); err != nil || tipe != "about" {
+		return nil, nil, errors.Errorf("about: wrong type")
+	}
+	if err := json.Unmarshal(fields["about"], &about); err != nil {
+		return nil, nil, errors.Errorf("about: missing about field")
+	}
+	target, err := ssb.ParseRef(about)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "about: invalid about field")
+	}
+
+	delete(fields, "type")
+	delete(fields, "about")
+	for k := range fields {
+		if k == "" || strings.IndexByte(k, 0) >= 0 {
+			delete(fields, k) // can't be used in keys
+		}
+	}
+	return target, fields, nil
+}
+
+// the index has one entry for every target, key and author:
+//
+//	ab:<target>\x00<key>\x00<author>
+//
+// the value is the root log sequence (8 bytes, big endian) followed by the JSON value
+var aboutPrefix = []byte("ab:")
+
+func aboutKey(target, key, author string) []byte {
+	var k bytes.Buffer
+	k.Write(aboutPrefix)
+	k.WriteString(target)
+	k.WriteByte(0)
+	k.WriteString(key)
+	k.WriteByte(0)
+	k.WriteString(author)
+	return k.Bytes()
+}
+
+// aboutValue is the value of an entry in the index
+type aboutValue struct {
+	seq   int64
+	value json.RawMessage
+}
+
+var (
+	_ encoding.BinaryMarshaler   = aboutValue{}
+	_ encoding.BinaryUnmarshaler = (*aboutValue)(nil)
+)
+
+func (av aboutValue) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8, 8+len(av.value))
+	binary.BigEndian.PutUint64(b, uint64(av.seq))
+	return append(b, av.value...), nil
+}
+
+func (av *aboutValue) UnmarshalBinary(b []byte) error {
+	if len(b) < 8 {
+		return errors.Errorf("about: invalid value length %d", len(b))
+	}
+	av.seq = int64(binary.BigEndian.Uint64(b))
+	av.value = append(json.RawMessage{}, b[8:]...)
+	return nil
 }
 
 type aboutStore struct {
-	kv *badger.DB
+	// iterate calls fn for all the keys that start with prefix
+	iterate func(prefix []byte, fn func(k, v []byte) error) error
+}
+
+func badgerIterator(db *badger.DB) func([]byte, func(k, v []byte) error) error {
+	return func(prefix []byte, fn func(k, v []byte) error) error {
+		return db.View(func(txn *badger.Txn) error {
+			iter := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer iter.Close()
+
+			for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+				it := iter.Item()
+				k := it.Key()
+				err := it.Value(func(v []byte) error {
+					return fn(k, v)
+				})
+				if err != nil {
+					return errors.Wrap(err, "about: counldnt get idx value")
+				}
+			}
+			return nil
+		})
+	}
+}
+
+func memIterator(idx repo.PrefixIterator) func([]byte, func(k, v []byte) error) error {
+	return func(prefix []byte, fn func(k, v []byte) error) error {
+		return idx.IteratePrefix(librarian.Addr(prefix), func(addr librarian.Addr, v interface{}) error {
+			bm, ok := v.(encoding.BinaryMarshaler)
+			if !ok {
+				return errors.Errorf("unexpected value type %T", v)
+			}
+			b, err := bm.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			return fn([]byte(addr), b)
+		})
+	}
+}
+
+func (ab aboutStore) Get(target ssb.Ref) (map[string]AboutValues, error) {
+	prefix := aboutKey(target.Ref(), "", "")
+	prefix = prefix[:len(prefix)-1] // up to the key
+
+	attrs := make(map[string]AboutValues)
+	err := ab.iterate(prefix, func(k, v []byte) error {
+		parts := bytes.Split(k[len(prefix):], []byte{0})
+		if len(parts) != 2 {
+			return errors.Errorf("about: invalid key")
+		}
+		key := string(parts[0])
+		author, err := ssb.ParseFeedRef(string(parts[1]))
+		if err != nil {
+			return errors.Wrap(err, "about: invalid author in key")
+		}
+		var av aboutValue
+		if err := av.UnmarshalBinary(v); err != nil {
+			return err
+		}
+
+		vals := attrs[key]
+		if author.Ref() == target.Ref() {
+			vals.Self = av.value
+		}
+		vals.Claims = append(vals.Claims, AboutClaim{Author: author, Value: av.value, Seq: av.seq})
+		attrs[key] = vals
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "about: lookup failed")
+	}
+
+	for k, vals := range attrs {
+		sort.Slice(vals.Claims, func(i, j int) bool { return vals.Claims[i].Seq < vals.Claims[j].Seq })
+		attrs[k] = vals
+	}
+	return attrs, nil
+}
+
+func (ab aboutStore) LatestValue(target ssb.Ref, key string) (json.RawMessage, error) {
+	attrs, err := ab.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	vals, has := attrs[key]
+	if !has {
+		return nil, errors.Wrapf(ssb.ErrNotFound, "about: %s has no %s", target.Ref(), key)
+	}
+	return vals.Latest(), nil
 }
 
 type AboutInfo struct {
@@ -36,101 +239,77 @@ type AboutAttribute struct {
 }
 
 func (ab aboutStore) GetName(ref *ssb.FeedRef) (*AboutInfo, error) {
-	addr := append(ref.ID, ':')
-
-	// from self
-	// addr = append(addr, ref.ID...)
-
-	// explicit lookup
-	// addr = append(addr, []byte(":name")...)
-	// if obs, err := ab.idx.Get(context.TODO(), librarian.Addr(addr)); err == nil {
-	// 	val, err := obs.Value()
-	// 	if err == nil {
-	// 		return val.(string)
-	// 	}
-	// }
-
-	// direct badger magic
-	// most of this feels like to direct k:v magic to be honest
-	var reduced AboutInfo
-	reduced.Name.Prescribed = make(map[string]int)
-	reduced.Description.Prescribed = make(map[string]int)
-	reduced.Image.Prescribed = make(map[string]int)
-
-	err := ab.kv.View(func(txn *badger.Txn) error {
-		iter := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer iter.Close()
-
-		for iter.Seek(addr); iter.ValidForPrefix(addr); iter.Next() {
-			it := iter.Item()
-			k := it.Key()
-			c := ssb.FeedRef{ // who authored the about
-				Algo: "ed25519",
-				ID:   k[33 : 33+32],
-			}
-			err := it.Value(func(v []byte) error {
-				// log.Printf("about debug: %s ", c.Ref())
-				var fieldPtr *AboutAttribute
-				foundVal := string(v)
-				switch {
-				case bytes.HasSuffix(k, []byte(":name")):
-					fieldPtr = &reduced.Name
-				case bytes.HasSuffix(k, []byte(":description")):
-					fieldPtr = &reduced.Description
-				case bytes.HasSuffix(k, []byte(":image")):
-					fieldPtr = &reduced.Image
-				}
-
-				if bytes.Equal(c.ID, ref.ID) {
-					fieldPtr.Chosen = foundVal
-				} else {
-					cnt, has := fieldPtr.Prescribed[foundVal]
-					if has {
-						cnt++
-					} else {
-						cnt = 1
-					}
-					fieldPtr.Prescribed[foundVal] = cnt
-				}
+	attrs, err := ab.Get(ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "name db lookup failed")
+	}
 
-				// log.Printf(" key: %q", string(k))
-				return nil
-			})
-			if err != nil {
-				return errors.Wrap(err, "about: counldnt get idx value")
+	var reduced AboutInfo
+	for key, fieldPtr := range map[string]*AboutAttribute{
+		"name":        &reduced.Name,
+		"description": &reduced.Description,
+		"image":       &reduced.Image,
+	} {
+		fieldPtr.Prescribed = make(map[string]int)
+		for _, c := range attrs[key].Claims {
+			str := aboutString(c.Value)
+			if c.Author.Ref() == ref.Ref() {
+				fieldPtr.Chosen = str
+			} else {
+				fieldPtr.Prescribed[str]++
 			}
-
 		}
-		return nil
-	})
+	}
+	return &reduced, nil
+}
 
-	return &reduced, errors.Wrap(err, "name db lookup failed")
+// aboutString returns strings as they are and the link of objects like images
+func aboutString(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	var obj struct {
+		Link string `json:"link"`
+	}
+	json.Unmarshal(v, &obj)
+	return obj.Link
 }
 
 const FolderNameAbout = "about"
 
-func OpenAbout(log kitlog.Logger, r repo.Interface) (AboutStore, repo.ServeFunc, error) {
+func OpenAbout(log kitlog.Logger, r repo.Interface) (AboutStore, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		idx, _, serve, err := repo.OpenIndex(r, FolderNameAbout, func(idx librarian.Index) librarian.SinkIndex {
+			return librarian.NewSinkIndex(updateAboutMessage, idx.(librarian.SeqSetterIndex))
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "error getting about index")
+		}
+		return aboutStore{memIterator(idx.(repo.PrefixIterator))}, nil, serve, nil
+	}
+
 	f := func(db *badger.DB) librarian.SinkIndex {
-		aboutIdx := libbadger.NewIndex(db, 0)
+		aboutIdx := libbadger.NewIndex(db, aboutValue{})
 
 		return librarian.NewSinkIndex(updateAboutMessage, aboutIdx)
 	}
 
 	db, _, serve, err := repo.OpenBadgerIndex(r, FolderNameAbout, f)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "error getting about index")
+		return nil, nil, nil, errors.Wrap(err, "error getting about index")
 	}
 
-	return aboutStore{db}, serve, nil
+	return aboutStore{badgerIterator(db)}, db, serve, nil
 }
 
 func updateAboutMessage(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
 	msg, ok := val.(message.StoredMessage)
 	if !ok {
-		if margaret.IsErrNulled(val.(error)) {
+		if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
 			return nil
 		}
-		return fmt.Errorf("about(%d): wrong msgT: %T", seq, val)
+		return errors.Errorf("about(%d): wrong msgT: %T", seq.Seq(), val)
 	}
 
 	var dmsg message.DeserializedMessage
@@ -139,36 +318,21 @@ func updateAboutMessage(ctx context.Context, seq margaret.Seq, val interface{},
 		return errors.Wrap(err, "db/idx about: first json unmarshal failed")
 	}
 
-	var aboutMSG ssb.About
-	err = json.Unmarshal(dmsg.Content, &aboutMSG)
+	target, attrs, err := AboutAttributes(dmsg.Content)
 	if err != nil {
-		if ssb.IsMessageUnusable(err) {
-			return nil
-		}
-		// log.Log("msg", "skipped contact message", "reason", err)
-		return nil
+		return nil // not an about message
 	}
 
-	// about:from:key
-	addr := append(aboutMSG.About.ID, ':')
-	addr = append(addr, dmsg.Author.ID...)
-	switch {
-	case aboutMSG.Name != "":
-		err = idx.Set(ctx,
-			librarian.Addr(append(addr, []byte(":name")...)),
-			aboutMSG.Name)
-	case aboutMSG.Description != "":
-		err = idx.Set(ctx,
-			librarian.Addr(append(addr, []byte(":description")...)),
-			aboutMSG.Description)
-	case aboutMSG.Image != nil:
-		err = idx.Set(ctx,
-			librarian.Addr(append(addr, []byte(":image")...)),
-			aboutMSG.Image.Ref())
-	}
-	if err != nil {
-		return errors.Wrap(err, "db/idx about: failed to update field")
+	for key, v := range attrs {
+		addr := librarian.Addr(aboutKey(target.Ref(), key, dmsg.Author.Ref()))
+		if string(v) == "null" {
+			err = idx.Delete(ctx, addr)
+		} else {
+			err = idx.Set(ctx, addr, aboutValue{seq: seq.Seq(), value: v})
+		}
+		if err != nil {
+			return errors.Wrap(err, "db/idx about: failed to update field")
+		}
 	}
-
 	return nil
 }
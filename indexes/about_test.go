@@ -0,0 +1,68 @@
+package indexes
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestAbout(t *testing.T) {
+	alice := testFeed(1)
+	bob := testFeed(2)
+	blob := &ssb.BlobRef{Algo: "sha256", Hash: make([]byte, 32)}
+
+	msgs := []testMsg{
+		{alice, fmt.Sprintf(`{"type":"about","about":%q,"name":"alice","image":{"link":%q}}`, alice.Ref(), blob.Ref())},
+		{bob, fmt.Sprintf(`{"type":"about","about":%q,"name":"ally","location":"berlin"}`, alice.Ref())},
+		{bob, fmt.Sprintf(`{"type":"about","about":%q,"name":"bob"}`, bob.Ref())},
+		{alice, fmt.Sprintf(`{"type":"about","about":%q,"name":"bobby"}`, bob.Ref())},
+		{alice, fmt.Sprintf(`{"type":"about","about":%q,"description":"a cat"}`, blob.Ref())},
+		{bob, fmt.Sprintf(`{"type":"about","about":%q,"location":null}`, alice.Ref())},
+		{alice, fmt.Sprintf(`{"type":"post","about":%q,"name":"nope"}`, bob.Ref())},
+	}
+
+	var ab AboutStore
+	open := func(rp repo.Interface) (db *badger.DB, serve repo.ServeFunc, err error) {
+		ab, db, serve, err = OpenAbout(kitlog.NewNopLogger(), rp)
+		return
+	}
+
+	testIndex(t, msgs, open, func(t *testing.T) {
+		r := require.New(t)
+
+		attrs, err := ab.Get(alice)
+		r.NoError(err)
+		r.Len(attrs, 2, "location should be taken back")
+		r.Equal(json.RawMessage(`"alice"`), attrs["name"].Self)
+		r.Len(attrs["name"].Claims, 2)
+		r.Equal(bob.Ref(), attrs["name"].Claims[1].Author.Ref())
+		r.Equal(json.RawMessage(`"ally"`), attrs["name"].Claims[1].Value)
+		r.EqualValues(1, attrs["name"].Claims[1].Seq)
+
+		// self-assigned values win over newer ones
+		v, err := ab.LatestValue(bob, "name")
+		r.NoError(err)
+		r.Equal(json.RawMessage(`"bob"`), v)
+
+		v, err = ab.LatestValue(blob, "description")
+		r.NoError(err)
+		r.Equal(json.RawMessage(`"a cat"`), v)
+
+		_, err = ab.LatestValue(alice, "location")
+		r.Equal(ssb.ErrNotFound, errors.Cause(err))
+
+		info, err := ab.GetName(alice)
+		r.NoError(err)
+		r.Equal("alice", info.Name.Chosen)
+		r.Equal(map[string]int{"ally": 1}, info.Name.Prescribed)
+		r.Equal(blob.Ref(), info.Image.Chosen)
+	})
+}
@@ -0,0 +1,144 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameSubscriptions = "subscriptions"
+
+// SubscriptionIndex holds the channels feeds subscribed to with channel messages
+type SubscriptionIndex interface {
+	// Subscriptions returns the normalized names of the channels feed is subscribed to, sorted
+	Subscriptions(feed *ssb.FeedRef) ([]string, error)
+
+	// Subscribers returns the feeds that are subscribed to the channel
+	Subscribers(channel string) ([]*ssb.FeedRef, error)
+}
+
+// the index has two keys for every subscription, one to look up the channels of a feed and one for the feeds of a channel:
+//
+//	cs:<feed>\x00<channel>
+//	cf:<channel>\x00<feed>
+//
+// unsubscribing deletes both of them
+var (
+	subscriptionPrefix = []byte("cs:")
+	subscriberPrefix   = []byte("cf:")
+)
+
+func subscriptionKey(prefix []byte, a, b string) []byte {
+	var k bytes.Buffer
+	k.Write(prefix)
+	k.WriteString(a)
+	k.WriteByte(0)
+	k.WriteString(b)
+	return k.Bytes()
+}
+
+type subscriptionIndex struct {
+	keys keyIterator
+}
+
+func (si subscriptionIndex) Subscriptions(feed *ssb.FeedRef) ([]string, error) {
+	prefix := subscriptionKey(subscriptionPrefix, feed.Ref(), "")
+	var channels []string
+	err := si.keys(prefix, func(k []byte) error {
+		channels = append(channels, string(k[len(prefix):]))
+		return nil
+	})
+	return channels, errors.Wrap(err, "subscriptions: lookup failed")
+}
+
+func (si subscriptionIndex) Subscribers(channel string) ([]*ssb.FeedRef, error) {
+	ch, ok := multilogs.NormalizeChannel(channel)
+	if !ok {
+		return nil, errors.Errorf("subscriptions: invalid channel name %q", channel)
+	}
+	prefix := subscriptionKey(subscriberPrefix, ch, "")
+	var feeds []*ssb.FeedRef
+	err := si.keys(prefix, func(k []byte) error {
+		feed, err := ssb.ParseFeedRef(string(k[len(prefix):]))
+		if err != nil {
+			return errors.Wrap(err, "subscriptions: invalid feed in key")
+		}
+		feeds = append(feeds, feed)
+		return nil
+	})
+	return feeds, errors.Wrap(err, "subscriptions: lookup failed")
+}
+
+// OpenSubscriptions supplies the index of channel subscriptions
+func OpenSubscriptions(r repo.Interface) (SubscriptionIndex, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		idx, _, serve, err := repo.OpenIndex(r, FolderNameSubscriptions, func(idx librarian.Index) librarian.SinkIndex {
+			return librarian.NewSinkIndex(updateSubscriptions, idx.(librarian.SeqSetterIndex))
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "error getting subscription index")
+		}
+		return subscriptionIndex{memKeys(idx.(repo.PrefixIterator))}, nil, serve, nil
+	}
+
+	db, _, serve, err := repo.OpenBadgerIndex(r, FolderNameSubscriptions, func(db *badger.DB) librarian.SinkIndex {
+		return librarian.NewSinkIndex(updateSubscriptions, libbadger.NewIndex(db, margaret.BaseSeq(0)))
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting subscription index")
+	}
+	return subscriptionIndex{badgerKeys(db)}, db, serve, nil
+}
+
+func updateSubscriptions(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(message.StoredMessage)
+	if !ok {
+		if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return errors.Errorf("subscriptions(%d): wrong msgT: %T", seq.Seq(), val)
+	}
+
+	var value struct {
+		Content struct {
+			Type       string `json:"type"`
+			Channel    string `json:"channel"`
+			Subscribed bool   `json:"subscribed"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(msg.Raw, &value); err != nil || value.Content.Type != "channel" {
+		return nil // boxed or not a channel message
+	}
+	ch, ok := multilogs.NormalizeChannel(value.Content.Channel)
+	if !ok {
+		return nil
+	}
+
+	feed := msg.Author.Ref()
+	for _, addr := range []librarian.Addr{
+		librarian.Addr(subscriptionKey(subscriptionPrefix, feed, ch)),
+		librarian.Addr(subscriptionKey(subscriberPrefix, ch, feed)),
+	} {
+		var err error
+		if value.Content.Subscribed {
+			err = idx.Set(ctx, addr, margaret.BaseSeq(seq.Seq()))
+		} else {
+			err = idx.Delete(ctx, addr)
+		}
+		if err != nil {
+			return errors.Wrap(err, "subscriptions: failed to update index")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package indexes
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestSubscriptions(t *testing.T) {
+	alice := testFeed(1)
+	bob := testFeed(2)
+
+	msgs := []testMsg{
+		{alice, `{"type":"channel","channel":"#Go","subscribed":true}`},
+		{alice, `{"type":"channel","channel":"ssb","subscribed":true}`},
+		{bob, `{"type":"channel","channel":"go","subscribed":true}`},
+		{alice, `{"type":"channel","channel":"ssb","subscribed":false}`},
+		{bob, `{"type":"post","channel":"ssb"}`},
+		{alice, `{"type":"channel","channel":"art","subscribed":true}`},
+		{bob, `{"type":"channel","channel":"go\u0000x","subscribed":true}`},
+	}
+
+	var idx SubscriptionIndex
+	open := func(rp repo.Interface) (db *badger.DB, serve repo.ServeFunc, err error) {
+		idx, db, serve, err = OpenSubscriptions(rp)
+		return
+	}
+
+	testIndex(t, msgs, open, func(t *testing.T) {
+		r := require.New(t)
+
+		chans, err := idx.Subscriptions(alice)
+		r.NoError(err)
+		r.Equal([]string{"art", "go"}, chans)
+
+		chans, err = idx.Subscriptions(bob)
+		r.NoError(err)
+		r.Equal([]string{"go"}, chans)
+
+		feeds, err := idx.Subscribers("#GO")
+		r.NoError(err)
+		r.Equal([]*ssb.FeedRef{alice, bob}, feeds)
+
+		feeds, err = idx.Subscribers("ssb")
+		r.NoError(err)
+		r.Len(feeds, 0)
+	})
+}
@@ -15,14 +15,15 @@ import (
 
 const FolderNameContacts = "contacts"
 
-func OpenContacts(log kitlog.Logger, r repo.Interface) (graph.Builder, repo.ServeFunc, error) {
+// OpenContacts opens the contact graph index. The database is closed once serving stops.
+func OpenContacts(log kitlog.Logger, r repo.Interface) (graph.Builder, *badger.DB, repo.ServeFunc, error) {
 	f := func(db *badger.DB) librarian.SinkIndex {
 		return graph.NewBuilder(kitlog.With(log, "module", "graph"), db)
 	}
 
 	db, sinkIdx, serve, err := repo.OpenBadgerIndex(r, FolderNameContacts, f)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "error getting contacts index")
+		return nil, nil, nil, errors.Wrap(err, "error getting contacts index")
 	}
 
 	bldr := sinkIdx.(graph.Builder)
@@ -36,5 +37,5 @@ func OpenContacts(log kitlog.Logger, r repo.Interface) (graph.Builder, repo.Serv
 		return db.Close()
 	}
 
-	return bldr, nextServe, nil
+	return bldr, db, nextServe, nil
 }
@@ -15,11 +15,18 @@ import (
 
 const FolderNameGet = "get"
 
-// OpenGet supplies the get(msgRef) -> rootLogSeq idx
-func OpenGet(r repo.Interface) (librarian.Index, repo.ServeFunc, error) {
+// OpenGet supplies the get(msgRef) -> rootLogSeq idx.
+// The database is closed once serving stops.
+func OpenGet(r repo.Interface) (librarian.Index, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		return repo.OpenIndex(r, FolderNameGet, func(idx librarian.Index) librarian.SinkIndex {
+			return getSink(idx.(librarian.SeqSetterIndex))
+		})
+	}
+
 	db, sinkIdx, serve, err := repo.OpenBadgerIndex(r, FolderNameGet, getIDX)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "error getting get() index")
+		return nil, nil, nil, errors.Wrap(err, "error getting get() index")
 	}
 	nextServe := func(ctx context.Context, log margaret.Log, live bool) error {
 		err := serve(ctx, log, live)
@@ -28,17 +35,33 @@ func OpenGet(r repo.Interface) (librarian.Index, repo.ServeFunc, error) {
 		}
 		return db.Close()
 	}
-	return sinkIdx, nextServe, nil
+	return sinkIdx, db, nextServe, nil
+}
+
+// OpenGetDB opens the get index without serving it, for offline inspection of the repo.
+// The caller has to close the returned database.
+func OpenGetDB(r repo.Interface) (librarian.Index, *badger.DB, error) {
+	db, sinkIdx, _, err := repo.OpenBadgerIndex(r, FolderNameGet, getIDX)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error getting get() index")
+	}
+	return sinkIdx, db, nil
 }
 
 func getIDX(db *badger.DB) librarian.SinkIndex {
-	idx := libbadger.NewIndex(db, margaret.BaseSeq(0))
+	return getSink(libbadger.NewIndex(db, margaret.BaseSeq(0)))
+}
+
+func getSink(idx librarian.SeqSetterIndex) librarian.SinkIndex {
 	idxSink := librarian.NewSinkIndex(func(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
 		msg, ok := val.(message.StoredMessage)
 		if !ok {
+			if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+				return nil
+			}
 			return errors.Errorf("index/get: unexpected message type: %T", val)
 		}
-		err := idx.Set(ctx, librarian.Addr(msg.Key.Hash), seq.Seq())
+		err := idx.Set(ctx, librarian.Addr(msg.Key.Hash), margaret.BaseSeq(seq.Seq()))
 		return errors.Wrapf(err, "index/get: failed to update message %s (seq: %d)", msg.Key.Ref(), seq.Seq())
 	}, idx)
 	return idxSink
@@ -0,0 +1,254 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/bloom"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const (
+	// FileNameGetFilter is where the filter is saved, in the folder of the get index
+	FileNameGetFilter = "bloom"
+
+	getFilterMinCapacity = 1 << 16
+	getFilterFPRate      = 0.01
+)
+
+// GetFilter is a bloom filter of all the message keys in the root log.
+// It sits in front of the get index and answers lookups of messages we don't have without reading from it.
+//
+// It is saved on Close and loaded again by OpenGetFilter, which only needs to add the messages that came in since then.
+// If the log outgrew the size it was made for, it's rebuilt from the log.
+type GetFilter struct {
+	stats GetFilterStats // first for the alignment of the atomic counters
+
+	mu     sync.RWMutex
+	filter *bloom.Filter
+	seq    int64 // last entry of the root log that was added
+	path   string
+
+	events metrics.Counter
+}
+
+// GetFilterStats counts the lookups that went through the filter
+type GetFilterStats struct {
+	Negatives      uint64 // answered by the filter alone
+	Maybes         uint64 // had to ask the index
+	FalsePositives uint64 // the index didn't have it either
+}
+
+// FalsePositiveRate is the share of lookups for unknown messages that the filter didn't catch
+func (st GetFilterStats) FalsePositiveRate() float64 {
+	unknown := st.Negatives + st.FalsePositives
+	if unknown == 0 {
+		return 0
+	}
+	return float64(st.FalsePositives) / float64(unknown)
+}
+
+// OpenGetFilter loads the filter of the repo, or creates a new one if there is none or it is too full.
+// events counts negatives, maybes and false positives of lookups, it can be nil.
+func OpenGetFilter(r repo.Interface, rootLog margaret.Log, events metrics.Counter) (*GetFilter, repo.ServeFunc, error) {
+	sv, err := rootLog.Seq().Value()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "getfilter: failed to get root log sequence")
+	}
+	logSeq := sv.(margaret.Seq).Seq()
+
+	gf := &GetFilter{
+		seq:    -1,
+		events: events,
+	}
+	if !repo.IsMemory(r) {
+		gf.path = r.GetPath(repo.PrefixIndex, FolderNameGet, FileNameGetFilter)
+		if err := gf.load(logSeq); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if gf.filter == nil {
+		capacity := uint64(2 * (logSeq + 1))
+		if capacity < getFilterMinCapacity {
+			capacity = getFilterMinCapacity
+		}
+		gf.filter = bloom.New(capacity, getFilterFPRate)
+		gf.seq = -1
+	}
+
+	return gf, gf.serve, nil
+}
+
+// load reads the saved filter. It leaves gf.filter nil if there is none or it can't be used.
+func (gf *GetFilter) load(logSeq int64) error {
+	b, err := ioutil.ReadFile(gf.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "getfilter: failed to read saved filter")
+	}
+	if len(b) < 8 {
+		return nil
+	}
+
+	seq := int64(binary.BigEndian.Uint64(b[:8]))
+	f, err := bloom.Read(bytes.NewReader(b[8:]))
+	if err != nil {
+		return nil // rebuild it
+	}
+	if seq > logSeq || f.Count() > f.Capacity() {
+		// from another log or too full
+		return nil
+	}
+	gf.filter, gf.seq = f, seq
+	return nil
+}
+
+func (gf *GetFilter) serve(ctx context.Context, rootLog margaret.Log, live bool) error {
+	gf.mu.RLock()
+	from := gf.seq
+	gf.mu.RUnlock()
+
+	src, err := rootLog.Query(margaret.Live(live), margaret.SeqWrap(true), margaret.Gt(margaret.BaseSeq(from)))
+	if err != nil {
+		return errors.Wrap(err, "getfilter: error querying root log")
+	}
+
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return errors.Errorf("getfilter: unexpected value: %T", v)
+		}
+
+		gf.mu.Lock()
+		defer gf.mu.Unlock()
+		switch tv := sw.Value().(type) {
+		case message.StoredMessage:
+			gf.filter.Add(tv.Key.Hash)
+		case error:
+			if !margaret.IsErrNulled(tv) {
+				return tv
+			}
+		default:
+			return errors.Errorf("getfilter: unexpected message type: %T", tv)
+		}
+		gf.seq = sw.Seq().Seq()
+		return nil
+	})
+
+	err = luigi.Pump(ctx, snk, src)
+	if err == ssb.ErrShuttingDown || errors.Cause(err) == context.Canceled {
+		return nil
+	}
+	return errors.Wrap(err, "getfilter: pump failed")
+}
+
+// Close saves the filter
+func (gf *GetFilter) Close() error {
+	if gf.path == "" {
+		return nil
+	}
+
+	gf.mu.RLock()
+	defer gf.mu.RUnlock()
+
+	var buf bytes.Buffer
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], uint64(gf.seq))
+	buf.Write(seqBytes[:])
+	if _, err := gf.filter.WriteTo(&buf); err != nil {
+		return errors.Wrap(err, "getfilter: failed to encode")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(gf.path), 0700); err != nil {
+		return errors.Wrap(err, "getfilter: failed to create folder")
+	}
+	if err := ioutil.WriteFile(gf.path+".tmp", buf.Bytes(), 0600); err != nil {
+		return errors.Wrap(err, "getfilter: failed to save")
+	}
+	return errors.Wrap(os.Rename(gf.path+".tmp", gf.path), "getfilter: failed to save")
+}
+
+// Stats returns the counts of the lookups so far
+func (gf *GetFilter) Stats() GetFilterStats {
+	return GetFilterStats{
+		Negatives:      atomic.LoadUint64(&gf.stats.Negatives),
+		Maybes:         atomic.LoadUint64(&gf.stats.Maybes),
+		FalsePositives: atomic.LoadUint64(&gf.stats.FalsePositives),
+	}
+}
+
+func (gf *GetFilter) count(ctr *uint64, event string) {
+	atomic.AddUint64(ctr, 1)
+	if gf.events != nil {
+		gf.events.With("event", event).Add(1)
+	}
+}
+
+// missing returns true if the message with that key is definitely not in the log (up to logSeq)
+func (gf *GetFilter) missing(key []byte, logSeq int64) bool {
+	gf.mu.RLock()
+	defer gf.mu.RUnlock()
+	if gf.seq < logSeq {
+		return false // still catching up
+	}
+	return !gf.filter.Has(key)
+}
+
+// Wrap puts the filter in front of the get index idx
+func (gf *GetFilter) Wrap(idx librarian.Index, rootLog margaret.Log) librarian.Index {
+	return filteredIndex{Index: idx, gf: gf, rootLog: rootLog}
+}
+
+type filteredIndex struct {
+	librarian.Index
+
+	gf      *GetFilter
+	rootLog margaret.Log
+}
+
+func (fi filteredIndex) Get(ctx context.Context, addr librarian.Addr) (luigi.Observable, error) {
+	// read the log position first, so that messages added after it count as not there yet
+	sv, err := fi.rootLog.Seq().Value()
+	if err != nil {
+		return nil, errors.Wrap(err, "getfilter: failed to get root log sequence")
+	}
+
+	if fi.gf.missing([]byte(addr), sv.(margaret.Seq).Seq()) {
+		fi.gf.count(&fi.gf.stats.Negatives, "getfilter.negative")
+		return luigi.NewObservable(librarian.UnsetValue{Addr: addr}), nil
+	}
+	fi.gf.count(&fi.gf.stats.Maybes, "getfilter.maybe")
+
+	obs, err := fi.Index.Get(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if v, err := obs.Value(); err == nil {
+		if _, unset := v.(librarian.UnsetValue); unset {
+			fi.gf.count(&fi.gf.stats.FalsePositives, "getfilter.falsepositive")
+		}
+	}
+	return obs, nil
+}
@@ -0,0 +1,170 @@
+package indexes
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const largeRepo = "../plugins/gossip/testdata/largeRepo"
+
+// openLargeRepo copies the log of the largeRepo fixture into a new repo, since serving writes to it.
+// It returns the repo with a served get index, the keys of all the messages and a func to remove it again.
+func openLargeRepo(t testing.TB) (repo.Interface, margaret.Log, librarian.Index, [][]byte, func()) {
+	r := require.New(t)
+
+	dir, err := ioutil.TempDir("", "getfilter")
+	r.NoError(err)
+	for _, name := range []string{"data", "jrnl", "ofst"} {
+		r.NoError(copyFile(filepath.Join(dir, "log", name), filepath.Join(largeRepo, "log", name)))
+	}
+	rp := repo.New(dir)
+
+	rootLog, err := repo.OpenLog(rp)
+	r.NoError(err)
+
+	_, _, serve, err := OpenGet(rp)
+	r.NoError(err)
+	r.NoError(serve(context.TODO(), rootLog, false))
+
+	idx, db, err := OpenGetDB(rp)
+	r.NoError(err)
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+
+	src, err := rootLog.Query()
+	r.NoError(err)
+	var keys [][]byte
+	for {
+		v, err := src.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			break
+		}
+		r.NoError(err)
+		keys = append(keys, v.(message.StoredMessage).Key.Hash)
+	}
+	r.Len(keys, 431)
+
+	return rp, rootLog, idx, keys, cleanup
+}
+
+func copyFile(dst, src string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func randomKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 32)
+		rand.Read(keys[i])
+	}
+	return keys
+}
+
+func TestGetFilter(t *testing.T) {
+	r := require.New(t)
+	ctx := context.TODO()
+
+	rp, rootLog, idx, keys, cleanup := openLargeRepo(t)
+	defer cleanup()
+
+	gf, serve, err := OpenGetFilter(rp, rootLog, nil)
+	r.NoError(err)
+	r.NoError(serve(ctx, rootLog, false))
+	getIdx := gf.Wrap(idx, rootLog)
+
+	for i, k := range keys {
+		obs, err := getIdx.Get(ctx, librarian.Addr(k))
+		r.NoError(err)
+		v, err := obs.Value()
+		r.NoError(err)
+		r.Equal(margaret.BaseSeq(i), v, "message %d", i)
+	}
+
+	unknown := randomKeys(1000)
+	for _, k := range unknown {
+		obs, err := getIdx.Get(ctx, librarian.Addr(k))
+		r.NoError(err)
+		v, err := obs.Value()
+		r.NoError(err)
+		r.IsType(librarian.UnsetValue{}, v)
+	}
+
+	st := gf.Stats()
+	r.EqualValues(len(unknown), st.Negatives+st.FalsePositives)
+	r.EqualValues(len(keys)+int(st.FalsePositives), st.Maybes)
+	r.True(st.FalsePositiveRate() < 0.05, "false positive rate: %f", st.FalsePositiveRate())
+
+	// saved and loaded again, without rebuilding
+	r.NoError(gf.Close())
+	gf2, _, err := OpenGetFilter(rp, rootLog, nil)
+	r.NoError(err)
+	r.EqualValues(len(keys)-1, gf2.seq)
+	r.EqualValues(len(keys), gf2.filter.Count())
+	for _, k := range keys {
+		r.False(gf2.missing(k, gf2.seq))
+	}
+}
+
+func BenchmarkGetUnknown(b *testing.B) {
+	rp, rootLog, idx, _, cleanup := openLargeRepo(b)
+	defer cleanup()
+	unknown := randomKeys(1024)
+
+	gf, serve, err := OpenGetFilter(rp, rootLog, nil)
+	require.NoError(b, err)
+	require.NoError(b, serve(context.TODO(), rootLog, false))
+
+	for _, bc := range []struct {
+		name string
+		idx  librarian.Index
+	}{
+		{"index", idx},
+		{"filter", gf.Wrap(idx, rootLog)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx := context.TODO()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				obs, err := bc.idx.Get(ctx, librarian.Addr(unknown[i%len(unknown)]))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := obs.Value(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	b.Logf("false positive rate: %f", gf.Stats().FalsePositiveRate())
+}
@@ -0,0 +1,73 @@
+package indexes
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// testMsg is a message that testIndex appends, content is its JSON
+type testMsg struct {
+	author  *ssb.FeedRef
+	content string
+}
+
+// testFeed returns a fake feed, only the last byte of the ID is set
+func testFeed(b byte) *ssb.FeedRef {
+	return &ssb.FeedRef{Algo: "ed25519", ID: append(make([]byte, 31), b)}
+}
+
+// testKey returns the key of the i-th message that testIndex appends
+func testKey(i int) *ssb.MessageRef {
+	return &ssb.MessageRef{Algo: "sha256", Hash: []byte(fmt.Sprintf("%032d", i))}
+}
+
+// testIndex runs check once with a memory repo and once with one on disk.
+// The root log of both holds msgs and the index that open returns is served up to the end of it.
+// open needs to keep the index for check, its database is closed afterwards.
+func testIndex(t *testing.T, msgs []testMsg, open func(repo.Interface) (*badger.DB, repo.ServeFunc, error), check func(*testing.T)) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	run := func(rp repo.Interface) func(*testing.T) {
+		return func(t *testing.T) {
+			r := require.New(t)
+
+			rootLog, err := repo.OpenLog(rp)
+			r.NoError(err)
+			for i, m := range msgs {
+				_, err := rootLog.Append(message.StoredMessage{
+					Author:    m.author,
+					Key:       testKey(i),
+					Sequence:  margaret.BaseSeq(i + 1),
+					Timestamp: time.Unix(int64(i), 0),
+					Raw:       []byte(fmt.Sprintf(`{"author":%q,"sequence":%d,"content":%s}`, m.author.Ref(), i+1, m.content)),
+				})
+				r.NoError(err)
+			}
+
+			db, serve, err := open(rp)
+			r.NoError(err)
+			if db != nil {
+				defer db.Close()
+			}
+			r.NoError(serve(context.TODO(), rootLog, false))
+
+			check(t)
+		}
+	}
+	t.Run("memory", run(repo.NewMemory()))
+	t.Run("badger", run(repo.New(dir)))
+}
@@ -0,0 +1,37 @@
+package indexes
+
+import (
+	"github.com/dgraph-io/badger"
+	"go.cryptoscope.co/librarian"
+
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// keyIterator calls fn for all the keys that start with prefix, in order.
+// The key is only valid until fn returns.
+type keyIterator func(prefix []byte, fn func(key []byte) error) error
+
+func memKeys(pi repo.PrefixIterator) keyIterator {
+	return func(prefix []byte, fn func([]byte) error) error {
+		return pi.IteratePrefix(librarian.Addr(prefix), func(addr librarian.Addr, _ interface{}) error {
+			return fn([]byte(addr))
+		})
+	}
+}
+
+func badgerKeys(db *badger.DB) keyIterator {
+	return func(prefix []byte, fn func([]byte) error) error {
+		return db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			iter := txn.NewIterator(opts)
+			defer iter.Close()
+			for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+				if err := fn(iter.Item().Key()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
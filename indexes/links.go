@@ -0,0 +1,262 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameLinks = "links"
+
+// Link is a reference from the content of a message to a message, feed or blob
+type Link struct {
+	Source *ssb.FeedRef // the author of the linking message
+	Dest   string       // the reference, like %...sha256
+	Rel    string       // the content field the reference was found in, like root, vote or mentions
+	Seq    margaret.Seq // of the linking message in the root log
+}
+
+// LinkQuery selects links. Empty fields match all links.
+// Dest can also be one of the sigils @, % or & to select all links to feeds, messages or blobs.
+type LinkQuery struct {
+	Source *ssb.FeedRef
+	Dest   string
+	Rel    string
+}
+
+// LinkIndex finds the links between messages, feeds and blobs
+type LinkIndex interface {
+	// Links calls fn for every link that matches qry, sorted by destination (or source, if only that is set) and rel.
+	// Links between the same refs come in the order they were received.
+	Links(qry LinkQuery, fn func(Link) error) error
+}
+
+// ContentLink is a reference found in the content of a message
+type ContentLink struct {
+	Rel  string
+	Dest ssb.Ref
+}
+
+// ContentLinks returns all the references in content, which is the content of a message as JSON.
+// The rel of a link is the top-level field it was found in, the same reference is only returned once per rel.
+func ContentLinks(content []byte) []ContentLink {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(content, &obj); err != nil {
+		return nil // encrypted or not an object
+	}
+
+	// sorted, so that the links are in a stable order
+	fields := make([]string, 0, len(obj))
+	for k := range obj {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	var links []ContentLink
+	for _, rel := range fields {
+		if rel == "" || strings.IndexByte(rel, 0) >= 0 {
+			continue // can't be used in keys
+		}
+		seen := make(map[string]bool)
+		walkRefs(obj[rel], func(ref ssb.Ref) {
+			if seen[ref.Ref()] {
+				return
+			}
+			seen[ref.Ref()] = true
+			links = append(links, ContentLink{Rel: rel, Dest: ref})
+		})
+	}
+	return links
+}
+
+func walkRefs(v interface{}, fn func(ssb.Ref)) {
+	switch tv := v.(type) {
+	case string:
+		if len(tv) > 0 && strings.ContainsAny(tv[:1], "@%&") {
+			if ref, err := ssb.ParseRef(tv); err == nil {
+				fn(ref)
+			}
+		}
+	case []interface{}:
+		for _, e := range tv {
+			walkRefs(e, fn)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(tv))
+		for k := range tv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkRefs(tv[k], fn)
+		}
+	}
+}
+
+// every link is stored twice, once for finding it by destination and once by source:
+//
+//	lb:<dest>\x00<rel>\x00<source>\x00<seq>
+//	lf:<source>\x00<rel>\x00<dest>\x00<seq>
+//
+// the sequence is 8 bytes big endian, so that links with the same refs are in receive order
+var (
+	backlinkPrefix = []byte("lb:")
+	fwdlinkPrefix  = []byte("lf:")
+)
+
+func linkKey(prefix []byte, a, rel, b string, seq int64) []byte {
+	var k bytes.Buffer
+	k.Write(prefix)
+	k.WriteString(a)
+	k.WriteByte(0)
+	k.WriteString(rel)
+	k.WriteByte(0)
+	k.WriteString(b)
+	k.WriteByte(0)
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], uint64(seq))
+	k.Write(seqBytes[:])
+	return k.Bytes()
+}
+
+func splitLinkKey(k []byte) (Link, error) {
+	var l Link
+	if len(k) < 3+8 {
+		return l, errors.Errorf("links: invalid key length %d", len(k))
+	}
+	prefix := k[:3]
+	l.Seq = margaret.BaseSeq(binary.BigEndian.Uint64(k[len(k)-8:]))
+	parts := bytes.Split(k[3:len(k)-8], []byte{0})
+	if len(parts) != 4 || len(parts[3]) != 0 {
+		return l, errors.Errorf("links: invalid key")
+	}
+
+	source, dest := parts[0], parts[2]
+	if bytes.Equal(prefix, backlinkPrefix) {
+		source, dest = dest, source
+	}
+	var err error
+	l.Source, err = ssb.ParseFeedRef(string(source))
+	if err != nil {
+		return l, errors.Wrap(err, "links: invalid source in key")
+	}
+	l.Dest = string(dest)
+	l.Rel = string(parts[1])
+	return l, nil
+}
+
+// OpenLinks supplies the link index
+func OpenLinks(r repo.Interface) (LinkIndex, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		idx, _, serve, err := repo.OpenIndex(r, FolderNameLinks, func(idx librarian.Index) librarian.SinkIndex {
+			return librarian.NewSinkIndex(updateLinks, idx.(librarian.SeqSetterIndex))
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "error getting link index")
+		}
+		return linkIndex{memKeys(idx.(repo.PrefixIterator))}, nil, serve, nil
+	}
+
+	db, _, serve, err := repo.OpenBadgerIndex(r, FolderNameLinks, func(db *badger.DB) librarian.SinkIndex {
+		return librarian.NewSinkIndex(updateLinks, libbadger.NewIndex(db, margaret.BaseSeq(0)))
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting link index")
+	}
+	return linkIndex{badgerKeys(db)}, db, serve, nil
+}
+
+func updateLinks(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(message.StoredMessage)
+	if !ok {
+		if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return errors.Errorf("links(%d): wrong msgT: %T", seq.Seq(), val)
+	}
+
+	var value struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(msg.Raw, &value); err != nil {
+		return nil // broken message without links
+	}
+
+	source := msg.Author.Ref()
+	for _, l := range ContentLinks(value.Content) {
+		dest := l.Dest.Ref()
+		err := idx.Set(ctx, librarian.Addr(linkKey(backlinkPrefix, dest, l.Rel, source, seq.Seq())), margaret.BaseSeq(seq.Seq()))
+		if err != nil {
+			return errors.Wrap(err, "links: failed to update index")
+		}
+		err = idx.Set(ctx, librarian.Addr(linkKey(fwdlinkPrefix, source, l.Rel, dest, seq.Seq())), margaret.BaseSeq(seq.Seq()))
+		if err != nil {
+			return errors.Wrap(err, "links: failed to update index")
+		}
+	}
+	return nil
+}
+
+type linkIndex struct {
+	keys keyIterator
+}
+
+func (li linkIndex) Links(qry LinkQuery, fn func(Link) error) error {
+	// pick the longest prefix the query allows
+	var prefix bytes.Buffer
+	switch {
+	case qry.Dest != "":
+		prefix.Write(backlinkPrefix)
+		if len(qry.Dest) == 1 {
+			prefix.WriteString(qry.Dest) // all of one type
+			break
+		}
+		dest, err := ssb.ParseRef(qry.Dest)
+		if err != nil {
+			return errors.Wrap(err, "links: invalid dest")
+		}
+		prefix.WriteString(dest.Ref())
+		prefix.WriteByte(0)
+		if qry.Rel != "" {
+			prefix.WriteString(qry.Rel)
+			prefix.WriteByte(0)
+		}
+	case qry.Source != nil:
+		prefix.Write(fwdlinkPrefix)
+		prefix.WriteString(qry.Source.Ref())
+		prefix.WriteByte(0)
+		if qry.Rel != "" {
+			prefix.WriteString(qry.Rel)
+			prefix.WriteByte(0)
+		}
+	default:
+		prefix.Write(backlinkPrefix)
+	}
+
+	return li.keys(prefix.Bytes(), func(k []byte) error {
+		l, err := splitLinkKey(k)
+		if err != nil {
+			return err
+		}
+		if qry.Rel != "" && l.Rel != qry.Rel {
+			return nil
+		}
+		if qry.Source != nil && l.Source.Ref() != qry.Source.Ref() {
+			return nil
+		}
+		return fn(l)
+	})
+}
@@ -0,0 +1,96 @@
+package indexes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestContentLinks(t *testing.T) {
+	r := require.New(t)
+
+	msgRef := (&ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)}).Ref()
+	feedRef := (&ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)}).Ref()
+	blobRef := (&ssb.BlobRef{Algo: "sha256", Hash: make([]byte, 32)}).Ref()
+
+	content := fmt.Sprintf(`{
+		"type": "post",
+		"text": "hello %s",
+		"root": %q,
+		"branch": [%q, "%%nope.sha256"],
+		"mentions": [{"link": %q, "name": "alice"}, {"link": %q}, {"link": %q}]
+	}`, feedRef, msgRef, msgRef, feedRef, blobRef, feedRef)
+
+	r.Equal([]ContentLink{
+		{Rel: "branch", Dest: &ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)}},
+		{Rel: "mentions", Dest: &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)}},
+		{Rel: "mentions", Dest: &ssb.BlobRef{Algo: "sha256", Hash: make([]byte, 32)}},
+		{Rel: "root", Dest: &ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)}},
+	}, ContentLinks([]byte(content)))
+
+	r.Nil(ContentLinks([]byte(`"boxed.box"`)))
+}
+
+func TestLinks(t *testing.T) {
+	alice := testFeed(1)
+	bob := testFeed(2)
+
+	msgs := []testMsg{
+		{alice, `{"type":"post","text":"hi"}`},
+		{bob, fmt.Sprintf(`{"type":"post","root":%q,"mentions":[{"link":%q}]}`, testKey(0).Ref(), alice.Ref())},
+		{alice, fmt.Sprintf(`{"type":"vote","vote":{"link":%q,"value":1}}`, testKey(1).Ref())},
+		{bob, fmt.Sprintf(`{"type":"post","root":%q,"branch":%q}`, testKey(0).Ref(), testKey(1).Ref())},
+	}
+
+	var idx LinkIndex
+	open := func(rp repo.Interface) (db *badger.DB, serve repo.ServeFunc, err error) {
+		idx, db, serve, err = OpenLinks(rp)
+		return
+	}
+
+	testIndex(t, msgs, open, func(t *testing.T) {
+		r := require.New(t)
+
+		type link struct {
+			source string
+			rel    string
+			dest   string
+			seq    int64
+		}
+		collect := func(qry LinkQuery) []link {
+			var got []link
+			err := idx.Links(qry, func(l Link) error {
+				got = append(got, link{l.Source.Ref(), l.Rel, l.Dest, l.Seq.Seq()})
+				return nil
+			})
+			r.NoError(err)
+			return got
+		}
+
+		r.Equal([]link{
+			{bob.Ref(), "root", testKey(0).Ref(), 1},
+			{bob.Ref(), "root", testKey(0).Ref(), 3},
+		}, collect(LinkQuery{Dest: testKey(0).Ref()}))
+
+		r.Equal([]link{
+			{bob.Ref(), "branch", testKey(1).Ref(), 3},
+		}, collect(LinkQuery{Dest: testKey(1).Ref(), Source: bob}))
+
+		r.Equal([]link{
+			{alice.Ref(), "vote", testKey(1).Ref(), 2},
+		}, collect(LinkQuery{Source: alice}))
+
+		r.Equal([]link{
+			{bob.Ref(), "mentions", alice.Ref(), 1},
+		}, collect(LinkQuery{Dest: "@"}))
+
+		r.Len(collect(LinkQuery{Dest: "%"}), 4)
+		r.Len(collect(LinkQuery{Rel: "root"}), 2)
+		r.Len(collect(LinkQuery{}), 5)
+	})
+}
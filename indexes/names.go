@@ -0,0 +1,170 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameNames = "names"
+
+// NameIndex finds the feeds that were given a name in about messages.
+// Renaming a feed doesn't remove the old name, compare Seq with the claim in the AboutStore to see if it is still current.
+type NameIndex interface {
+	// Names calls fn for every name that starts with prefix, see NormalizeName.
+	// A name with more than one word also matches with the start of every word.
+	Names(prefix string, fn func(NameEntry) error) error
+}
+
+// NameEntry is a name that Author gave to Feed in the message Seq of the root log
+type NameEntry struct {
+	Feed   *ssb.FeedRef
+	Author *ssb.FeedRef
+	Seq    margaret.Seq
+}
+
+// NormalizeName lower-cases name and drops everything but letters and numbers, so that "@Alice B." is found with "aliceb"
+func NormalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+// NameSuffixes returns the normalized name starting at every word of it, these are what the index matches prefixes with
+func NameSuffixes(name string) []string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	var suffixes []string
+	for i := range words {
+		s := NormalizeName(strings.Join(words[i:], ""))
+		if len(s) > maxTokenLen {
+			continue
+		}
+		suffixes = append(suffixes, s)
+	}
+	return suffixes
+}
+
+// the index has one key for every suffix of a name:
+//
+//	n:<suffix>\x00<feed>\x00<author>\x00<seq>
+//
+// the sequence of the about message in the root log is 8 bytes big endian
+var namePrefix = []byte("n:")
+
+func nameKey(suffix, feed, author string, seq int64) []byte {
+	var k bytes.Buffer
+	k.Write(namePrefix)
+	k.WriteString(suffix)
+	k.WriteByte(0)
+	k.WriteString(feed)
+	k.WriteByte(0)
+	k.WriteString(author)
+	k.WriteByte(0)
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], uint64(seq))
+	k.Write(seqBytes[:])
+	return k.Bytes()
+}
+
+type nameIndex struct {
+	keys keyIterator
+}
+
+func (ni nameIndex) Names(prefix string, fn func(NameEntry) error) error {
+	kp := append(append([]byte{}, namePrefix...), NormalizeName(prefix)...)
+	return ni.keys(kp, func(k []byte) error {
+		if len(k) < len(namePrefix)+8 {
+			return errors.Errorf("names: invalid key length %d", len(k))
+		}
+		seq := int64(binary.BigEndian.Uint64(k[len(k)-8:]))
+		parts := bytes.Split(k[len(namePrefix):len(k)-8], []byte{0})
+		if len(parts) != 4 {
+			return errors.Errorf("names: invalid key")
+		}
+		feed, err := ssb.ParseFeedRef(string(parts[1]))
+		if err != nil {
+			return errors.Wrap(err, "names: invalid feed in key")
+		}
+		author, err := ssb.ParseFeedRef(string(parts[2]))
+		if err != nil {
+			return errors.Wrap(err, "names: invalid author in key")
+		}
+		return fn(NameEntry{Feed: feed, Author: author, Seq: margaret.BaseSeq(seq)})
+	})
+}
+
+// OpenNames supplies the name index
+func OpenNames(r repo.Interface) (NameIndex, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		idx, _, serve, err := repo.OpenIndex(r, FolderNameNames, func(idx librarian.Index) librarian.SinkIndex {
+			return librarian.NewSinkIndex(updateNames, idx.(librarian.SeqSetterIndex))
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "error getting names index")
+		}
+		return nameIndex{memKeys(idx.(repo.PrefixIterator))}, nil, serve, nil
+	}
+
+	db, _, serve, err := repo.OpenBadgerIndex(r, FolderNameNames, func(db *badger.DB) librarian.SinkIndex {
+		return librarian.NewSinkIndex(updateNames, libbadger.NewIndex(db, margaret.BaseSeq(0)))
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting names index")
+	}
+	return nameIndex{badgerKeys(db)}, db, serve, nil
+}
+
+func updateNames(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(message.StoredMessage)
+	if !ok {
+		if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return errors.Errorf("names(%d): wrong msgT: %T", seq.Seq(), val)
+	}
+
+	var value struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(msg.Raw, &value); err != nil {
+		return nil // undecodable messages don't name anyone
+	}
+	target, attrs, err := AboutAttributes(value.Content)
+	if err != nil {
+		return nil // not an about message
+	}
+	feed, ok := target.(*ssb.FeedRef)
+	if !ok {
+		return nil // only feeds are looked up by name
+	}
+	var name string
+	if err := json.Unmarshal(attrs["name"], &name); err != nil {
+		return nil
+	}
+
+	for _, s := range NameSuffixes(name) {
+		err := idx.Set(ctx, librarian.Addr(nameKey(s, feed.Ref(), msg.Author.Ref(), seq.Seq())), margaret.BaseSeq(seq.Seq()))
+		if err != nil {
+			return errors.Wrap(err, "names: failed to update index")
+		}
+	}
+	return nil
+}
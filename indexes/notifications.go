@@ -0,0 +1,274 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/private"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameNotifications = "notifications"
+
+// the kinds of notifications
+const (
+	NotifyReply   = "reply"   // in the thread of one of our messages
+	NotifyMention = "mention" // of our feed in content.mentions
+	NotifyVote    = "vote"    // on one of our messages, only positive ones
+	NotifyFollow  = "follow"  // of our feed
+	NotifyPrivate = "private" // a message we can decrypt
+)
+
+// the order of the kinds is the bit they have in the index
+var notifyKinds = []string{NotifyReply, NotifyMention, NotifyVote, NotifyFollow, NotifyPrivate}
+
+// Notification is a message of another feed that concerns us
+type Notification struct {
+	Seq    int64           `json:"seq"` // of the message in the root log
+	Kinds  []string        `json:"kinds"`
+	Target *ssb.MessageRef `json:"target,omitempty"` // our message that was replied to or voted on
+}
+
+// NotificationIndex holds the notifications of one feed
+type NotificationIndex interface {
+	// Notifications calls fn for every notification with a root log sequence higher than after, in the order they were received
+	Notifications(after int64, fn func(Notification) error) error
+
+	// Changes gets a Notification for every new entry of the index
+	Changes() luigi.Broadcast
+}
+
+// the index remembers the keys of our own messages, to find replies and votes on them,
+// and has one entry for every notification:
+//
+//	nm:<message>
+//	nn:<seq><kinds><target>
+//
+// the sequence is 8 bytes big endian, so that the notifications are in receive order.
+// kinds is a byte with a bit set for each kind, target might be empty.
+var (
+	notifyMinePrefix  = []byte("nm:")
+	notifyEntryPrefix = []byte("nn:")
+)
+
+func notifyEntryKey(n Notification) []byte {
+	var k bytes.Buffer
+	k.Write(notifyEntryPrefix)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], uint64(n.Seq))
+	k.Write(seq[:])
+	var kinds byte
+	for _, kind := range n.Kinds {
+		for i, nk := range notifyKinds {
+			if kind == nk {
+				kinds |= 1 << uint(i)
+			}
+		}
+	}
+	k.WriteByte(kinds)
+	if n.Target != nil {
+		k.WriteString(n.Target.Ref())
+	}
+	return k.Bytes()
+}
+
+func parseNotifyEntryKey(k []byte) (Notification, error) {
+	k = k[len(notifyEntryPrefix):]
+	if len(k) < 9 {
+		return Notification{}, errors.Errorf("notifications: invalid key length %d", len(k))
+	}
+	n := Notification{Seq: int64(binary.BigEndian.Uint64(k))}
+	for i, kind := range notifyKinds {
+		if k[8]&(1<<uint(i)) != 0 {
+			n.Kinds = append(n.Kinds, kind)
+		}
+	}
+	if len(k) > 9 {
+		var err error
+		n.Target, err = ssb.ParseMessageRef(string(k[9:]))
+		if err != nil {
+			return Notification{}, errors.Wrap(err, "notifications: invalid target in key")
+		}
+	}
+	return n, nil
+}
+
+type notificationIndex struct {
+	self *ssb.KeyPair
+	keys keyIterator
+
+	sink  luigi.Sink
+	bcast luigi.Broadcast
+}
+
+func (ni *notificationIndex) Notifications(after int64, fn func(Notification) error) error {
+	err := ni.keys(notifyEntryPrefix, func(k []byte) error {
+		n, err := parseNotifyEntryKey(k)
+		if err != nil {
+			return err
+		}
+		if n.Seq <= after {
+			return nil
+		}
+		return fn(n)
+	})
+	return errors.Wrap(err, "notifications: lookup failed")
+}
+
+func (ni *notificationIndex) Changes() luigi.Broadcast {
+	return ni.bcast
+}
+
+// mine returns true if we wrote the message with the key ref
+func (ni *notificationIndex) mine(ref *ssb.MessageRef) (bool, error) {
+	key := append(append([]byte{}, notifyMinePrefix...), ref.Ref()...)
+	var found bool
+	err := ni.keys(key, func(k []byte) error {
+		found = found || bytes.Equal(k, key)
+		return nil
+	})
+	return found, err
+}
+
+// OpenNotifications supplies the index of the notifications of kp, it needs the keypair to decrypt private messages
+func OpenNotifications(r repo.Interface, kp *ssb.KeyPair) (NotificationIndex, *badger.DB, repo.ServeFunc, error) {
+	ni := &notificationIndex{self: kp}
+	ni.sink, ni.bcast = luigi.NewBroadcast()
+
+	if repo.IsMemory(r) {
+		_, _, serve, err := repo.OpenIndex(r, FolderNameNotifications, func(idx librarian.Index) librarian.SinkIndex {
+			ni.keys = memKeys(idx.(repo.PrefixIterator))
+			return librarian.NewSinkIndex(ni.update, idx.(librarian.SeqSetterIndex))
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "error getting notification index")
+		}
+		return ni, nil, serve, nil
+	}
+
+	db, _, serve, err := repo.OpenBadgerIndex(r, FolderNameNotifications, func(db *badger.DB) librarian.SinkIndex {
+		ni.keys = badgerKeys(db)
+		return librarian.NewSinkIndex(ni.update, libbadger.NewIndex(db, margaret.BaseSeq(0)))
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting notification index")
+	}
+	return ni, db, serve, nil
+}
+
+func (ni *notificationIndex) update(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(message.StoredMessage)
+	if !ok {
+		if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return errors.Errorf("notifications(%d): wrong msgT: %T", seq.Seq(), val)
+	}
+
+	if msg.Author.Ref() == ni.self.Id.Ref() {
+		addr := librarian.Addr(append(append([]byte{}, notifyMinePrefix...), msg.Key.Ref()...))
+		err := idx.Set(ctx, addr, margaret.BaseSeq(seq.Seq()))
+		return errors.Wrap(err, "notifications: failed to update index")
+	}
+
+	n, err := ni.classify(msg)
+	if err != nil {
+		return errors.Wrapf(err, "notifications(%d): failed to check message", seq.Seq())
+	}
+	if n == nil {
+		return nil
+	}
+	n.Seq = seq.Seq()
+
+	if err := idx.Set(ctx, librarian.Addr(notifyEntryKey(*n)), margaret.BaseSeq(seq.Seq())); err != nil {
+		return errors.Wrap(err, "notifications: failed to update index")
+	}
+	return errors.Wrap(ni.sink.Pour(ctx, *n), "notifications: failed to send update")
+}
+
+// classify returns the notification msg is for us, nil if it isn't one
+func (ni *notificationIndex) classify(msg message.StoredMessage) (*Notification, error) {
+	var value struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(msg.Raw, &value); err != nil {
+		return nil, nil
+	}
+
+	var n Notification
+	content := []byte(value.Content)
+	var boxed string
+	if err := json.Unmarshal(value.Content, &boxed); err == nil {
+		content, err = private.Unbox(ni.self, boxed)
+		if err != nil {
+			return nil, nil // not for us
+		}
+		n.Kinds = append(n.Kinds, NotifyPrivate)
+	}
+
+	// replies name the thread in content.root, that tangle has no name
+	wrapped := append(append([]byte(`{"content":`), content...), '}')
+	for _, tl := range multilogs.TangleLinks(wrapped) {
+		if tl.Name != "" {
+			continue
+		}
+		mine, err := ni.mine(tl.Root)
+		if err != nil {
+			return nil, err
+		}
+		if mine {
+			n.Kinds = append(n.Kinds, NotifyReply)
+			n.Target = tl.Root
+		}
+	}
+
+	for _, l := range ContentLinks(content) {
+		if l.Rel == "mentions" && l.Dest.Ref() == ni.self.Id.Ref() {
+			n.Kinds = append(n.Kinds, NotifyMention)
+			break
+		}
+	}
+
+	if vote, err := ParseVote(content); err == nil && vote.Value > 0 {
+		mine, err := ni.mine(vote.Link)
+		if err != nil {
+			return nil, err
+		}
+		if mine {
+			n.Kinds = append(n.Kinds, NotifyVote)
+			n.Target = vote.Link
+		}
+	}
+
+	var contact ssb.Contact
+	if err := json.Unmarshal(content, &contact); err == nil && contact.Following && contact.Contact.Ref() == ni.self.Id.Ref() {
+		n.Kinds = append(n.Kinds, NotifyFollow)
+	}
+
+	if len(n.Kinds) == 0 {
+		return nil, nil
+	}
+	// the index stores them in this order
+	var sorted []string
+	for _, kind := range notifyKinds {
+		for _, k := range n.Kinds {
+			if k == kind {
+				sorted = append(sorted, kind)
+			}
+		}
+	}
+	n.Kinds = sorted
+	return &n, nil
+}
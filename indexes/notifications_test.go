@@ -0,0 +1,99 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/luigi"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/private"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestNotifications(t *testing.T) {
+	r := require.New(t)
+
+	// real keys, private messages need to be encrypted for them
+	keyPair := func(b byte) *ssb.KeyPair {
+		kp, err := ssb.NewKeyPair(bytes.NewReader(bytes.Repeat([]byte{b}, 64)))
+		r.NoError(err)
+		return kp
+	}
+	self := keyPair(1)
+	alice := keyPair(2).Id
+	bob := keyPair(3).Id
+
+	boxed := func(content string, rcpts ...*ssb.FeedRef) string {
+		box, err := private.Box([]byte(content), rcpts...)
+		r.NoError(err)
+		return fmt.Sprintf("%q", box)
+	}
+
+	msgs := []testMsg{
+		{self.Id, `{"type":"post","text":"hello"}`},
+		{alice, fmt.Sprintf(`{"type":"post","root":%q}`, testKey(0).Ref())},
+		{alice, fmt.Sprintf(`{"type":"post","mentions":[{"link":%q,"name":"me"}]}`, self.Id.Ref())},
+		{bob, fmt.Sprintf(`{"type":"vote","vote":{"link":%q,"value":1}}`, testKey(0).Ref())},
+		{bob, fmt.Sprintf(`{"type":"vote","vote":{"link":%q,"value":0}}`, testKey(0).Ref())},
+		{bob, fmt.Sprintf(`{"type":"contact","contact":%q,"following":true}`, self.Id.Ref())},
+		{bob, fmt.Sprintf(`{"type":"contact","contact":%q,"following":false}`, self.Id.Ref())},
+		{alice, boxed(fmt.Sprintf(`{"type":"post","root":%q}`, testKey(0).Ref()), self.Id, alice)},
+		{alice, boxed(`{"type":"post","text":"not for you"}`, alice, bob)},
+		{self.Id, fmt.Sprintf(`{"type":"post","mentions":[{"link":%q}]}`, self.Id.Ref())},
+		{alice, fmt.Sprintf(`{"type":"post","root":%q,"mentions":[{"link":%q}]}`, testKey(1).Ref(), bob.Ref())},
+	}
+
+	var (
+		idx     NotificationIndex
+		changes []Notification
+		cancel  func()
+	)
+	open := func(rp repo.Interface) (db *badger.DB, serve repo.ServeFunc, err error) {
+		idx, db, serve, err = OpenNotifications(rp, self)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the changes are sent while the index is served
+		changes = nil
+		cancel = idx.Changes().Register(luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+			if err == nil {
+				changes = append(changes, v.(Notification))
+			}
+			return nil
+		}))
+		return db, serve, nil
+	}
+
+	testIndex(t, msgs, open, func(t *testing.T) {
+		r := require.New(t)
+		defer cancel()
+
+		want := []Notification{
+			{Seq: 1, Kinds: []string{NotifyReply}, Target: testKey(0)},
+			{Seq: 2, Kinds: []string{NotifyMention}},
+			{Seq: 3, Kinds: []string{NotifyVote}, Target: testKey(0)},
+			{Seq: 5, Kinds: []string{NotifyFollow}},
+			{Seq: 7, Kinds: []string{NotifyReply, NotifyPrivate}, Target: testKey(0)},
+		}
+		r.Equal(want, changes)
+
+		var got []Notification
+		r.NoError(idx.Notifications(-1, func(n Notification) error {
+			got = append(got, n)
+			return nil
+		}))
+		r.Equal(want, got)
+
+		got = nil
+		r.NoError(idx.Notifications(3, func(n Notification) error {
+			got = append(got, n)
+			return nil
+		}))
+		r.Equal(want[3:], got)
+	})
+}
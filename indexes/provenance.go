@@ -0,0 +1,89 @@
+package indexes
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameProvenance = "provenance"
+
+// Provenance says where a message came from
+type Provenance struct {
+	From     *ssb.FeedRef // the peer that sent it to us
+	Received time.Time
+}
+
+// MarshalBinary encodes the receive time in milliseconds (8 bytes, big endian) followed by the ref of the peer
+func (p Provenance) MarshalBinary() ([]byte, error) {
+	if p.From == nil {
+		return nil, errors.Errorf("provenance: no peer")
+	}
+	ref := p.From.Ref()
+	b := make([]byte, 8+len(ref))
+	binary.BigEndian.PutUint64(b, uint64(p.Received.UnixNano()/1000000))
+	copy(b[8:], ref)
+	return b, nil
+}
+
+func (p *Provenance) UnmarshalBinary(b []byte) error {
+	if len(b) < 8 {
+		return errors.Errorf("provenance: value too short (%d bytes)", len(b))
+	}
+	ms := int64(binary.BigEndian.Uint64(b))
+	from, err := ssb.ParseFeedRef(string(b[8:]))
+	if err != nil {
+		return errors.Wrap(err, "provenance: invalid peer")
+	}
+	p.From = from
+	p.Received = time.Unix(ms/1000, (ms%1000)*1000000)
+	return nil
+}
+
+// OpenProvenance supplies the msgRef -> Provenance index.
+// Only messages that came from another peer are in it.
+func OpenProvenance(r repo.Interface) (librarian.Index, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		return repo.OpenIndex(r, FolderNameProvenance, func(idx librarian.Index) librarian.SinkIndex {
+			return provenanceSink(idx.(librarian.SeqSetterIndex))
+		})
+	}
+
+	db, sinkIdx, serve, err := repo.OpenBadgerIndex(r, FolderNameProvenance, func(db *badger.DB) librarian.SinkIndex {
+		return provenanceSink(libbadger.NewIndex(db, Provenance{}))
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting provenance index")
+	}
+	return sinkIdx, db, serve, nil
+}
+
+func provenanceSink(idx librarian.SeqSetterIndex) librarian.SinkIndex {
+	return librarian.NewSinkIndex(func(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+		msg, ok := val.(message.StoredMessage)
+		if !ok {
+			if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+				return nil
+			}
+			return errors.Errorf("provenance(%d): wrong msgT: %T", seq.Seq(), val)
+		}
+		if msg.ReceivedFrom == nil {
+			return nil
+		}
+		err := idx.Set(ctx, librarian.Addr(msg.Key.Hash), Provenance{
+			From:     msg.ReceivedFrom,
+			Received: msg.Timestamp,
+		})
+		return errors.Wrap(err, "provenance: failed to update index")
+	}, idx)
+}
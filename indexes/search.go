@@ -0,0 +1,243 @@
+package indexes
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameSearch = "search"
+
+// SearchIndex finds posts and about descriptions by the words in them
+type SearchIndex interface {
+	// Search returns the messages that contain all the terms, best matches first.
+	// Every term also matches longer words that start with it, but those count less.
+	Search(terms []string) ([]SearchResult, error)
+}
+
+// SearchResult is a message that matched a search
+type SearchResult struct {
+	Seq   margaret.Seq // in the root log
+	Score float64
+}
+
+const (
+	minTokenLen = 2  // in runes
+	maxTokenLen = 64 // in bytes, longer ones are dropped
+)
+
+// SearchTokens splits text into lower-case words, like the search index does
+func SearchTokens(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	tokens := words[:0]
+	for _, w := range words {
+		if len(w) > maxTokenLen || len([]rune(w)) < minTokenLen {
+			continue
+		}
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
+
+// searchText returns the indexed text of a message, the text of posts and the description of abouts
+func searchText(raw []byte) string {
+	var value struct {
+		Content struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			Description string `json:"description"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "" // boxed messages stay out of the search
+	}
+	switch value.Content.Type {
+	case "post":
+		return value.Content.Text
+	case "about":
+		return value.Content.Description
+	}
+	return ""
+}
+
+// the index has one key for every word in a message and one for the message itself:
+//
+//	t:<token>\x00<seq><count>
+//	d:<seq>
+//
+// the sequence is 8 bytes big endian and the count one byte, words that appear more often count as 255
+var (
+	tokenPrefix = []byte("t:")
+	docPrefix   = []byte("d:")
+)
+
+func tokenKey(token string, seq int64, count int) []byte {
+	k := make([]byte, 0, len(tokenPrefix)+len(token)+1+8+1)
+	k = append(k, tokenPrefix...)
+	k = append(k, token...)
+	k = append(k, 0)
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], uint64(seq))
+	k = append(k, seqBytes[:]...)
+	if count > math.MaxUint8 {
+		count = math.MaxUint8
+	}
+	return append(k, byte(count))
+}
+
+func splitTokenKey(k []byte) (string, int64, int, error) {
+	if len(k) < len(tokenPrefix)+1+8+1 {
+		return "", 0, 0, errors.Errorf("search: invalid key length %d", len(k))
+	}
+	token := k[len(tokenPrefix) : len(k)-8-2]
+	if k[len(k)-8-2] != 0 {
+		return "", 0, 0, errors.Errorf("search: invalid key")
+	}
+	seq := int64(binary.BigEndian.Uint64(k[len(k)-8-1:]))
+	return string(token), seq, int(k[len(k)-1]), nil
+}
+
+func docKey(seq int64) []byte {
+	k := make([]byte, len(docPrefix)+8)
+	copy(k, docPrefix)
+	binary.BigEndian.PutUint64(k[len(docPrefix):], uint64(seq))
+	return k
+}
+
+// OpenSearch supplies the search index
+func OpenSearch(r repo.Interface) (SearchIndex, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		idx, _, serve, err := repo.OpenIndex(r, FolderNameSearch, func(idx librarian.Index) librarian.SinkIndex {
+			return librarian.NewSinkIndex(updateSearch, idx.(librarian.SeqSetterIndex))
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "error getting search index")
+		}
+		return searchIndex{memKeys(idx.(repo.PrefixIterator))}, nil, serve, nil
+	}
+
+	db, _, serve, err := repo.OpenBadgerIndex(r, FolderNameSearch, func(db *badger.DB) librarian.SinkIndex {
+		return librarian.NewSinkIndex(updateSearch, libbadger.NewIndex(db, margaret.BaseSeq(0)))
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting search index")
+	}
+	return searchIndex{badgerKeys(db)}, db, serve, nil
+}
+
+func updateSearch(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(message.StoredMessage)
+	if !ok {
+		if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return errors.Errorf("search(%d): wrong msgT: %T", seq.Seq(), val)
+	}
+
+	tokens := SearchTokens(searchText(msg.Raw))
+	if len(tokens) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, t := range tokens {
+		counts[t]++
+	}
+
+	for t, n := range counts {
+		err := idx.Set(ctx, librarian.Addr(tokenKey(t, seq.Seq(), n)), margaret.BaseSeq(seq.Seq()))
+		if err != nil {
+			return errors.Wrap(err, "search: failed to update index")
+		}
+	}
+	err := idx.Set(ctx, librarian.Addr(docKey(seq.Seq())), margaret.BaseSeq(len(tokens)))
+	return errors.Wrap(err, "search: failed to update index")
+}
+
+type searchIndex struct {
+	keys keyIterator
+}
+
+// prefixWeight is how much a word counts that only starts with a term
+const prefixWeight = 0.5
+
+func (si searchIndex) Search(terms []string) ([]SearchResult, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var docs int
+	err := si.keys(docPrefix, func([]byte) error {
+		docs++
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "search: failed to count documents")
+	}
+
+	// tf-idf, summed over the terms
+	var scores map[int64]float64
+	for _, term := range terms {
+		matches := make(map[int64]float64)
+		err := si.keys(append(append([]byte{}, tokenPrefix...), term...), func(k []byte) error {
+			token, seq, count, err := splitTokenKey(k)
+			if err != nil {
+				return err
+			}
+			tf := float64(count) / float64(count+1)
+			if token != term {
+				tf *= prefixWeight
+			}
+			if tf > matches[seq] {
+				matches[seq] = tf
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "search: failed to look up %q", term)
+		}
+
+		idf := math.Log(1 + float64(docs)/float64(len(matches)+1))
+		if scores == nil {
+			scores = make(map[int64]float64, len(matches))
+			for seq, tf := range matches {
+				scores[seq] = tf * idf
+			}
+			continue
+		}
+		for seq, score := range scores {
+			tf, ok := matches[seq]
+			if !ok {
+				delete(scores, seq) // all terms have to match
+				continue
+			}
+			scores[seq] = score + tf*idf
+		}
+	}
+
+	res := make([]SearchResult, 0, len(scores))
+	for seq, score := range scores {
+		res = append(res, SearchResult{Seq: margaret.BaseSeq(seq), Score: score})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Seq.Seq() > res[j].Seq.Seq() // newer ones first
+	})
+	return res, nil
+}
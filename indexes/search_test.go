@@ -0,0 +1,59 @@
+package indexes
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestSearchTokens(t *testing.T) {
+	r := require.New(t)
+	r.Equal([]string{"hello", "wörld", "go", "1234"}, SearchTokens("Hello, Wörld! a go-1234 #"))
+	r.Empty(SearchTokens(""))
+}
+
+func TestSearch(t *testing.T) {
+	var msgs []testMsg
+	for _, c := range []string{
+		`{"type":"post","text":"gardening in the spring"}`,
+		`{"type":"post","text":"the garden garden garden is green"}`,
+		`{"type":"vote","vote":{"expression":"garden"}}`,
+		`{"type":"about","about":"@x","description":"i like my garden and go"}`,
+		`"secret garden.box"`,
+		`{"type":"post","text":"learning go"}`,
+	} {
+		msgs = append(msgs, testMsg{testFeed(1), c})
+	}
+
+	var idx SearchIndex
+	open := func(rp repo.Interface) (db *badger.DB, serve repo.ServeFunc, err error) {
+		idx, db, serve, err = OpenSearch(rp)
+		return
+	}
+
+	testIndex(t, msgs, open, func(t *testing.T) {
+		r := require.New(t)
+
+		search := func(q string) []int64 {
+			res, err := idx.Search(SearchTokens(q))
+			r.NoError(err)
+			var seqs []int64
+			for _, sr := range res {
+				seqs = append(seqs, sr.Seq.Seq())
+			}
+			return seqs
+		}
+
+		// more mentions rank higher, prefix matches lower
+		r.Equal([]int64{1, 3, 0}, search("garden"))
+		r.Equal([]int64{1, 3, 0}, search("Gard"))
+		r.Equal([]int64{1}, search("GARDEN green"))
+		r.Equal([]int64{3}, search("garden go"))
+		r.Equal([]int64{5, 3}, search("go"))
+		r.Empty(search("spring garden green"))
+		r.Empty(search("secret"))
+	})
+}
@@ -0,0 +1,288 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameTimestamps = "timestamps"
+
+// TimestampIndex orders the messages by the timestamp their authors claim
+type TimestampIndex interface {
+	// Entries returns the entries that match qry, in order. qry.Limit caps how many.
+	// If from is not nil, the entries up to and including it are skipped, to continue after a previous batch.
+	// Use IterateTimestamps to go through all of them.
+	Entries(qry TimestampQuery, from *TimestampEntry) ([]TimestampEntry, error)
+
+	// Seq returns the sequence of the root log up to which the index is updated, -1 if it's empty
+	Seq() (int64, error)
+}
+
+// TimestampQuery selects a range of the timestamp index
+type TimestampQuery struct {
+	Gt, Lt  int64 // exclusive bounds in milliseconds, 0 for none
+	Reverse bool
+	Limit   int // negative for all of them
+}
+
+// TimestampEntry is a message in the timestamp index
+type TimestampEntry struct {
+	TS  int64 // in milliseconds
+	Seq margaret.BaseSeq
+}
+
+// before returns true if e comes before o in the order of the index
+func (e TimestampEntry) before(o TimestampEntry, reverse bool) bool {
+	less := e.TS < o.TS || (e.TS == o.TS && e.Seq < o.Seq)
+	if reverse {
+		return !less && e != o
+	}
+	return less
+}
+
+// timestampBatchSize is the number of entries IterateTimestamps reads at once
+var timestampBatchSize = 256
+
+// IterateTimestamps calls fn with the timestamp and the root log sequence of the messages in idx that match qry, in order.
+// The entries are read in batches and fn is only called between them,
+// so that slow callers (like a stream to a peer) don't keep the index busy.
+func IterateTimestamps(idx TimestampIndex, qry TimestampQuery, fn func(ts int64, seq margaret.Seq) error) error {
+	var (
+		from *TimestampEntry
+		sent int
+	)
+	for {
+		bqry := qry
+		bqry.Limit = timestampBatchSize
+		if qry.Limit >= 0 && qry.Limit-sent < bqry.Limit {
+			bqry.Limit = qry.Limit - sent
+		}
+		if bqry.Limit == 0 {
+			return nil
+		}
+
+		batch, err := idx.Entries(bqry, from)
+		if err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if err := fn(e.TS, e.Seq); err != nil {
+				return err
+			}
+		}
+		sent += len(batch)
+		if len(batch) < bqry.Limit {
+			return nil
+		}
+		from = &batch[len(batch)-1]
+	}
+}
+
+// Matches returns true if ts is in the range of qry
+func (qry TimestampQuery) Matches(ts int64) bool {
+	if qry.Gt > 0 && ts <= qry.Gt {
+		return false
+	}
+	if qry.Lt > 0 && ts >= qry.Lt {
+		return false
+	}
+	return true
+}
+
+// FeedTimestamp returns the timestamp the author claims for msg in milliseconds.
+// It's never later than the time we received the message,
+// so that messages with timestamps in the future don't stay on top of the feed.
+func FeedTimestamp(msg message.StoredMessage) (int64, error) {
+	var claimed struct {
+		Timestamp float64 `json:"timestamp"`
+	}
+	if err := json.Unmarshal(msg.Raw, &claimed); err != nil {
+		return 0, errors.Wrap(err, "timestamps: failed to decode message")
+	}
+
+	ts := int64(claimed.Timestamp)
+	if rxt := msg.Timestamp.UnixNano() / 1000000; ts > rxt {
+		ts = rxt
+	}
+	if ts < 0 {
+		ts = 0
+	}
+	return ts, nil
+}
+
+var timestampPrefix = []byte("ts:")
+
+// timestampKey sorts by timestamp first and by receive order second
+func timestampKey(ts int64, seq int64) []byte {
+	k := make([]byte, len(timestampPrefix)+16)
+	copy(k, timestampPrefix)
+	binary.BigEndian.PutUint64(k[len(timestampPrefix):], uint64(ts))
+	binary.BigEndian.PutUint64(k[len(timestampPrefix)+8:], uint64(seq))
+	return k
+}
+
+func splitTimestampKey(k []byte) (int64, margaret.BaseSeq, error) {
+	if len(k) != len(timestampPrefix)+16 {
+		return 0, 0, errors.Errorf("timestamps: invalid key length %d", len(k))
+	}
+	k = k[len(timestampPrefix):]
+	return int64(binary.BigEndian.Uint64(k)), margaret.BaseSeq(binary.BigEndian.Uint64(k[8:])), nil
+}
+
+// OpenTimestamps supplies the timestamp index
+func OpenTimestamps(r repo.Interface) (TimestampIndex, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		idx, _, serve, err := repo.OpenIndex(r, FolderNameTimestamps, func(idx librarian.Index) librarian.SinkIndex {
+			return librarian.NewSinkIndex(updateTimestamps, idx.(librarian.SeqSetterIndex))
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "error getting timestamp index")
+		}
+		return memTimestamps{idx.(repo.PrefixIterator), idx.(librarian.SeqSetterIndex)}, nil, serve, nil
+	}
+
+	var seqs librarian.SeqSetterIndex
+	db, _, serve, err := repo.OpenBadgerIndex(r, FolderNameTimestamps, func(db *badger.DB) librarian.SinkIndex {
+		seqs = libbadger.NewIndex(db, margaret.BaseSeq(0))
+		return librarian.NewSinkIndex(updateTimestamps, seqs)
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting timestamp index")
+	}
+	return badgerTimestamps{db, seqs}, db, serve, nil
+}
+
+func updateTimestamps(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(message.StoredMessage)
+	if !ok {
+		if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return errors.Errorf("timestamps(%d): wrong msgT: %T", seq.Seq(), val)
+	}
+
+	ts, err := FeedTimestamp(msg)
+	if err != nil {
+		return nil // nothing to sort it by
+	}
+
+	err = idx.Set(ctx, librarian.Addr(timestampKey(ts, seq.Seq())), margaret.BaseSeq(seq.Seq()))
+	return errors.Wrap(err, "timestamps: failed to update index")
+}
+
+// indexedSeq returns the sequence idx was last updated with, -1 if it wasn't yet
+func indexedSeq(idx librarian.SeqSetterIndex) (int64, error) {
+	seq, err := idx.GetSeq()
+	if err != nil {
+		return 0, errors.Wrap(err, "timestamps: failed to get indexed sequence")
+	}
+	if seq == nil {
+		return -1, nil
+	}
+	return seq.Seq(), nil
+}
+
+type badgerTimestamps struct {
+	db   *badger.DB
+	seqs librarian.SeqSetterIndex
+}
+
+func (ti badgerTimestamps) Seq() (int64, error) { return indexedSeq(ti.seqs) }
+
+func (ti badgerTimestamps) Entries(qry TimestampQuery, from *TimestampEntry) ([]TimestampEntry, error) {
+	var entries []TimestampEntry
+	err := ti.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Reverse = qry.Reverse
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		var start []byte
+		if from != nil {
+			start = timestampKey(from.TS, from.Seq.Seq())
+		} else if qry.Reverse {
+			if qry.Lt > 0 {
+				start = timestampKey(qry.Lt, 0)
+			} else {
+				start = append(append([]byte{}, timestampPrefix...), bytes.Repeat([]byte{0xff}, 16)...)
+			}
+		} else {
+			start = timestampKey(qry.Gt, 0)
+		}
+
+		for iter.Seek(start); iter.ValidForPrefix(timestampPrefix); iter.Next() {
+			ts, seq, err := splitTimestampKey(iter.Item().Key())
+			if err != nil {
+				return err
+			}
+			e := TimestampEntry{TS: ts, Seq: seq}
+			if from != nil && e == *from {
+				continue
+			}
+			if !qry.Matches(ts) {
+				// skip over the bound we started from, stop at the other one
+				if (qry.Reverse && qry.Lt > 0 && ts >= qry.Lt) || (!qry.Reverse && qry.Gt > 0 && ts <= qry.Gt) {
+					continue
+				}
+				return nil
+			}
+			if qry.Limit >= 0 && len(entries) >= qry.Limit {
+				return nil
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+type memTimestamps struct {
+	idx  repo.PrefixIterator
+	seqs librarian.SeqSetterIndex
+}
+
+func (ti memTimestamps) Seq() (int64, error) { return indexedSeq(ti.seqs) }
+
+func (ti memTimestamps) Entries(qry TimestampQuery, from *TimestampEntry) ([]TimestampEntry, error) {
+	var entries []TimestampEntry
+	err := ti.idx.IteratePrefix(librarian.Addr(timestampPrefix), func(addr librarian.Addr, _ interface{}) error {
+		ts, seq, err := splitTimestampKey([]byte(addr))
+		if err != nil {
+			return err
+		}
+		if qry.Matches(ts) {
+			entries = append(entries, TimestampEntry{TS: ts, Seq: seq})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if qry.Reverse {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	if from != nil {
+		for len(entries) > 0 && !from.before(entries[0], qry.Reverse) {
+			entries = entries[1:]
+		}
+	}
+	if qry.Limit >= 0 && len(entries) > qry.Limit {
+		entries = entries[:qry.Limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,96 @@
+package indexes
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestTimestamps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timestamps")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("memory", testTimestamps(repo.NewMemory()))
+	t.Run("badger", testTimestamps(repo.New(dir)))
+}
+
+func testTimestamps(rp repo.Interface) func(*testing.T) {
+	return func(t *testing.T) {
+		r := require.New(t)
+
+		rootLog, err := repo.OpenLog(rp)
+		r.NoError(err)
+
+		rxt := time.Unix(10000, 0)
+		claimed := []int64{
+			5000,
+			3000,
+			99999999999, // from the future, sorts at the receive time
+			1000,
+			3000,
+		}
+		for i, ts := range claimed {
+			_, err := rootLog.Append(message.StoredMessage{
+				Author:    &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+				Key:       &ssb.MessageRef{Algo: "sha256", Hash: []byte(fmt.Sprintf("%032d", i))},
+				Sequence:  margaret.BaseSeq(i + 1),
+				Timestamp: rxt,
+				Raw:       []byte(fmt.Sprintf(`{"sequence":%d,"timestamp":%d,"content":{"type":"test"}}`, i+1, ts)),
+			})
+			r.NoError(err)
+		}
+
+		idx, db, serve, err := OpenTimestamps(rp)
+		r.NoError(err)
+		if db != nil {
+			defer db.Close()
+		}
+		indexed, err := idx.Seq()
+		r.NoError(err)
+		r.EqualValues(-1, indexed)
+
+		r.NoError(serve(context.TODO(), rootLog, false))
+
+		indexed, err = idx.Seq()
+		r.NoError(err)
+		r.EqualValues(len(claimed)-1, indexed)
+
+		type entry struct {
+			ts  int64
+			seq int64
+		}
+		collect := func(qry TimestampQuery) []entry {
+			var got []entry
+			err := IterateTimestamps(idx, qry, func(ts int64, seq margaret.Seq) error {
+				got = append(got, entry{ts, seq.Seq()})
+				return nil
+			})
+			r.NoError(err)
+			return got
+		}
+
+		r.Equal([]entry{{1000, 3}, {3000, 1}, {3000, 4}, {5000, 0}, {10000000, 2}}, collect(TimestampQuery{Limit: -1}))
+		r.Equal([]entry{{10000000, 2}, {5000, 0}, {3000, 4}, {3000, 1}, {1000, 3}}, collect(TimestampQuery{Limit: -1, Reverse: true}))
+		r.Equal([]entry{{3000, 1}, {3000, 4}, {5000, 0}}, collect(TimestampQuery{Gt: 1000, Lt: 10000000, Limit: -1}))
+		r.Equal([]entry{{5000, 0}, {3000, 4}}, collect(TimestampQuery{Gt: 1000, Lt: 10000000, Reverse: true, Limit: 2}))
+		r.Equal([]entry{{1000, 3}}, collect(TimestampQuery{Lt: 3000, Limit: -1}))
+
+		// continuing after a batch works between entries with the same timestamp
+		defer func(n int) { timestampBatchSize = n }(timestampBatchSize)
+		timestampBatchSize = 2
+		r.Equal([]entry{{1000, 3}, {3000, 1}, {3000, 4}, {5000, 0}, {10000000, 2}}, collect(TimestampQuery{Limit: -1}))
+		r.Equal([]entry{{10000000, 2}, {5000, 0}, {3000, 4}, {3000, 1}, {1000, 3}}, collect(TimestampQuery{Limit: -1, Reverse: true}))
+		r.Equal([]entry{{3000, 1}, {3000, 4}, {5000, 0}}, collect(TimestampQuery{Gt: 1000, Lt: 10000000, Limit: 3}))
+	}
+}
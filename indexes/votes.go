@@ -0,0 +1,220 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameVotes = "votes"
+
+// VoteIndex holds the current vote of every feed on a message, later votes replace earlier ones
+type VoteIndex interface {
+	// Votes returns the votes on target, in the order we received them
+	Votes(target *ssb.MessageRef) ([]Vote, error)
+}
+
+// Vote is the latest vote of Voter on a message
+type Vote struct {
+	Voter      *ssb.FeedRef `json:"voter"`
+	Value      int          `json:"value"` // usually 1 (like) or 0 (unlike)
+	Expression string       `json:"expression,omitempty"`
+	Seq        int64        `json:"seq"` // of the vote message in the root log
+}
+
+// VoteSummary counts the votes on a message
+type VoteSummary struct {
+	Target      *ssb.MessageRef `json:"target"`
+	Total       int             `json:"total"`       // votes with a positive value
+	Expressions map[string]int  `json:"expressions"` // the same, by expression
+	Voters      []Vote          `json:"voters"`      // including the ones that took their vote back
+}
+
+// SummarizeVotes counts votes
+func SummarizeVotes(target *ssb.MessageRef, votes []Vote) VoteSummary {
+	sum := VoteSummary{
+		Target:      target,
+		Expressions: make(map[string]int),
+		Voters:      votes,
+	}
+	if sum.Voters == nil {
+		sum.Voters = []Vote{}
+	}
+	for _, v := range votes {
+		if v.Value <= 0 {
+			continue
+		}
+		sum.Total++
+		sum.Expressions[v.Expression]++
+	}
+	return sum
+}
+
+// VoteContent is the vote in the content of a vote message
+type VoteContent struct {
+	Link       *ssb.MessageRef
+	Value      int
+	Expression string
+}
+
+// ParseVote returns the vote in the content of a vote message
+func ParseVote(content []byte) (*VoteContent, error) {
+	var c struct {
+		Type string `json:"type"`
+		Vote struct {
+			Link       string  `json:"link"`
+			Value      float64 `json:"value"`
+			Expression string  `json:"expression"`
+		} `json:"vote"`
+	}
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, errors.Wrap(err, "votes: not an object")
+	}
+	if c.Type != "vote" {
+		return nil, errors.Errorf("votes: wrong type")
+	}
+	link, err := ssb.ParseMessageRef(c.Vote.Link)
+	if err != nil {
+		return nil, errors.Wrap(err, "votes: invalid link")
+	}
+	return &VoteContent{Link: link, Value: int(c.Vote.Value), Expression: c.Vote.Expression}, nil
+}
+
+// the index has one entry for every message and voter:
+//
+//	v:<message>\x00<voter>
+//
+// the value is the root log sequence and the vote value (both 8 bytes, big endian) followed by the expression
+var votePrefix = []byte("v:")
+
+func voteKey(target, voter string) []byte {
+	var k bytes.Buffer
+	k.Write(votePrefix)
+	k.WriteString(target)
+	k.WriteByte(0)
+	k.WriteString(voter)
+	return k.Bytes()
+}
+
+// voteValue is the value of an entry in the index
+type voteValue struct {
+	seq        int64
+	value      int64
+	expression string
+}
+
+var (
+	_ encoding.BinaryMarshaler   = voteValue{}
+	_ encoding.BinaryUnmarshaler = (*voteValue)(nil)
+)
+
+func (vv voteValue) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 16, 16+len(vv.expression))
+	binary.BigEndian.PutUint64(b, uint64(vv.seq))
+	binary.BigEndian.PutUint64(b[8:], uint64(vv.value))
+	return append(b, vv.expression...), nil
+}
+
+func (vv *voteValue) UnmarshalBinary(b []byte) error {
+	if len(b) < 16 {
+		return errors.Errorf("votes: invalid value length %d", len(b))
+	}
+	vv.seq = int64(binary.BigEndian.Uint64(b))
+	vv.value = int64(binary.BigEndian.Uint64(b[8:]))
+	vv.expression = string(b[16:])
+	return nil
+}
+
+type voteIndex struct {
+	iterate func(prefix []byte, fn func(k, v []byte) error) error
+}
+
+func (vi voteIndex) Votes(target *ssb.MessageRef) ([]Vote, error) {
+	prefix := voteKey(target.Ref(), "")
+
+	var votes []Vote
+	err := vi.iterate(prefix, func(k, v []byte) error {
+		voter, err := ssb.ParseFeedRef(string(k[len(prefix):]))
+		if err != nil {
+			return errors.Wrap(err, "votes: invalid voter in key")
+		}
+		var vv voteValue
+		if err := vv.UnmarshalBinary(v); err != nil {
+			return err
+		}
+		votes = append(votes, Vote{
+			Voter:      voter,
+			Value:      int(vv.value),
+			Expression: vv.expression,
+			Seq:        vv.seq,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "votes: lookup failed")
+	}
+	sort.Slice(votes, func(i, j int) bool { return votes[i].Seq < votes[j].Seq })
+	return votes, nil
+}
+
+// OpenVotes supplies the vote index
+func OpenVotes(r repo.Interface) (VoteIndex, *badger.DB, repo.ServeFunc, error) {
+	if repo.IsMemory(r) {
+		idx, _, serve, err := repo.OpenIndex(r, FolderNameVotes, func(idx librarian.Index) librarian.SinkIndex {
+			return librarian.NewSinkIndex(updateVotes, idx.(librarian.SeqSetterIndex))
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "error getting vote index")
+		}
+		return voteIndex{memIterator(idx.(repo.PrefixIterator))}, nil, serve, nil
+	}
+
+	db, _, serve, err := repo.OpenBadgerIndex(r, FolderNameVotes, func(db *badger.DB) librarian.SinkIndex {
+		return librarian.NewSinkIndex(updateVotes, libbadger.NewIndex(db, voteValue{}))
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting vote index")
+	}
+	return voteIndex{badgerIterator(db)}, db, serve, nil
+}
+
+func updateVotes(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(message.StoredMessage)
+	if !ok {
+		if nulled, ok := val.(error); ok && margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return errors.Errorf("votes(%d): wrong msgT: %T", seq.Seq(), val)
+	}
+
+	var value struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(msg.Raw, &value); err != nil {
+		return nil // can't be a vote either
+	}
+	vote, err := ParseVote(value.Content)
+	if err != nil {
+		return nil // not a vote
+	}
+
+	err = idx.Set(ctx, librarian.Addr(voteKey(vote.Link.Ref(), msg.Author.Ref())), voteValue{
+		seq:        seq.Seq(),
+		value:      int64(vote.Value),
+		expression: vote.Expression,
+	})
+	return errors.Wrap(err, "votes: failed to update index")
+}
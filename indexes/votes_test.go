@@ -0,0 +1,54 @@
+package indexes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestVotes(t *testing.T) {
+	alice := testFeed(1)
+	bob := testFeed(2)
+	carla := testFeed(3)
+	post := testKey(100)
+
+	msgs := []testMsg{
+		{alice, fmt.Sprintf(`{"type":"vote","vote":{"link":%q,"value":1,"expression":"Like"}}`, post.Ref())},
+		{bob, fmt.Sprintf(`{"type":"vote","vote":{"link":%q,"value":1,"expression":"Yup"}}`, post.Ref())},
+		{carla, fmt.Sprintf(`{"type":"vote","vote":{"link":%q,"value":1,"expression":"Like"}}`, post.Ref())},
+		{bob, fmt.Sprintf(`{"type":"vote","vote":{"link":%q,"value":0,"expression":"Unlike"}}`, post.Ref())},
+		{alice, `{"type":"vote","vote":{"link":"%nope.sha256","value":1}}`},
+		{alice, fmt.Sprintf(`{"type":"post","vote":{"link":%q,"value":1}}`, post.Ref())},
+	}
+
+	var idx VoteIndex
+	open := func(rp repo.Interface) (db *badger.DB, serve repo.ServeFunc, err error) {
+		idx, db, serve, err = OpenVotes(rp)
+		return
+	}
+
+	testIndex(t, msgs, open, func(t *testing.T) {
+		r := require.New(t)
+
+		votes, err := idx.Votes(post)
+		r.NoError(err)
+		r.Equal([]Vote{
+			{Voter: alice, Value: 1, Expression: "Like", Seq: 0},
+			{Voter: carla, Value: 1, Expression: "Like", Seq: 2},
+			{Voter: bob, Value: 0, Expression: "Unlike", Seq: 3},
+		}, votes)
+
+		sum := SummarizeVotes(post, votes)
+		r.Equal(2, sum.Total)
+		r.Equal(map[string]int{"Like": 2}, sum.Expressions)
+
+		votes, err = idx.Votes(&ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)})
+		r.NoError(err)
+		r.Len(votes, 0)
+	})
+}
@@ -0,0 +1,125 @@
+// Package bloom implements a bloom filter that can be saved to and loaded from disk.
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const magic = "ssb-bloom-v1"
+
+// Filter is a bloom filter for byte keys. It is not safe for concurrent use.
+type Filter struct {
+	bits     []uint64
+	k        uint64 // number of hashes per key
+	capacity uint64 // keys it was sized for
+	count    uint64 // keys that were added
+}
+
+// New returns a filter that is sized for capacity keys with a false-positive rate of fpRate
+func New(capacity uint64, fpRate float64) *Filter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	// the usual formulas for the optimal size and number of hashes
+	m := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Ceil(m / float64(capacity) * math.Ln2)
+	words := (uint64(m) + 63) / 64
+	return &Filter{
+		bits:     make([]uint64, words),
+		k:        uint64(k),
+		capacity: capacity,
+	}
+}
+
+// locations derives the k bit positions of key from two hashes (Kirsch-Mitzenmacher)
+func (f *Filter) locations(key []byte, fn func(uint64) bool) bool {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32
+	m := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < f.k; i++ {
+		if !fn((h1 + i*h2) % m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add inserts key into the filter
+func (f *Filter) Add(key []byte) {
+	f.locations(key, func(loc uint64) bool {
+		f.bits[loc/64] |= 1 << (loc % 64)
+		return true
+	})
+	f.count++
+}
+
+// Has returns false if key was never added. If it returns true, key was probably added.
+func (f *Filter) Has(key []byte) bool {
+	return f.locations(key, func(loc uint64) bool {
+		return f.bits[loc/64]&(1<<(loc%64)) != 0
+	})
+}
+
+// Count returns the number of keys that were added
+func (f *Filter) Count() uint64 { return f.count }
+
+// Capacity returns the number of keys the filter was sized for.
+// The false-positive rate grows beyond the one it was created with once there are more keys.
+func (f *Filter) Capacity() uint64 { return f.capacity }
+
+// WriteTo saves the filter to w
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	hdr := make([]byte, len(magic)+4*8)
+	copy(hdr, magic)
+	for i, v := range []uint64{f.k, f.capacity, f.count, uint64(len(f.bits))} {
+		binary.BigEndian.PutUint64(hdr[len(magic)+i*8:], v)
+	}
+	n, err := w.Write(hdr)
+	if err != nil {
+		return int64(n), errors.Wrap(err, "bloom: failed to write header")
+	}
+	err = binary.Write(w, binary.BigEndian, f.bits)
+	if err != nil {
+		return int64(n), errors.Wrap(err, "bloom: failed to write bits")
+	}
+	return int64(n + 8*len(f.bits)), nil
+}
+
+// Read loads a filter that was saved with WriteTo
+func Read(r io.Reader) (*Filter, error) {
+	hdr := make([]byte, len(magic)+4*8)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, errors.Wrap(err, "bloom: failed to read header")
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return nil, errors.Errorf("bloom: unknown format")
+	}
+	var vals [4]uint64
+	for i := range vals {
+		vals[i] = binary.BigEndian.Uint64(hdr[len(magic)+i*8:])
+	}
+	words := vals[3]
+	if words == 0 || words > 1<<32 || vals[0] == 0 {
+		return nil, errors.Errorf("bloom: invalid header")
+	}
+	f := &Filter{
+		k:        vals[0],
+		capacity: vals[1],
+		count:    vals[2],
+		bits:     make([]uint64, words),
+	}
+	if err := binary.Read(r, binary.BigEndian, f.bits); err != nil {
+		return nil, errors.Wrap(err, "bloom: failed to read bits")
+	}
+	return f, nil
+}
@@ -0,0 +1,43 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	r := require.New(t)
+
+	const n = 10000
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	r.Equal(uint64(n), f.Count())
+
+	for i := 0; i < n; i++ {
+		r.True(f.Has([]byte(fmt.Sprintf("key-%d", i))), "false negative for key %d", i)
+	}
+
+	var fp int
+	for i := 0; i < n; i++ {
+		if f.Has([]byte(fmt.Sprintf("other-%d", i))) {
+			fp++
+		}
+	}
+	r.True(fp < n/50, "too many false positives: %d", fp)
+
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	r.NoError(err)
+
+	loaded, err := Read(&buf)
+	r.NoError(err)
+	r.Equal(f, loaded)
+
+	_, err = Read(bytes.NewReader([]byte("nope")))
+	r.Error(err)
+}
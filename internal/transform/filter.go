@@ -0,0 +1,124 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// Filter selects the stored messages of the log streams by when they were received (gt, gte, lt, lte, receivedAfter and receivedBefore)
+// and who sent them (receivedFrom). It also applies the limit, since the query of a log can't know how many messages are dropped.
+// Nulled entries are skipped.
+type Filter struct {
+	from          *ssb.FeedRef
+	after, before int64
+
+	limit, sent int64
+}
+
+// NewFilter returns the filter for the options of qry
+func NewFilter(qry message.CreateHistArgs) (*Filter, error) {
+	f := &Filter{
+		after:  qry.After(),
+		before: qry.Before(),
+		limit:  qry.Limit,
+	}
+	if qry.ReceivedAfter > f.after {
+		f.after = qry.ReceivedAfter
+	}
+	if qry.ReceivedBefore > 0 && (f.before == 0 || qry.ReceivedBefore < f.before) {
+		f.before = qry.ReceivedBefore
+	}
+	if qry.ReceivedFrom != "" {
+		ref, err := ssb.ParseFeedRef(qry.ReceivedFrom)
+		if err != nil {
+			return nil, errors.Wrap(err, "receivedFrom is not a feed")
+		}
+		f.from = ref
+	}
+	return f, nil
+}
+
+// Done returns true once the limit is reached
+func (f *Filter) Done() bool {
+	return f.limit >= 0 && f.sent >= f.limit
+}
+
+// Source returns the messages of src that match. It ends once the limit is reached.
+// The count for the limit is shared by all the sources of the filter.
+func (f *Filter) Source(src luigi.Source) luigi.Source {
+	return &filteredSource{src: src, f: f}
+}
+
+// Encoder turns a stored message into what a stream sends for it.
+// It returns nil for messages that shouldn't be sent.
+type Encoder func(message.StoredMessage) ([]byte, error)
+
+// Encode is like Source but returns the messages encoded by enc.
+// The ones enc skips don't count for the limit.
+func (f *Filter) Encode(src luigi.Source, enc Encoder) luigi.Source {
+	return &filteredSource{src: src, f: f, enc: enc}
+}
+
+func (f *Filter) matches(msg message.StoredMessage) bool {
+	if f.from != nil && (msg.ReceivedFrom == nil || !bytes.Equal(msg.ReceivedFrom.ID, f.from.ID)) {
+		return false
+	}
+	rxt := msg.Timestamp.UnixNano() / 1000000
+	if f.after > 0 && rxt <= f.after {
+		return false
+	}
+	if f.before > 0 && rxt >= f.before {
+		return false
+	}
+	return true
+}
+
+type filteredSource struct {
+	src luigi.Source
+	f   *Filter
+	enc Encoder
+}
+
+func (fs *filteredSource) Next(ctx context.Context) (interface{}, error) {
+	if fs.f.Done() {
+		return nil, luigi.EOS{}
+	}
+	for {
+		v, err := fs.src.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		msg, ok := v.(message.StoredMessage)
+		if !ok {
+			if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, errors.Errorf("wrong message type. expected %T - got %T", msg, v)
+		}
+		if !fs.f.matches(msg) {
+			continue
+		}
+		if fs.enc == nil {
+			fs.f.sent++
+			return msg, nil
+		}
+
+		b, err := fs.enc(msg)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			continue
+		}
+		fs.f.sent++
+		return b, nil
+	}
+}
@@ -0,0 +1,88 @@
+package transform
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb/message"
+)
+
+// PourLog sends the messages of lg that match qry to the caller, encoded by enc (KeyValueEncoder(qry) if it is nil).
+// The old ones come first (unless old is false), then a sync marker if it was asked for, and the live ones after that.
+// The range bounds and the limit apply to both parts.
+func PourLog(ctx context.Context, req *muxrpc.Request, lg margaret.Log, qry message.CreateHistArgs, enc Encoder) error {
+	filter, err := NewFilter(qry)
+	if err != nil {
+		return errors.Wrap(err, "bad request")
+	}
+	if enc == nil {
+		enc = KeyValueEncoder(qry)
+	}
+
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return err
+		}
+		msg, ok := v.([]byte)
+		if !ok {
+			return errors.Errorf("b4pour: expected []byte - got %T", v)
+		}
+		return req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: msg})
+	})
+
+	// the entry where the live part starts
+	var next int64
+	if qry.WantOld() {
+		src, err := lg.Query(margaret.Reverse(qry.Reverse))
+		if err != nil {
+			return errors.Wrap(err, "failed to query log")
+		}
+		counted := &countingSource{src: src}
+		if err := luigi.Pump(ctx, snk, filter.Encode(counted, enc)); err != nil {
+			return errors.Wrap(err, "failed to pump old messages")
+		}
+		next = counted.n
+	} else {
+		sv, err := lg.Seq().Value()
+		if err != nil {
+			return errors.Wrap(err, "failed to get current sequence")
+		}
+		if seq, ok := sv.(margaret.Seq); ok { // empty sublogs are unset
+			next = seq.Seq() + 1
+		}
+	}
+
+	if !qry.Live || filter.Done() {
+		return nil
+	}
+
+	if qry.Sync && qry.WantOld() {
+		if err := req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: message.SyncMarker}); err != nil {
+			return errors.Wrap(err, "failed to send sync marker")
+		}
+	}
+
+	src, err := lg.Query(margaret.Gte(margaret.BaseSeq(next)), margaret.Live(true))
+	if err != nil {
+		return errors.Wrap(err, "failed to query log")
+	}
+	return errors.Wrap(luigi.Pump(ctx, snk, filter.Encode(src, enc)), "failed to pump live messages")
+}
+
+// countingSource counts the entries it reads, which are all the entries of the log once it's drained
+type countingSource struct {
+	src luigi.Source
+	n   int64
+}
+
+func (cs *countingSource) Next(ctx context.Context) (interface{}, error) {
+	v, err := cs.src.Next(ctx)
+	if err == nil {
+		cs.n++
+	}
+	return v, err
+}
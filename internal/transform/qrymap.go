@@ -19,14 +19,45 @@ func NewKeyValueWrapper(src luigi.Source, wrap bool) luigi.Source {
 		if !wrap {
 			return storedMsg.Raw, nil
 		}
-		var kv message.KeyValueRaw
-		kv.Key = storedMsg.Key
-		kv.Value = storedMsg.Raw
-		kv.Timestamp = storedMsg.Timestamp.UnixNano() / 1000000
-		kvMsg, err := json.Marshal(kv)
-		if err != nil {
-			return nil, errors.Wrapf(err, "rootLog: failed to k:v map message")
+		return keyValue(storedMsg, false)
+	})
+}
+
+// NewProvenanceWrapper wraps the messages like NewKeyValueWrapper and adds the peer that sent them to us
+func NewProvenanceWrapper(src luigi.Source) luigi.Source {
+	return mfr.SourceMap(src, func(ctx context.Context, v interface{}) (interface{}, error) {
+		storedMsg, ok := v.(message.StoredMessage)
+		if !ok {
+			return nil, errors.Errorf("wrong message type. expected %T - got %T", storedMsg, v)
 		}
-		return kvMsg, nil
+		return keyValue(storedMsg, true)
 	})
 }
+
+// KeyValueEncoder encodes the messages like the wrappers above, depending on the keys and provenance options of qry
+func KeyValueEncoder(qry message.CreateHistArgs) Encoder {
+	return func(storedMsg message.StoredMessage) ([]byte, error) {
+		if qry.Provenance {
+			return keyValue(storedMsg, true)
+		}
+		if !qry.Keys {
+			return storedMsg.Raw, nil
+		}
+		return keyValue(storedMsg, false)
+	}
+}
+
+func keyValue(storedMsg message.StoredMessage, provenance bool) ([]byte, error) {
+	var kv message.KeyValueRaw
+	kv.Key = storedMsg.Key
+	kv.Value = storedMsg.Raw
+	kv.Timestamp = storedMsg.Timestamp.UnixNano() / 1000000
+	if provenance {
+		kv.ReceivedFrom = storedMsg.ReceivedFrom
+	}
+	kvMsg, err := json.Marshal(kv)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rootLog: failed to k:v map message")
+	}
+	return kvMsg, nil
+}
@@ -26,7 +26,7 @@ func NewCreateHistArgsFromMap(argMap map[string]interface{}) (*CreateHistArgs, e
 	var qry CreateHistArgs
 	for k, v := range argMap {
 		switch k = strings.ToLower(k); k {
-		case "live", "keys", "values", "reverse":
+		case "live", "keys", "values", "reverse", "provenance", "old", "sync":
 			b, ok := v.(bool)
 			if !ok {
 				return nil, errors.Errorf("ssb/message: not a bool for %s", k)
@@ -40,11 +40,15 @@ func NewCreateHistArgsFromMap(argMap map[string]interface{}) (*CreateHistArgs, e
 				qry.Values = b
 			case "reverse":
 				qry.Reverse = b
+			case "provenance":
+				qry.Provenance = b
+			case "old":
+				qry.Old = &b
+			case "sync":
+				qry.Sync = b
 			}
 
-		case "type":
-			fallthrough
-		case "id":
+		case "type", "id", "receivedfrom":
 			val, ok := v.(string)
 			if !ok {
 				return nil, errors.Errorf("ssb/message: not a string for %s", k)
@@ -54,8 +58,10 @@ func NewCreateHistArgsFromMap(argMap map[string]interface{}) (*CreateHistArgs, e
 				qry.Id = val
 			case "type":
 				qry.Type = val
+			case "receivedfrom":
+				qry.ReceivedFrom = val
 			}
-		case "seq", "limit":
+		case "seq", "limit", "receivedafter", "receivedbefore", "gt", "gte", "lt", "lte":
 			n, ok := v.(float64)
 			if !ok {
 				return nil, errors.Errorf("ssb/message: not a float64(%T) for %s", v, k)
@@ -65,6 +71,18 @@ func NewCreateHistArgsFromMap(argMap map[string]interface{}) (*CreateHistArgs, e
 				qry.Seq = int64(n)
 			case "limit":
 				qry.Limit = int64(n)
+			case "receivedafter":
+				qry.ReceivedAfter = int64(n)
+			case "receivedbefore":
+				qry.ReceivedBefore = int64(n)
+			case "gt":
+				qry.Gt = int64(n)
+			case "gte":
+				qry.Gte = int64(n)
+			case "lt":
+				qry.Lt = int64(n)
+			case "lte":
+				qry.Lte = int64(n)
 			}
 		}
 	}
@@ -85,8 +103,50 @@ type CreateHistArgs struct {
 	Limit   int64  `json:"limit"`
 	Reverse bool   `json:"reverse"`
 	Type    string `json:"type"`
+
+	// the range of timestamps in milliseconds, 0 for no bound.
+	// The log streams use the receive time, createFeedStream the claimed one.
+	Gt  int64 `json:"gt,omitempty"`
+	Gte int64 `json:"gte,omitempty"`
+	Lt  int64 `json:"lt,omitempty"`
+	Lte int64 `json:"lte,omitempty"`
+
+	Old  *bool `json:"old,omitempty"`  // nil is the same as true, see WantOld
+	Sync bool  `json:"sync,omitempty"` // send {sync: true} between old and live messages
+
+	// only used by the log streams
+	ReceivedFrom   string `json:"receivedFrom,omitempty"`   // only messages that this peer sent us
+	ReceivedAfter  int64  `json:"receivedAfter,omitempty"`  // receive time in milliseconds, exclusive
+	ReceivedBefore int64  `json:"receivedBefore,omitempty"` // receive time in milliseconds, exclusive
+	Provenance     bool   `json:"provenance,omitempty"`     // add receivedFrom to the results
+}
+
+// WantOld returns false if only live messages were requested (old: false)
+func (qry CreateHistArgs) WantOld() bool {
+	return qry.Old == nil || *qry.Old
+}
+
+// After returns the exclusive lower bound of the timestamps that are requested with gt or gte, 0 if there is none
+func (qry CreateHistArgs) After() int64 {
+	after := qry.Gt
+	if qry.Gte > 0 && qry.Gte-1 > after {
+		after = qry.Gte - 1
+	}
+	return after
+}
+
+// Before returns the exclusive upper bound of the timestamps that are requested with lt or lte, 0 if there is none
+func (qry CreateHistArgs) Before() int64 {
+	before := qry.Lt
+	if qry.Lte > 0 && (before == 0 || qry.Lte+1 < before) {
+		before = qry.Lte + 1
+	}
+	return before
 }
 
+// SyncMarker is sent between the old and the live messages of a stream if sync was requested
+var SyncMarker = json.RawMessage(`{"sync":true}`)
+
 type RawSignedMessage struct {
 	json.RawMessage
 }
@@ -98,6 +158,8 @@ type StoredMessage struct {
 	Sequence  margaret.BaseSeq
 	Timestamp time.Time
 	Raw       []byte // the original message for gossiping see ssb.EncodePreserveOrdering for why
+
+	ReceivedFrom *ssb.FeedRef // the peer that sent it to us, nil for our own and imported messages
 }
 
 func (sm StoredMessage) String() string {
@@ -185,6 +247,8 @@ type KeyValueRaw struct {
 	Key       *ssb.MessageRef `json:"key"`
 	Value     json.RawMessage `json:"value"`
 	Timestamp int64           `json:"timestamp"`
+
+	ReceivedFrom *ssb.FeedRef `json:"receivedFrom,omitempty"`
 }
 
 type Typed struct {
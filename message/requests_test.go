@@ -0,0 +1,40 @@
+package message
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateHistArgsFromMap(t *testing.T) {
+	r := require.New(t)
+
+	var argMap map[string]interface{}
+	r.NoError(json.Unmarshal([]byte(`{"gt": 100, "lte": 200, "old": false, "sync": true, "live": true}`), &argMap))
+
+	qry, err := NewCreateHistArgsFromMap(argMap)
+	r.NoError(err)
+	r.EqualValues(-1, qry.Limit)
+	r.False(qry.WantOld())
+	r.True(qry.Sync)
+	r.True(qry.Live)
+	r.EqualValues(100, qry.After())
+	r.EqualValues(201, qry.Before())
+
+	// the tighter bound wins
+	qry = &CreateHistArgs{Gt: 100, Gte: 150, Lt: 300, Lte: 250}
+	r.EqualValues(149, qry.After())
+	r.EqualValues(251, qry.Before())
+
+	// old is true unless it's turned off, also when it's sent to other peers
+	qry, err = NewCreateHistArgsFromMap(map[string]interface{}{"limit": float64(5)})
+	r.NoError(err)
+	r.True(qry.WantOld())
+	b, err := json.Marshal(qry)
+	r.NoError(err)
+	r.NotContains(string(b), `"old"`)
+
+	_, err = NewCreateHistArgsFromMap(map[string]interface{}{"old": "no"})
+	r.Error(err)
+}
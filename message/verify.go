@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"io"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.cryptoscope.co/ssb"
@@ -69,3 +70,41 @@ func Verify(raw []byte, hmacSecret *[32]byte) (*ssb.MessageRef, *DeserializedMes
 	}
 	return &mr, &dmsg, nil
 }
+
+// ValidateNext verifies the signature of raw and checks that it continues the feed after current.
+// current is nil if nothing of the feed is stored yet, in which case raw has to be the first message of it.
+// The returned message is ready to be appended to the root log.
+func ValidateNext(current *StoredMessage, raw []byte, hmacSecret *[32]byte) (*StoredMessage, error) {
+	ref, dmsg, err := Verify(raw, hmacSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "validate next: message verify failed")
+	}
+
+	if current == nil {
+		if dmsg.Sequence != 1 {
+			return nil, errors.Errorf("validate next: expected first message of %s but got seq %d", dmsg.Author.Ref(), dmsg.Sequence)
+		}
+	} else {
+		if !bytes.Equal(current.Author.ID, dmsg.Author.ID) {
+			return nil, errors.Errorf("validate next: author mismatch expected:%s incoming:%s", current.Author.Ref(), dmsg.Author.Ref())
+		}
+		if bytes.Compare(current.Key.Hash, dmsg.Previous.Hash) != 0 {
+			return nil, errors.Errorf("validate next: previous compare failed expected:%s incoming:%s",
+				current.Key.Ref(),
+				dmsg.Previous.Ref(),
+			)
+		}
+		if current.Sequence+1 != dmsg.Sequence {
+			return nil, errors.Errorf("validate next: next.seq(%d) != curr.seq(%d)+1", dmsg.Sequence, current.Sequence)
+		}
+	}
+
+	return &StoredMessage{
+		Author:    &dmsg.Author,
+		Previous:  &dmsg.Previous,
+		Key:       ref,
+		Sequence:  dmsg.Sequence,
+		Timestamp: time.Now(),
+		Raw:       raw,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package multilogs
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const IndexNameChannels = "channels"
+
+// channel names need to be shorter than this, in UTF-16 code units like JavaScript strings
+const maxChannelLen = 30
+
+// NormalizeChannel returns the name of a channel like the JS stack does (normalizeChannel in ssb-ref):
+// without whitespace, punctuation and # and lower-cased. It returns false for empty and too long names
+// and for names with NUL bytes, which can't be used in index keys.
+func NormalizeChannel(name string) (string, bool) {
+	if strings.IndexByte(name, 0) >= 0 {
+		return "", false
+	}
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '.', '?', '!', '<', '>', '(', ')', '[', ']', '"', '#':
+			return -1
+		}
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if n := len(utf16.Encode([]rune(name))); n == 0 || n >= maxChannelLen {
+		return "", false
+	}
+	return strings.ToLower(name), true
+}
+
+// MessageChannels returns the normalized channels of a message: content.channel and the #hashtags in content.mentions.
+// The channel messages that (un)subscribe from a channel don't count.
+func MessageChannels(raw []byte) []string {
+	var value struct {
+		Content struct {
+			Type     string          `json:"type"`
+			Channel  string          `json:"channel"`
+			Mentions json.RawMessage `json:"mentions"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil // private messages have a string as content
+	}
+	if value.Content.Type == "channel" {
+		return nil
+	}
+
+	var channels []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if ch, ok := NormalizeChannel(name); ok && !seen[ch] {
+			seen[ch] = true
+			channels = append(channels, ch)
+		}
+	}
+	add(value.Content.Channel)
+
+	// mentions are a list of objects, but some clients send a single one
+	var mentions []struct {
+		Link string `json:"link"`
+	}
+	if err := json.Unmarshal(value.Content.Mentions, &mentions); err != nil {
+		var m struct {
+			Link string `json:"link"`
+		}
+		json.Unmarshal(value.Content.Mentions, &m)
+		mentions = append(mentions, m)
+	}
+	for _, m := range mentions {
+		if strings.HasPrefix(m.Link, "#") {
+			add(m.Link)
+		}
+	}
+	return channels
+}
+
+// OpenChannels opens the multilog with a sublog for every channel, addressed by its normalized name
+func OpenChannels(r repo.Interface) (multilog.MultiLog, *badger.DB, repo.ServeFunc, error) {
+	return repo.OpenMultiLog(r, IndexNameChannels, func(ctx context.Context, seq margaret.Seq, value interface{}, mlog multilog.MultiLog) error {
+		if nulled, ok := value.(error); ok {
+			if margaret.IsErrNulled(nulled) {
+				return nil
+			}
+			return nulled
+		}
+		msg, ok := value.(message.StoredMessage)
+		if !ok {
+			return errors.Errorf("error casting message. got type %T", value)
+		}
+
+		for _, ch := range MessageChannels(msg.Raw) {
+			chLog, err := mlog.Get(librarian.Addr(ch))
+			if err != nil {
+				return errors.Wrap(err, "error opening sublog")
+			}
+			if _, err := chLog.Append(seq); err != nil {
+				return errors.Wrapf(err, "error appending message to channel %q", ch)
+			}
+		}
+		return nil
+	})
+}
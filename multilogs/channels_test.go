@@ -0,0 +1,91 @@
+package multilogs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestNormalizeChannel(t *testing.T) {
+	r := require.New(t)
+
+	for in, want := range map[string]string{
+		"#SSB":          "ssb",
+		"go-ssb":        "go-ssb",
+		" new\tpeople!": "newpeople",
+		"(ünïcode)":     "ünïcode",
+	} {
+		got, ok := NormalizeChannel(in)
+		r.True(ok, in)
+		r.Equal(want, got, in)
+	}
+
+	for _, in := range []string{"", "#", " ?! ", strings.Repeat("x", 30), "go\x00x"} {
+		_, ok := NormalizeChannel(in)
+		r.False(ok, "%q", in)
+	}
+}
+
+func TestChannels(t *testing.T) {
+	r := require.New(t)
+
+	tRepo := repo.NewMemory()
+	tRootLog, err := repo.OpenLog(tRepo)
+	r.NoError(err)
+
+	contents := []string{
+		`{"type":"post","channel":"Go","text":"hi"}`,
+		`{"type":"post","text":"#go #ssb","mentions":[{"link":"#go"},{"link":"#SSB"},{"link":"@nope"}]}`,
+		`{"type":"post","channel":"ssb","mentions":{"link":"#ssb"}}`,
+		`{"type":"channel","channel":"go","subscribed":true}`,
+		`"boxed.box"`,
+	}
+	for i, c := range contents {
+		_, err := tRootLog.Append(message.StoredMessage{
+			Author:    &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+			Key:       &ssb.MessageRef{Algo: ssb.RefAlgoSHA256, Hash: []byte(fmt.Sprintf("%032d", i))},
+			Sequence:  margaret.BaseSeq(i + 1),
+			Timestamp: time.Unix(int64(i), 0),
+			Raw:       []byte(fmt.Sprintf(`{"sequence":%d,"content":%s}`, i+1, c)),
+		})
+		r.NoError(err)
+	}
+
+	r.Equal([]string{"go", "ssb"}, MessageChannels([]byte(fmt.Sprintf(`{"content":%s}`, contents[1]))))
+
+	chans, _, serve, err := OpenChannels(tRepo)
+	r.NoError(err)
+	r.NoError(serve(context.TODO(), tRootLog, false))
+
+	seqs := func(addr librarian.Addr) []int64 {
+		sublog, err := chans.Get(addr)
+		r.NoError(err)
+		src, err := sublog.Query()
+		r.NoError(err)
+		var got []int64
+		for {
+			v, err := src.Next(context.TODO())
+			if err != nil {
+				break
+			}
+			got = append(got, v.(margaret.Seq).Seq())
+		}
+		return got
+	}
+	r.Equal([]int64{0, 1}, seqs("go"))
+	r.Equal([]int64{1, 2}, seqs("ssb"))
+
+	addrs, err := chans.List()
+	r.NoError(err)
+	r.Len(addrs, 2)
+}
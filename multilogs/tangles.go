@@ -3,20 +3,117 @@ package multilogs
 import (
 	"context"
 	"encoding/json"
+	"sort"
 
 	"go.cryptoscope.co/ssb"
 
 	"github.com/dgraph-io/badger"
 	"github.com/pkg/errors"
 	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/ssb/internal/mutil"
 	"go.cryptoscope.co/ssb/message"
 	"go.cryptoscope.co/ssb/repo"
 )
 
 const IndexNameTangles = "tangles"
 
+// TangleLink is the membership of a message in a tangle.
+// Replies name their thread in content.root, that tangle has no name.
+// Named tangles are listed in content.tangles.<name>.{root,previous}.
+type TangleLink struct {
+	Name     string
+	Root     *ssb.MessageRef
+	Previous []*ssb.MessageRef // only set for named tangles
+}
+
+// TangleLinks returns the tangles a message is part of
+func TangleLinks(raw []byte) []TangleLink {
+	var value struct {
+		Content struct {
+			Root    json.RawMessage            `json:"root"`
+			Tangles map[string]json.RawMessage `json:"tangles"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil
+	}
+
+	var links []TangleLink
+	if root := parseMessageRef(value.Content.Root); root != nil {
+		links = append(links, TangleLink{Root: root})
+	}
+
+	// sorted, so that the sublogs are updated in a stable order
+	names := make([]string, 0, len(value.Content.Tangles))
+	for name := range value.Content.Tangles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		var tangle struct {
+			Root     json.RawMessage   `json:"root"`
+			Previous []json.RawMessage `json:"previous"`
+		}
+		if err := json.Unmarshal(value.Content.Tangles[name], &tangle); err != nil {
+			continue
+		}
+		root := parseMessageRef(tangle.Root)
+		if root == nil {
+			continue // the root itself has root: null
+		}
+		l := TangleLink{Name: name, Root: root}
+		for _, p := range tangle.Previous {
+			if ref := parseMessageRef(p); ref != nil {
+				l.Previous = append(l.Previous, ref)
+			}
+		}
+		links = append(links, l)
+	}
+	return links
+}
+
+func parseMessageRef(raw json.RawMessage) *ssb.MessageRef {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil
+	}
+	ref, err := ssb.ParseMessageRef(s)
+	if err != nil {
+		return nil
+	}
+	return ref
+}
+
+// TangleAddr returns the address of a tangle in the tangles multilog.
+// The tangle without a name is stored under the hash of the root, named tangles under name:hash.
+func TangleAddr(name string, root *ssb.MessageRef) librarian.Addr {
+	if name == "" {
+		return librarian.Addr(root.Hash)
+	}
+	return librarian.Addr(name + ":" + string(root.Hash))
+}
+
+// SplitTangleAddr is the inverse of TangleAddr
+func SplitTangleAddr(addr librarian.Addr) (string, *ssb.MessageRef, error) {
+	const hashLen = 32
+	if len(addr) == hashLen {
+		return "", &ssb.MessageRef{Algo: ssb.RefAlgoSHA256, Hash: []byte(addr)}, nil
+	}
+	if len(addr) < hashLen+2 || addr[len(addr)-hashLen-1] != ':' {
+		return "", nil, errors.Errorf("tangles: invalid address %x", []byte(addr))
+	}
+	name := string(addr[:len(addr)-hashLen-1])
+	hash := []byte(addr[len(addr)-hashLen:])
+	return name, &ssb.MessageRef{Algo: ssb.RefAlgoSHA256, Hash: hash}, nil
+}
+
 func OpenTangles(r repo.Interface) (multilog.MultiLog, *badger.DB, repo.ServeFunc, error) {
 	return repo.OpenMultiLog(r, IndexNameTangles, func(ctx context.Context, seq margaret.Seq, msgv interface{}, mlog multilog.MultiLog) error {
 		if nulled, ok := msgv.(error); ok {
@@ -30,26 +127,70 @@ func OpenTangles(r repo.Interface) (multilog.MultiLog, *badger.DB, repo.ServeFun
 			return errors.Errorf("error casting message. got type %T", msgv)
 		}
 
-		var value struct {
-			Content struct {
-				Root *ssb.MessageRef
+		for _, l := range TangleLinks(msg.Raw) {
+			tangleLog, err := mlog.Get(TangleAddr(l.Name, l.Root))
+			if err != nil {
+				return errors.Wrap(err, "error opening sublog")
 			}
-		}
 
-		err := json.Unmarshal(msg.Raw, &value)
-		// TODO: maybe check error with more detail - i.e. only drop type errors
-		if err != nil || value.Content.Root == nil {
-			return nil
+			_, err = tangleLog.Append(seq)
+			if err != nil {
+				return errors.Wrapf(err, "error appending root message: %s", msg.Key.Ref())
+			}
 		}
+		return nil
+	})
+}
+
+// TangleTips returns the messages of a named tangle that no other message in it lists as previous, sorted by their refs.
+// These are what a new message in the tangle puts in previous. An empty tangle has the root as it's only tip.
+func TangleTips(rootLog margaret.Log, tangles multilog.MultiLog, name string, root *ssb.MessageRef) ([]*ssb.MessageRef, error) {
+	sublog, err := tangles.Get(TangleAddr(name, root))
+	if err != nil {
+		return nil, errors.Wrap(err, "tangles: failed to open tangle")
+	}
+	src, err := mutil.Indirect(rootLog, sublog).Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "tangles: failed to query tangle")
+	}
 
-		tangleLog, err := mlog.Get(librarian.Addr(value.Content.Root.Hash))
-		if err != nil {
-			return errors.Wrap(err, "error opening sublog")
+	tips := make(map[string]*ssb.MessageRef)
+	referenced := make(map[string]bool)
+	for {
+		v, err := src.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "tangles: failed to read tangle")
+		}
+		msg, ok := v.(message.StoredMessage)
+		if !ok {
+			if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, errors.Errorf("tangles: wrong message type. expected %T - got %T", msg, v)
 		}
 
-		_, err = tangleLog.Append(seq)
-		// log.Println(msg.Key.Ref(), value.Content.Root.Ref(), seq)
-		return errors.Wrapf(err, "error appending root message: %s", msg.Key.Ref())
-	})
+		tips[msg.Key.Ref()] = msg.Key
+		for _, l := range TangleLinks(msg.Raw) {
+			if l.Name != name || l.Root.Ref() != root.Ref() {
+				continue
+			}
+			for _, p := range l.Previous {
+				referenced[p.Ref()] = true
+			}
+		}
+	}
 
+	var refs []*ssb.MessageRef
+	for k, ref := range tips {
+		if !referenced[k] {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return []*ssb.MessageRef{root}, nil
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Ref() < refs[j].Ref() })
+	return refs, nil
 }
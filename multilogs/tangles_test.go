@@ -2,12 +2,17 @@ package multilogs
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/internal/ctxutils"
+	"go.cryptoscope.co/ssb/message"
 	"go.cryptoscope.co/ssb/repo"
 )
 
@@ -144,3 +149,77 @@ func XTestTangles(t *testing.T) {
 		r.NoError(err, "from chan")
 	}
 }
+
+func TestNamedTangles(t *testing.T) {
+	r := require.New(t)
+
+	tRepo := repo.NewMemory()
+	tRootLog, err := repo.OpenLog(tRepo)
+	r.NoError(err)
+
+	ref := func(i int) *ssb.MessageRef {
+		return &ssb.MessageRef{Algo: ssb.RefAlgoSHA256, Hash: []byte(fmt.Sprintf("%032d", i))}
+	}
+	doc, thread := ref(0), ref(100)
+
+	contents := []string{
+		`{"type":"doc","tangles":{"doc":{"root":null,"previous":null}}}`,
+		fmt.Sprintf(`{"type":"edit","tangles":{"doc":{"root":%q,"previous":[%q]}}}`, doc.Ref(), doc.Ref()),
+		fmt.Sprintf(`{"type":"edit","tangles":{"doc":{"root":%q,"previous":[%q]}}}`, doc.Ref(), ref(1).Ref()),
+		fmt.Sprintf(`{"type":"edit","tangles":{"doc":{"root":%q,"previous":[%q]}}}`, doc.Ref(), ref(1).Ref()),
+		fmt.Sprintf(`{"type":"post","root":%q,"tangles":{"doc":{"root":%q,"previous":[%q,%q]},"":{"root":%q}}}`,
+			thread.Ref(), doc.Ref(), ref(2).Ref(), ref(3).Ref(), doc.Ref()),
+		fmt.Sprintf(`{"type":"post","root":%q}`, thread.Ref()),
+	}
+	for i, c := range contents {
+		_, err := tRootLog.Append(message.StoredMessage{
+			Author:    &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+			Key:       ref(i),
+			Sequence:  margaret.BaseSeq(i + 1),
+			Timestamp: time.Unix(int64(i), 0),
+			Raw:       []byte(fmt.Sprintf(`{"sequence":%d,"content":%s}`, i+1, c)),
+		})
+		r.NoError(err)
+	}
+
+	links := TangleLinks([]byte(fmt.Sprintf(`{"content":%s}`, contents[4])))
+	r.Equal([]TangleLink{
+		{Root: thread},
+		{Name: "doc", Root: doc, Previous: []*ssb.MessageRef{ref(2), ref(3)}},
+	}, links)
+
+	tl, _, serve, err := OpenTangles(tRepo)
+	r.NoError(err)
+	r.NoError(serve(context.TODO(), tRootLog, false))
+
+	seqs := func(addr librarian.Addr) []int64 {
+		sublog, err := tl.Get(addr)
+		r.NoError(err)
+		src, err := sublog.Query()
+		r.NoError(err)
+		var got []int64
+		for {
+			v, err := src.Next(context.TODO())
+			if err != nil {
+				break
+			}
+			got = append(got, v.(margaret.Seq).Seq())
+		}
+		return got
+	}
+	r.Equal([]int64{1, 2, 3, 4}, seqs(TangleAddr("doc", doc)))
+	r.Equal([]int64{4, 5}, seqs(TangleAddr("", thread)))
+
+	name, root, err := SplitTangleAddr(TangleAddr("doc", doc))
+	r.NoError(err)
+	r.Equal("doc", name)
+	r.Equal(doc.Ref(), root.Ref())
+
+	tips, err := TangleTips(tRootLog, tl, "doc", doc)
+	r.NoError(err)
+	r.Equal([]*ssb.MessageRef{ref(4)}, tips)
+
+	tips, err = TangleTips(tRootLog, tl, "other", doc)
+	r.NoError(err)
+	r.Equal([]*ssb.MessageRef{doc}, tips, "an empty tangle has the root as it's tip")
+}
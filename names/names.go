@@ -0,0 +1,164 @@
+package names
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/graph"
+	"go.cryptoscope.co/ssb/indexes"
+)
+
+// Match is a feed that was found by name
+type Match struct {
+	Feed    *ssb.FeedRef `json:"id"`
+	Name    string       `json:"name"`
+	Petname bool         `json:"petname,omitempty"` // we gave it the name
+	Self    bool         `json:"self,omitempty"`    // the feed gave itself the name
+	Votes   int          `json:"votes"`             // how many feeds call it that, including itself
+}
+
+// Lookup finds feeds by their petnames and the names they were given in about messages
+type Lookup struct {
+	Petnames *Petnames
+	Names    indexes.NameIndex
+	About    indexes.AboutStore
+
+	// only names given by feeds within Hops of Self count, all of them if Graph is nil
+	Graph graph.Builder
+	Self  *ssb.FeedRef
+	Hops  int
+}
+
+// Search returns the feeds with a name that starts with prefix, see indexes.NormalizeName.
+// Petnames come first, then exact matches, then names that feeds gave themselves, then the ones most feeds agree on.
+// A feed can match more than once, with different names. limit < 0 returns all of them.
+func (l Lookup) Search(prefix string, limit int) ([]Match, error) {
+	norm := indexes.NormalizeName(prefix)
+
+	var matches []Match
+	petnamed := make(map[string]bool)
+	if l.Petnames != nil {
+		for _, pn := range l.Petnames.All() {
+			if nameHasPrefix(pn.Name, norm) {
+				matches = append(matches, Match{Feed: pn.Feed, Name: pn.Name, Petname: true})
+				petnamed[pn.Feed.Ref()] = true
+			}
+		}
+	}
+
+	var inHops graph.FeedSet
+	if l.Graph != nil && l.Hops >= 0 {
+		inHops = l.Graph.Hops(l.Self, l.Hops)
+		if inHops == nil {
+			return nil, errors.Errorf("names: failed to get feeds in hops")
+		}
+	}
+
+	// the same name is indexed once for every word in it
+	type claimKey struct{ feed, author string }
+	seen := make(map[claimKey]bool)
+	abouts := make(map[string]map[string]indexes.AboutValues)
+	byName := make(map[string]*Match) // feed and name
+	var order []string
+	err := l.Names.Names(norm, func(e indexes.NameEntry) error {
+		ck := claimKey{e.Feed.Ref(), e.Author.Ref()}
+		if seen[ck] || petnamed[ck.feed] {
+			return nil
+		}
+		if inHops != nil && !inHops.Has(e.Author) {
+			return nil
+		}
+
+		// the index keeps old names, only the current claim of the author counts
+		attrs, has := abouts[ck.feed]
+		if !has {
+			var err error
+			attrs, err = l.About.Get(e.Feed)
+			if err != nil {
+				return errors.Wrap(err, "names: failed to get about values")
+			}
+			abouts[ck.feed] = attrs
+		}
+		var name string
+		for _, c := range attrs["name"].Claims {
+			if c.Author.Ref() == ck.author && c.Seq == e.Seq.Seq() {
+				json.Unmarshal(c.Value, &name)
+				break
+			}
+		}
+		if name == "" {
+			return nil
+		}
+		seen[ck] = true
+
+		mk := ck.feed + "\x00" + name
+		m, has := byName[mk]
+		if !has {
+			m = &Match{Feed: e.Feed, Name: name}
+			byName[mk] = m
+			order = append(order, mk)
+		}
+		m.Votes++
+		if ck.author == ck.feed {
+			m.Self = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "names: search failed")
+	}
+
+	claimed := make([]Match, len(order))
+	for i, mk := range order {
+		claimed[i] = *byName[mk]
+	}
+	sort.SliceStable(claimed, func(i, j int) bool {
+		a, b := claimed[i], claimed[j]
+		if ea, eb := indexes.NormalizeName(a.Name) == norm, indexes.NormalizeName(b.Name) == norm; ea != eb {
+			return ea
+		}
+		if a.Self != b.Self {
+			return a.Self
+		}
+		if a.Votes != b.Votes {
+			return a.Votes > b.Votes
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	matches = append(matches, claimed...)
+
+	if limit >= 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// Resolve returns the feed that name refers to: a petname, or the best match of Search if it is an exact one.
+// A leading @ is ignored. The error is ssb.ErrNotFound if no feed is called that.
+func (l Lookup) Resolve(name string) (*ssb.FeedRef, error) {
+	matches, err := l.Search(name, -1)
+	if err != nil {
+		return nil, err
+	}
+	norm := indexes.NormalizeName(name)
+	for _, m := range matches {
+		if indexes.NormalizeName(m.Name) == norm {
+			return m.Feed, nil
+		}
+	}
+	return nil, errors.Wrapf(ssb.ErrNotFound, "names: nobody is called %s", name)
+}
+
+// nameHasPrefix is true if the name would be found with prefix in the name index
+func nameHasPrefix(name, prefix string) bool {
+	for _, s := range indexes.NameSuffixes(name) {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
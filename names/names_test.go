@@ -0,0 +1,123 @@
+package names
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func testFeed(i byte) *ssb.FeedRef {
+	return &ssb.FeedRef{Algo: "ed25519", ID: append(make([]byte, 31), i)}
+}
+
+func TestSearch(t *testing.T) {
+	r := require.New(t)
+
+	rp := repo.NewMemory()
+	rootLog, err := repo.OpenLog(rp)
+	r.NoError(err)
+
+	alice, bob, carla := testFeed(1), testFeed(2), testFeed(3)
+	msgs := []struct {
+		author *ssb.FeedRef
+		about  *ssb.FeedRef
+		name   string
+	}{
+		{alice, alice, "alice"},
+		{bob, alice, "Ally"},
+		{bob, bob, "Bob Alison"},
+		{carla, carla, "alicia"},
+		{carla, bob, "al"},
+		{carla, bob, "bobby"}, // replaces al
+	}
+	for i, m := range msgs {
+		_, err := rootLog.Append(message.StoredMessage{
+			Author:    m.author,
+			Key:       &ssb.MessageRef{Algo: "sha256", Hash: []byte(fmt.Sprintf("%032d", i))},
+			Sequence:  margaret.BaseSeq(i + 1),
+			Timestamp: time.Unix(int64(i), 0),
+			Raw: []byte(fmt.Sprintf(`{"author":%q,"content":{"type":"about","about":%q,"name":%q}}`,
+				m.author.Ref(), m.about.Ref(), m.name)),
+		})
+		r.NoError(err)
+	}
+
+	about, _, serve, err := indexes.OpenAbout(kitlog.NewNopLogger(), rp)
+	r.NoError(err)
+	r.NoError(serve(context.TODO(), rootLog, false))
+	idx, _, serve, err := indexes.OpenNames(rp)
+	r.NoError(err)
+	r.NoError(serve(context.TODO(), rootLog, false))
+	pn, err := OpenPetnames(rp)
+	r.NoError(err)
+
+	l := Lookup{Petnames: pn, Names: idx, About: about}
+
+	matches, err := l.Search("@Al", -1)
+	r.NoError(err)
+	r.Equal([]Match{
+		{Feed: alice, Name: "alice", Self: true, Votes: 1},
+		{Feed: carla, Name: "alicia", Self: true, Votes: 1},
+		{Feed: bob, Name: "Bob Alison", Self: true, Votes: 1}, // matches the second word
+		{Feed: alice, Name: "Ally", Votes: 1},
+	}, matches)
+
+	matches, err = l.Search("al", -1)
+	r.NoError(err)
+	r.Len(matches, 4, "replaced names don't match")
+
+	r.NoError(pn.Set(carla, "Al"))
+	matches, err = l.Search("al", 2)
+	r.NoError(err)
+	r.Equal([]Match{
+		{Feed: carla, Name: "Al", Petname: true},
+		{Feed: alice, Name: "alice", Self: true, Votes: 1},
+	}, matches)
+
+	feed, err := l.Resolve("@al")
+	r.NoError(err)
+	r.Equal(carla.Ref(), feed.Ref())
+
+	feed, err = l.Resolve("bobby")
+	r.NoError(err)
+	r.Equal(bob.Ref(), feed.Ref())
+
+	_, err = l.Resolve("bo")
+	r.Equal(ssb.ErrNotFound, errors.Cause(err))
+}
+
+func TestPetnames(t *testing.T) {
+	r := require.New(t)
+
+	dir, err := ioutil.TempDir("", "petnames")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	pn, err := OpenPetnames(repo.New(dir))
+	r.NoError(err)
+	r.NoError(pn.Set(testFeed(1), "mom"))
+	r.NoError(pn.Set(testFeed(2), "boss"))
+	r.NoError(pn.Set(testFeed(2), ""))
+
+	pn, err = OpenPetnames(repo.New(dir))
+	r.NoError(err)
+	name, has := pn.Get(testFeed(1))
+	r.True(has)
+	r.Equal("mom", name)
+	_, has = pn.Get(testFeed(2))
+	r.False(has)
+	r.Equal([]Petname{{Feed: testFeed(1), Name: "mom"}}, pn.All())
+}
@@ -0,0 +1,121 @@
+// Package names looks up feeds by the names they were given, in about messages or locally as petnames.
+package names
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// PetnamesFileName is where the petnames are stored in the repo
+const PetnamesFileName = "petnames.json"
+
+// Petnames are the names we gave feeds ourselves. They are never published.
+type Petnames struct {
+	mu    sync.Mutex
+	path  string            // empty for memory repos
+	names map[string]string // feed ref to name
+}
+
+// OpenPetnames loads the petnames of the repo
+func OpenPetnames(r repo.Interface) (*Petnames, error) {
+	pn := &Petnames{names: make(map[string]string)}
+	if repo.IsMemory(r) {
+		return pn, nil
+	}
+	pn.path = r.GetPath(PetnamesFileName)
+
+	b, err := ioutil.ReadFile(pn.path)
+	if os.IsNotExist(err) {
+		return pn, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "petnames: failed to read file")
+	}
+	if err := json.Unmarshal(b, &pn.names); err != nil {
+		return nil, errors.Wrap(err, "petnames: failed to decode file")
+	}
+	return pn, nil
+}
+
+// Set gives feed the petname name, an empty name removes it
+func (pn *Petnames) Set(feed *ssb.FeedRef, name string) error {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+
+	old, had := pn.names[feed.Ref()]
+	if name == "" {
+		delete(pn.names, feed.Ref())
+	} else {
+		pn.names[feed.Ref()] = name
+	}
+
+	if err := pn.save(); err != nil {
+		// keep memory and disk in sync
+		if had {
+			pn.names[feed.Ref()] = old
+		} else {
+			delete(pn.names, feed.Ref())
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns the petname of feed, false if it has none
+func (pn *Petnames) Get(feed *ssb.FeedRef) (string, bool) {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+	name, has := pn.names[feed.Ref()]
+	return name, has
+}
+
+// Petname is a name we gave to a feed
+type Petname struct {
+	Feed *ssb.FeedRef
+	Name string
+}
+
+// All returns all the petnames, sorted by name
+func (pn *Petnames) All() []Petname {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+
+	all := make([]Petname, 0, len(pn.names))
+	for ref, name := range pn.names {
+		feed, err := ssb.ParseFeedRef(ref)
+		if err != nil {
+			continue // Set only stores valid refs
+		}
+		all = append(all, Petname{Feed: feed, Name: name})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Feed.Ref() < all[j].Feed.Ref()
+	})
+	return all
+}
+
+// save writes the petnames to a temporary file and moves it over the old one
+func (pn *Petnames) save() error {
+	if pn.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(pn.names, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "petnames: failed to encode")
+	}
+	tmp := pn.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrap(err, "petnames: failed to write file")
+	}
+	return errors.Wrap(os.Rename(tmp, pn.path), "petnames: failed to replace file")
+}
@@ -0,0 +1,193 @@
+// Package about offers the about index (see indexes.AboutStore) over muxrpc.
+package about
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/internal/mutil"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// Update is what about.stream sends for every about message
+type Update struct {
+	Key        *ssb.MessageRef            `json:"key"`
+	Author     *ssb.FeedRef               `json:"author"`
+	About      string                     `json:"about"`
+	Attributes map[string]json.RawMessage `json:"attributes"` // a null value takes the attribute back
+	Timestamp  int64                      `json:"timestamp"`  // when we received it, in milliseconds
+}
+
+type plugin struct {
+	h muxrpc.Handler
+}
+
+// New returns the about.get, about.latestValue and about.stream calls.
+//
+// about.get takes a feed, message or blob reference and returns its attributes by key, see indexes.AboutValues.
+// about.latestValue takes (target, key) or {target, key} and returns the value the target assigned itself or the latest one.
+// about.stream sends an Update for every about message and takes the options of createLogStream, like {old: false, live: true} for only the new ones.
+func New(rootLog margaret.Log, types multilog.MultiLog, store indexes.AboutStore) ssb.Plugin {
+	return plugin{
+		h: handler{
+			root:  rootLog,
+			types: types,
+			store: store,
+		},
+	}
+}
+
+func (p plugin) Name() string { return "about" }
+
+func (p plugin) Method() muxrpc.Method {
+	return muxrpc.Method{"about"}
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type handler struct {
+	root  margaret.Log
+	types multilog.MultiLog
+	store indexes.AboutStore
+}
+
+func (h handler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	switch req.Method.String() {
+	case "about.get":
+		h.get(ctx, req)
+	case "about.latestValue":
+		h.latestValue(ctx, req)
+	case "about.stream":
+		h.stream(ctx, req)
+	default:
+		req.CloseWithError(errors.Errorf("unknown command: %s", req.Method))
+	}
+}
+
+func (h handler) get(ctx context.Context, req *muxrpc.Request) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: about.get @feed.ed25519"))
+		return
+	}
+	var targetStr string
+	switch v := req.Args[0].(type) {
+	case string:
+		targetStr = v
+	case map[string]interface{}:
+		targetStr, _ = v["target"].(string)
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+	target, err := ssb.ParseRef(targetStr)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request - invalid target"))
+		return
+	}
+
+	attrs, err := h.store.Get(target)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "about.get failed"))
+		return
+	}
+	if err := req.Return(ctx, attrs); err != nil {
+		req.CloseWithError(errors.Wrap(err, "about.get: failed to return attributes"))
+	}
+}
+
+func (h handler) latestValue(ctx context.Context, req *muxrpc.Request) {
+	var targetStr, key string
+	switch {
+	case len(req.Args) == 1:
+		args, ok := req.Args[0].(map[string]interface{})
+		if !ok {
+			req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+			return
+		}
+		targetStr, _ = args["target"].(string)
+		key, _ = args["key"].(string)
+	case len(req.Args) >= 2:
+		targetStr, _ = req.Args[0].(string)
+		key, _ = req.Args[1].(string)
+	}
+	if key == "" {
+		req.CloseWithError(errors.Errorf("usage: about.latestValue @feed.ed25519 key"))
+		return
+	}
+	target, err := ssb.ParseRef(targetStr)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request - invalid target"))
+		return
+	}
+
+	v, err := h.store.LatestValue(target, key)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "about.latestValue failed"))
+		return
+	}
+	if err := req.Return(ctx, v); err != nil {
+		req.CloseWithError(errors.Wrap(err, "about.latestValue: failed to return value"))
+	}
+}
+
+func (h handler) stream(ctx context.Context, req *muxrpc.Request) {
+	qry := message.CreateHistArgs{Limit: -1}
+	if len(req.Args) > 0 {
+		args, ok := req.Args[0].(map[string]interface{})
+		if !ok {
+			req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+			return
+		}
+		q, err := message.NewCreateHistArgsFromMap(args)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "bad request"))
+			return
+		}
+		qry = *q
+	}
+
+	sublog, err := h.types.Get(librarian.Addr("about"))
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "about.stream: failed to open about messages"))
+		return
+	}
+
+	err = transform.PourLog(ctx, req, mutil.Indirect(h.root, sublog), qry, encodeUpdate)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "about.stream: failed to send updates"))
+		return
+	}
+	req.Stream.Close()
+}
+
+// encodeUpdate skips messages that aren't valid about messages
+func encodeUpdate(msg message.StoredMessage) ([]byte, error) {
+	var dmsg message.DeserializedMessage
+	if err := json.Unmarshal(msg.Raw, &dmsg); err != nil {
+		return nil, nil
+	}
+	target, attrs, err := indexes.AboutAttributes(dmsg.Content)
+	if err != nil {
+		return nil, nil
+	}
+	return json.Marshal(Update{
+		Key:        msg.Key,
+		Author:     msg.Author,
+		About:      target.Ref(),
+		Attributes: attrs,
+		Timestamp:  msg.Timestamp.UnixNano() / 1000000,
+	})
+}
@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cryptix/go/logging"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/archive"
+	"go.cryptoscope.co/ssb/graph"
+)
+
+// ExportArgs are the arguments of archive.export.
+// Hops selects all the feeds within that distance, it can be combined with Feeds.
+type ExportArgs struct {
+	Path  string         `json:"path"`
+	Feeds []*ssb.FeedRef `json:"feeds,omitempty"`
+	Hops  *int           `json:"hops,omitempty"`
+}
+
+// ImportArgs are the arguments of archive.import
+type ImportArgs struct {
+	Path string `json:"path"`
+}
+
+type handler struct {
+	info logging.Interface
+
+	self      *ssb.FeedRef
+	rootLog   margaret.Log
+	userFeeds multilog.MultiLog
+	graph     graph.Builder
+	hmacSec   *[32]byte
+}
+
+func (h handler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	if len(req.Args) != 1 {
+		req.CloseWithError(errors.Errorf("usage: %s {path: ...}", req.Method))
+		return
+	}
+	// re-decode the generic argument map
+	b, err := json.Marshal(req.Args[0])
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "invalid arguments"))
+		return
+	}
+
+	var ret interface{}
+	switch req.Method.String() {
+	case "archive.export":
+		var args ExportArgs
+		if err := json.Unmarshal(b, &args); err != nil {
+			req.CloseWithError(errors.Wrap(err, "invalid arguments"))
+			return
+		}
+		ret, err = h.export(ctx, args)
+
+	case "archive.import":
+		var args ImportArgs
+		if err := json.Unmarshal(b, &args); err != nil {
+			req.CloseWithError(errors.Wrap(err, "invalid arguments"))
+			return
+		}
+		ret, err = h.importArchive(ctx, args)
+
+	default:
+		err = errors.Errorf("unknown command: %s", req.Method)
+	}
+	if err != nil {
+		h.info.Log("event", "archive call failed", "method", req.Method, "err", err)
+		req.CloseWithError(err)
+		return
+	}
+
+	if err := req.Return(ctx, ret); err != nil {
+		h.info.Log("event", "failed to return", "method", req.Method, "err", err)
+	}
+}
+
+func (h handler) export(ctx context.Context, args ExportArgs) (*archive.Manifest, error) {
+	if args.Path == "" {
+		return nil, errors.New("archive.export: path is required")
+	}
+	feeds := args.Feeds
+	if args.Hops != nil {
+		lst, err := h.graph.Hops(h.self, *args.Hops).List()
+		if err != nil {
+			return nil, errors.Wrap(err, "archive.export: failed to get feeds within hops")
+		}
+		feeds = append(feeds, lst...)
+	}
+	if len(feeds) == 0 {
+		return nil, errors.New("archive.export: no feeds selected")
+	}
+
+	f, err := os.OpenFile(args.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "archive.export: failed to create file")
+	}
+
+	m, err := archive.Export(ctx, f, h.rootLog, h.userFeeds, feeds)
+	if err != nil {
+		f.Close()
+		os.Remove(args.Path)
+		return nil, err
+	}
+	return m, errors.Wrap(f.Close(), "archive.export: failed to close file")
+}
+
+func (h handler) importArchive(ctx context.Context, args ImportArgs) (*archive.ImportReport, error) {
+	if args.Path == "" {
+		return nil, errors.New("archive.import: path is required")
+	}
+	f, err := os.Open(args.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "archive.import: failed to open file")
+	}
+	defer f.Close()
+
+	return archive.Import(ctx, f, h.rootLog, h.userFeeds, h.hmacSec)
+}
@@ -0,0 +1,45 @@
+// Package archive offers export and import of feed archives (see package go.cryptoscope.co/ssb/archive) over muxrpc.
+//
+// Both calls read or write files on the machine the bot runs on and should only be registered on the local control socket.
+package archive
+
+import (
+	"github.com/cryptix/go/logging"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/graph"
+)
+
+type plugin struct {
+	h muxrpc.Handler
+}
+
+// NewPlug returns the archive.export and archive.import calls.
+// hmacSecret is used to verify imported messages and may be nil.
+func NewPlug(i logging.Interface, self *ssb.FeedRef, rootLog margaret.Log, userFeeds multilog.MultiLog, gb graph.Builder, hmacSecret *[32]byte) ssb.Plugin {
+	return plugin{
+		h: handler{
+			info:      i,
+			self:      self,
+			rootLog:   rootLog,
+			userFeeds: userFeeds,
+			graph:     gb,
+			hmacSec:   hmacSecret,
+		},
+	}
+}
+
+func (p plugin) Name() string {
+	return "archive"
+}
+
+func (p plugin) Method() muxrpc.Method {
+	return muxrpc.Method{"archive"}
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
@@ -13,17 +13,39 @@ import (
 
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/internal/multiserver"
+	"go.cryptoscope.co/ssb/repo"
 )
 
+// Reindexer rebuilds a single index while the bot is running
+type Reindexer interface {
+	Reindex(name string, progress func(done, total int64)) error
+}
+
+// Backuper writes a snapshot of the repo while the bot is running
+type Backuper interface {
+	Backup(path string, withSecret bool) (*repo.BackupManifest, error)
+}
+
+// ReindexProgress is send to the caller of ctrl.reindex while the index is rebuilt
+type ReindexProgress struct {
+	Index string `json:"index"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+}
+
 type handler struct {
-	node ssb.Network
-	info logging.Interface
+	node    ssb.Network
+	reindex Reindexer
+	backup  Backuper
+	info    logging.Interface
 }
 
-func New(i logging.Interface, n ssb.Network) muxrpc.Handler {
+func New(i logging.Interface, n ssb.Network, r Reindexer, b Backuper) muxrpc.Handler {
 	return &handler{
-		info: i,
-		node: n,
+		info:    i,
+		node:    n,
+		reindex: r,
+		backup:  b,
 	}
 }
 
@@ -78,6 +100,69 @@ func (h *handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrp
 		closed = true
 		h.check(req.Return(ctx, "connected"))
 
+	case "ctrl.reindex":
+		if len(req.Args) != 1 {
+			h.info.Log("error", "usage", "args", req.Args, "method", req.Method)
+			checkAndClose(errors.New("usage: ctrl.reindex indexName"))
+			return
+		}
+		name, ok := req.Args[0].(string)
+		if !ok {
+			err := errors.Errorf("ctrl.reindex call: expected argument to be string, got %T", req.Args[0])
+			checkAndClose(err)
+			return
+		}
+		if h.reindex == nil {
+			checkAndClose(errors.New("ctrl.reindex: not supported"))
+			return
+		}
+		// the rebuild continues even if the caller goes away
+		var gone bool
+		err := h.reindex.Reindex(name, func(done, total int64) {
+			if gone {
+				return
+			}
+			err := req.Stream.Pour(ctx, ReindexProgress{Index: name, Done: done, Total: total})
+			if err != nil {
+				h.check(errors.Wrap(err, "ctrl.reindex: failed to send progress"))
+				gone = true
+			}
+		})
+		if err != nil {
+			checkAndClose(errors.Wrap(err, "ctrl.reindex failed"))
+			return
+		}
+
+	case "ctrl.backup":
+		if len(req.Args) < 1 {
+			h.info.Log("error", "usage", "args", req.Args, "method", req.Method)
+			checkAndClose(errors.New("usage: ctrl.backup path [{secret: true}]"))
+			return
+		}
+		path, ok := req.Args[0].(string)
+		if !ok {
+			err := errors.Errorf("ctrl.backup call: expected argument to be string, got %T", req.Args[0])
+			checkAndClose(err)
+			return
+		}
+		var withSecret bool
+		if len(req.Args) > 1 {
+			if opts, ok := req.Args[1].(map[string]interface{}); ok {
+				withSecret, _ = opts["secret"].(bool)
+			}
+		}
+		if h.backup == nil {
+			checkAndClose(errors.New("ctrl.backup: not supported"))
+			return
+		}
+		m, err := h.backup.Backup(path, withSecret)
+		if err != nil {
+			checkAndClose(errors.Wrap(err, "ctrl.backup failed"))
+			return
+		}
+		closed = true
+		h.check(req.Return(ctx, m))
+
 	default:
 		checkAndClose(errors.Errorf("unknown command: %s", req.Method))
 	}
@@ -10,8 +10,8 @@ type connectPlug struct {
 	h muxrpc.Handler
 }
 
-func NewPlug(i logging.Interface, n ssb.Network) ssb.Plugin {
-	return &connectPlug{h: New(i, n)}
+func NewPlug(i logging.Interface, n ssb.Network, r Reindexer, b Backuper) ssb.Plugin {
+	return &connectPlug{h: New(i, n, r, b)}
 }
 
 func (p connectPlug) Name() string {
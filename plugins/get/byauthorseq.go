@@ -0,0 +1,94 @@
+package get
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+type AuthorSeqGetter interface {
+	GetByAuthorSeq(ssb.FeedRef, int64) (*message.StoredMessage, error)
+}
+
+type byAuthorSeqPlug struct {
+	h muxrpc.Handler
+}
+
+// NewByAuthorSeq returns message number seq of a feed.
+// Takes either the feed and the sequence as two arguments or {author, sequence}.
+func NewByAuthorSeq(g AuthorSeqGetter) ssb.Plugin {
+	return byAuthorSeqPlug{
+		h: byAuthorSeqHandler{g: g},
+	}
+}
+
+func (p byAuthorSeqPlug) Name() string { return "getByAuthorSeq" }
+
+func (p byAuthorSeqPlug) Method() muxrpc.Method {
+	return muxrpc.Method{"getByAuthorSeq"}
+}
+
+func (p byAuthorSeqPlug) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type byAuthorSeqHandler struct {
+	g AuthorSeqGetter
+}
+
+func (h byAuthorSeqHandler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h byAuthorSeqHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("invalid arguments"))
+		return
+	}
+
+	var (
+		author interface{}
+		seq    interface{}
+	)
+	switch v := req.Args[0].(type) {
+	case string:
+		if len(req.Args) < 2 {
+			req.CloseWithError(errors.Errorf("invalid arguments - missing sequence"))
+			return
+		}
+		author, seq = v, req.Args[1]
+	case map[string]interface{}:
+		author, seq = v["author"], v["sequence"]
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+
+	authorStr, ok := author.(string)
+	if !ok {
+		req.CloseWithError(errors.Errorf("invalid argument - author needs to be a string"))
+		return
+	}
+	ref, err := ssb.ParseFeedRef(authorStr)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "failed to parse arguments"))
+		return
+	}
+	seqF, ok := seq.(float64)
+	if !ok {
+		req.CloseWithError(errors.Errorf("invalid argument - sequence needs to be a number"))
+		return
+	}
+
+	msg, err := h.g.GetByAuthorSeq(*ref, int64(seqF))
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "failed to load message"))
+		return
+	}
+
+	if err := req.Return(ctx, msg.Raw); err != nil {
+		req.CloseWithError(errors.Wrap(err, "getByAuthorSeq: failed to return message"))
+	}
+}
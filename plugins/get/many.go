@@ -0,0 +1,104 @@
+package get
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+type manyPlug struct {
+	h muxrpc.Handler
+}
+
+// NewMany streams the messages for a list of keys as {key, value, timestamp} objects, in the order of the list.
+// Takes the keys as an array or {keys: [...]}. Keys that aren't stored are skipped.
+func NewMany(g Getter) ssb.Plugin {
+	return manyPlug{
+		h: manyHandler{g: g},
+	}
+}
+
+func (p manyPlug) Name() string { return "getMany" }
+
+func (p manyPlug) Method() muxrpc.Method {
+	return muxrpc.Method{"getMany"}
+}
+
+func (p manyPlug) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type manyHandler struct {
+	g Getter
+}
+
+func (h manyHandler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h manyHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("invalid arguments"))
+		return
+	}
+
+	var keys []interface{}
+	switch v := req.Args[0].(type) {
+	case []interface{}:
+		keys = v
+	case map[string]interface{}:
+		keysV, ok := v["keys"].([]interface{})
+		if !ok {
+			req.CloseWithError(errors.Errorf("invalid argument - missing 'keys' array in map"))
+			return
+		}
+		keys = keysV
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+
+	refs := make([]*ssb.MessageRef, len(keys))
+	for i, k := range keys {
+		str, ok := k.(string)
+		if !ok {
+			req.CloseWithError(errors.Errorf("invalid argument - key %d is not a string", i))
+			return
+		}
+		ref, err := ssb.ParseMessageRef(str)
+		if err != nil {
+			req.CloseWithError(errors.Wrapf(err, "failed to parse key %d", i))
+			return
+		}
+		refs[i] = ref
+	}
+
+	for _, ref := range refs {
+		msg, err := h.g.Get(*ref)
+		if err != nil {
+			if errors.Cause(err) == ssb.ErrNotFound {
+				continue
+			}
+			req.CloseWithError(errors.Wrapf(err, "failed to load %s", ref.Ref()))
+			return
+		}
+
+		kv, err := json.Marshal(message.KeyValueRaw{
+			Key:       msg.Key,
+			Value:     msg.Raw,
+			Timestamp: msg.Timestamp.UnixNano() / 1000000,
+		})
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "failed to encode message"))
+			return
+		}
+		if err := req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: kv}); err != nil {
+			req.CloseWithError(errors.Wrap(err, "failed to send message"))
+			return
+		}
+	}
+	req.Stream.Close()
+}
@@ -12,6 +12,8 @@ import (
 	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/muxrpc"
+	"go.cryptoscope.co/netwrap"
+	"go.cryptoscope.co/secretstream"
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/graph"
 	"go.cryptoscope.co/ssb/message"
@@ -195,6 +197,15 @@ func (g *handler) fetchFeed(
 		}
 	}()
 
+	// remember who sent us the messages, nil if the endpoint has no secret-handshake address
+	var from *ssb.FeedRef
+	if remoteAddr, ok := netwrap.GetAddr(edp.Remote(), "shs-bs").(secretstream.Addr); ok {
+		from = &ssb.FeedRef{
+			Algo: "ed25519",
+			ID:   remoteAddr.PubKey,
+		}
+	}
+
 	source, err := edp.Source(toLong, message.RawSignedMessage{}, []string{"createHistoryStream"}, q)
 	if err != nil {
 		return errors.Wrapf(err, "fetchFeed(%s:%d) failed to create source", fr.Ref(), latestSeq)
@@ -210,41 +221,26 @@ func (g *handler) fetchFeed(
 		}
 
 		rmsg := v.(message.RawSignedMessage)
-		ref, dmsg, err := message.Verify(rmsg.RawMessage, g.hmacSec)
-		if err != nil {
-			return errors.Wrapf(err, "fetchFeed(%s:%d): message verify failed", fr.Ref(), latestSeq)
+		var current *message.StoredMessage
+		if latestSeq > 0 {
+			current = &latestMsg
 		}
-
-		if latestSeq > 1 {
-			if bytes.Compare(latestMsg.Key.Hash, dmsg.Previous.Hash) != 0 {
-				return errors.Errorf("fetchFeed(%s:%d): previous compare failed expected:%s incoming:%s",
-					fr.Ref(),
-					latestSeq,
-					latestMsg.Key.Ref(),
-					dmsg.Previous.Ref(),
-				)
-			}
-			if latestMsg.Sequence+1 != dmsg.Sequence {
-				return errors.Errorf("fetchFeed(%s:%d): next.seq != curr.seq+1", fr.Ref(), latestSeq)
-			}
+		nextMsg, err := message.ValidateNext(current, rmsg.RawMessage, g.hmacSec)
+		if err != nil {
+			return errors.Wrapf(err, "fetchFeed(%s:%d)", fr.Ref(), latestSeq)
 		}
-
-		nextMsg := message.StoredMessage{
-			Author:    &dmsg.Author,
-			Previous:  &dmsg.Previous,
-			Key:       ref,
-			Sequence:  dmsg.Sequence,
-			Timestamp: time.Now(),
-			Raw:       rmsg.RawMessage,
+		if !bytes.Equal(nextMsg.Author.ID, fr.ID) {
+			return errors.Errorf("fetchFeed(%s:%d): got message from %s", fr.Ref(), latestSeq, nextMsg.Author.Ref())
 		}
 
-		_, err = g.RootLog.Append(nextMsg)
+		nextMsg.ReceivedFrom = from
+		_, err = g.RootLog.Append(*nextMsg)
 		if err != nil {
-			return errors.Wrapf(err, "fetchFeed(%s): failed to append message(%s:%d)", fr.Ref(), ref.Ref(), dmsg.Sequence)
+			return errors.Wrapf(err, "fetchFeed(%s): failed to append message(%s:%d)", fr.Ref(), nextMsg.Key.Ref(), nextMsg.Sequence)
 		}
 
-		latestSeq = dmsg.Sequence
-		latestMsg = nextMsg
+		latestSeq = nextMsg.Sequence
+		latestMsg = *nextMsg
 	} // hist drained
 
 	return nil
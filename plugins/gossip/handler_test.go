@@ -26,6 +26,7 @@ import (
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/indexes"
 	"go.cryptoscope.co/ssb/internal/ctxutils"
+	"go.cryptoscope.co/ssb/message"
 	"go.cryptoscope.co/ssb/multilogs"
 	"go.cryptoscope.co/ssb/plugins/test"
 	"go.cryptoscope.co/ssb/repo"
@@ -100,7 +101,7 @@ func (tc *testCase) runTest(t *testing.T) {
 		fatalOnError(errors.Wrap(err, "error serving src user feeds multilog"))
 	}()
 
-	srcGraphBuilder, srcGraphBuilderServe, err := indexes.OpenContacts(infoAlice, srcRepo)
+	srcGraphBuilder, _, srcGraphBuilderServe, err := indexes.OpenContacts(infoAlice, srcRepo)
 	r.NoError(err, "error getting src contacts index")
 	defer func() {
 		err := srcGraphBuilder.Close()
@@ -131,7 +132,7 @@ func (tc *testCase) runTest(t *testing.T) {
 		fatalOnError(errors.Wrap(err, "error serving dst user feeds multilog"))
 	}()
 
-	dstGraphBuilder, dstGraphBuilderServe, err := indexes.OpenContacts(infoAlice, dstRepo)
+	dstGraphBuilder, _, dstGraphBuilderServe, err := indexes.OpenContacts(infoAlice, dstRepo)
 	r.NoError(err, "error getting dst contacts index")
 	defer func() {
 		err := dstGraphBuilder.Close()
@@ -223,6 +224,14 @@ func (tc *testCase) runTest(t *testing.T) {
 	r.NoError(err, "failed to aquire current sequence of test sublog")
 	r.True(seqVal.(margaret.BaseSeq) > 0, "wrong sequence value on testlog")
 
+	// the messages remember who sent them
+	v, err := dstRootLog.Get(margaret.BaseSeq(0))
+	r.NoError(err)
+	stored, ok := v.(message.StoredMessage)
+	r.True(ok, "wrong type: %T", v)
+	r.NotNil(stored.ReceivedFrom)
+	r.Equal(srcID.Ref(), stored.ReceivedFrom.Ref())
+
 	// do the dance - again.
 	// should not get more messages
 	// done = connectAndServe(t, srcRepo, dstRepo)
@@ -269,7 +278,7 @@ func BenchmarkReplicate(b *testing.B) {
 
 	srcKeyPair, _ := repo.OpenKeyPair(srcRepo)
 	srcID := srcKeyPair.Id
-	srcGraphBuilder, srcGraphBuilderServe, err := indexes.OpenContacts(bench, srcRepo)
+	srcGraphBuilder, _, srcGraphBuilderServe, err := indexes.OpenContacts(bench, srcRepo)
 	r.NoError(err)
 	wg.Add(1)
 	go func() {
@@ -295,7 +304,7 @@ func BenchmarkReplicate(b *testing.B) {
 		}()
 		dstKeyPair, _ := repo.OpenKeyPair(dstRepo)
 		dstID := dstKeyPair.Id
-		dstGraphBuilder, dstGraphBuilderServe, _ := indexes.OpenContacts(bench, dstRepo)
+		dstGraphBuilder, _, dstGraphBuilderServe, _ := indexes.OpenContacts(bench, dstRepo)
 
 		wg.Add(1)
 		go func() {
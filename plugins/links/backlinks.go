@@ -0,0 +1,122 @@
+package links
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// ~> sbot backlinks --help
+// (backlinks) Stream the messages that reference a message, feed or blob, in the order they were received.
+// backlinks %msg [--rel name] [--reverse] [--limit n] [--keys]
+type backlinksPlug struct {
+	h muxrpc.Handler
+}
+
+// NewBacklinks returns the backlinks call
+func NewBacklinks(rootLog margaret.Log, idx indexes.LinkIndex) ssb.Plugin {
+	return backlinksPlug{
+		h: backlinksHandler{root: rootLog, idx: idx},
+	}
+}
+
+func (p backlinksPlug) Name() string { return "backlinks" }
+
+func (p backlinksPlug) Method() muxrpc.Method {
+	return muxrpc.Method{"backlinks"}
+}
+
+func (p backlinksPlug) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type backlinksHandler struct {
+	root margaret.Log
+	idx  indexes.LinkIndex
+}
+
+func (h backlinksHandler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h backlinksHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	args := struct {
+		Dest    string `json:"dest"`
+		Rel     string `json:"rel"`
+		Reverse bool   `json:"reverse"`
+		Keys    bool   `json:"keys"`
+		Limit   int    `json:"limit"`
+	}{Keys: true, Limit: -1}
+	if len(req.Args) > 0 {
+		if dest, ok := req.Args[0].(string); ok {
+			args.Dest = dest
+		} else if err := decodeArgs(req, &args); err != nil {
+			req.CloseWithError(errors.Wrap(err, "bad request"))
+			return
+		}
+	}
+	if len(args.Dest) < 2 {
+		req.CloseWithError(errors.Errorf("bad request: backlinks needs a dest reference"))
+		return
+	}
+
+	// a message can reference dest more than once
+	seqs := make(map[int64]struct{})
+	err := h.idx.Links(indexes.LinkQuery{Dest: args.Dest, Rel: args.Rel}, func(l indexes.Link) error {
+		seqs[l.Seq.Seq()] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "backlinks: failed to query links"))
+		return
+	}
+	sorted := make([]int64, 0, len(seqs))
+	for seq := range seqs {
+		sorted = append(sorted, seq)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if args.Reverse {
+			return sorted[i] > sorted[j]
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	var sent int
+	for _, seq := range sorted {
+		if args.Limit >= 0 && sent >= args.Limit {
+			break
+		}
+		msg, err := getMessage(h.root, margaret.BaseSeq(seq))
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "backlinks: failed to send messages"))
+			return
+		} else if msg == nil {
+			continue
+		}
+
+		raw := msg.Raw
+		if args.Keys {
+			raw, err = json.Marshal(message.KeyValueRaw{
+				Key:       msg.Key,
+				Value:     msg.Raw,
+				Timestamp: msg.Timestamp.UnixNano() / 1000000,
+			})
+			if err != nil {
+				req.CloseWithError(errors.Wrap(err, "backlinks: failed to encode message"))
+				return
+			}
+		}
+		if err := req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: raw}); err != nil {
+			req.CloseWithError(errors.Wrap(err, "backlinks: failed to send messages"))
+			return
+		}
+		sent++
+	}
+	req.Stream.Close()
+}
@@ -0,0 +1,146 @@
+// Package links offers the links and backlinks calls, which find the messages that reference a message, feed or blob.
+package links
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// Link is one result of the links call
+type Link struct {
+	Source *ssb.FeedRef    `json:"source"`
+	Dest   string          `json:"dest"`
+	Rel    string          `json:"rel"`
+	Key    *ssb.MessageRef `json:"key"`
+	Value  json.RawMessage `json:"value,omitempty"`
+}
+
+// ~> sbot links --help
+// (links) Stream the references between messages, feeds and blobs.
+// links [--source @feed] [--dest ref] [--rel name] [--values] [--limit n]
+//
+// dest can also be @, % or & for all references to feeds, messages or blobs.
+type linksPlug struct {
+	h muxrpc.Handler
+}
+
+// New returns the links call
+func New(rootLog margaret.Log, idx indexes.LinkIndex) ssb.Plugin {
+	return linksPlug{
+		h: linksHandler{root: rootLog, idx: idx},
+	}
+}
+
+func (p linksPlug) Name() string { return "links" }
+
+func (p linksPlug) Method() muxrpc.Method {
+	return muxrpc.Method{"links"}
+}
+
+func (p linksPlug) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type linksHandler struct {
+	root margaret.Log
+	idx  indexes.LinkIndex
+}
+
+func (h linksHandler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h linksHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	var args struct {
+		Source string `json:"source"`
+		Dest   string `json:"dest"`
+		Rel    string `json:"rel"`
+		Values bool   `json:"values"`
+		Limit  *int   `json:"limit"`
+	}
+	if err := decodeArgs(req, &args); err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request"))
+		return
+	}
+	qry := indexes.LinkQuery{Dest: args.Dest, Rel: args.Rel}
+	if args.Source != "" {
+		var err error
+		qry.Source, err = ssb.ParseFeedRef(args.Source)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "bad request: invalid source"))
+			return
+		}
+	}
+
+	var sent int
+	err := h.idx.Links(qry, func(l indexes.Link) error {
+		if args.Limit != nil && sent >= *args.Limit {
+			return errLimit
+		}
+		msg, err := getMessage(h.root, l.Seq)
+		if err != nil {
+			return err
+		} else if msg == nil {
+			return nil
+		}
+		out := Link{
+			Source: l.Source,
+			Dest:   l.Dest,
+			Rel:    l.Rel,
+			Key:    msg.Key,
+		}
+		if args.Values {
+			out.Value = msg.Raw
+		}
+		b, err := json.Marshal(out)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode link")
+		}
+		sent++
+		return req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: b})
+	})
+	if err != nil && errors.Cause(err) != errLimit {
+		req.CloseWithError(errors.Wrap(err, "links: failed to send links"))
+		return
+	}
+	req.Stream.Close()
+}
+
+var errLimit = errors.New("links: limit reached")
+
+// decodeArgs re-decodes the generic argument map of req into v, no arguments leave v as it is
+func decodeArgs(req *muxrpc.Request, v interface{}) error {
+	if len(req.Args) == 0 {
+		return nil
+	}
+	if _, ok := req.Args[0].(map[string]interface{}); !ok {
+		return errors.Errorf("invalid argument type %T", req.Args[0])
+	}
+	b, err := json.Marshal(req.Args[0])
+	if err != nil {
+		return errors.Wrap(err, "invalid arguments")
+	}
+	return errors.Wrap(json.Unmarshal(b, v), "invalid arguments")
+}
+
+// getMessage returns the message at seq in the root log, nil if it was deleted
+func getMessage(root margaret.Log, seq margaret.Seq) (*message.StoredMessage, error) {
+	v, err := root.Get(seq)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get message %d", seq.Seq())
+	}
+	msg, ok := v.(message.StoredMessage)
+	if !ok {
+		if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+			return nil, nil
+		}
+		return nil, errors.Errorf("wrong message type. expected %T - got %T", msg, v)
+	}
+	return &msg, nil
+}
@@ -0,0 +1,130 @@
+// Package names offers names.search and names.set (see package go.cryptoscope.co/ssb/names) over muxrpc.
+package names
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/names"
+)
+
+type plugin struct {
+	h muxrpc.Handler
+}
+
+// New returns the names.search and names.set calls.
+//
+// names.search takes a prefix, as a string or {prefix, limit}, and returns the names.Match list of it.
+// names.set takes (feed, name) or {id, name} and sets our petname of feed, an empty name removes it.
+func New(lookup names.Lookup) ssb.Plugin {
+	return plugin{
+		h: handler{lookup: lookup},
+	}
+}
+
+func (p plugin) Name() string { return "names" }
+
+func (p plugin) Method() muxrpc.Method {
+	return muxrpc.Method{"names"}
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type handler struct {
+	lookup names.Lookup
+}
+
+func (h handler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	switch req.Method.String() {
+	case "names.search":
+		h.search(ctx, req)
+	case "names.set":
+		h.set(ctx, req)
+	default:
+		req.CloseWithError(errors.Errorf("unknown command: %s", req.Method))
+	}
+}
+
+func (h handler) search(ctx context.Context, req *muxrpc.Request) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: names.search prefix"))
+		return
+	}
+	var (
+		prefix string
+		limit  = -1
+	)
+	switch v := req.Args[0].(type) {
+	case string:
+		prefix = v
+	case map[string]interface{}:
+		prefix, _ = v["prefix"].(string)
+		if l, has := v["limit"]; has {
+			lf, ok := l.(float64)
+			if !ok {
+				req.CloseWithError(errors.Errorf("bad request - limit needs to be a number, not %T", l))
+				return
+			}
+			limit = int(lf)
+		}
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+
+	matches, err := h.lookup.Search(prefix, limit)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "names.search failed"))
+		return
+	}
+	if matches == nil {
+		matches = []names.Match{}
+	}
+	if err := req.Return(ctx, matches); err != nil {
+		req.CloseWithError(errors.Wrap(err, "names.search: failed to return matches"))
+	}
+}
+
+func (h handler) set(ctx context.Context, req *muxrpc.Request) {
+	var feedStr, name string
+	switch {
+	case len(req.Args) == 1:
+		args, ok := req.Args[0].(map[string]interface{})
+		if !ok {
+			req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+			return
+		}
+		feedStr, _ = args["id"].(string)
+		name, _ = args["name"].(string)
+	case len(req.Args) >= 2:
+		feedStr, _ = req.Args[0].(string)
+		name, _ = req.Args[1].(string)
+	default:
+		req.CloseWithError(errors.Errorf("usage: names.set @feed.ed25519 name"))
+		return
+	}
+	feed, err := ssb.ParseFeedRef(feedStr)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request - invalid feed"))
+		return
+	}
+	if h.lookup.Petnames == nil {
+		req.CloseWithError(errors.Errorf("names.set: no petname store"))
+		return
+	}
+
+	if err := h.lookup.Petnames.Set(feed, name); err != nil {
+		req.CloseWithError(errors.Wrap(err, "names.set failed"))
+		return
+	}
+	if err := req.Return(ctx, true); err != nil {
+		req.CloseWithError(errors.Wrap(err, "names.set: failed to return"))
+	}
+}
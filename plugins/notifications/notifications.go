@@ -0,0 +1,253 @@
+// Package notifications offers the notifications of the local identity (see indexes.NotificationIndex) over muxrpc.
+// Which of them were read is kept for each client, see ReadState.
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// DefaultClient is the client of the calls that don't name one
+const DefaultClient = "default"
+
+// Update is what notifications.stream sends for every notification
+type Update struct {
+	Key       *ssb.MessageRef `json:"key"` // of the message, used by notifications.markRead
+	Author    *ssb.FeedRef    `json:"author"`
+	Kinds     []string        `json:"kinds"`            // see indexes.NotifyReply and the others
+	Target    *ssb.MessageRef `json:"target,omitempty"` // our message that was replied to or voted on
+	Timestamp int64           `json:"timestamp"`        // when we received it, in milliseconds
+	Read      bool            `json:"read"`
+}
+
+type plugin struct {
+	h muxrpc.Handler
+}
+
+// New returns the notifications.stream and notifications.markRead calls.
+//
+// notifications.stream sends an Update for every notification, {old: false, live: true} only the new ones and {unread: true} only the ones client didn't read.
+// With {live: true, sync: true} it sends {sync: true} between the old and the new ones.
+// notifications.markRead takes {client, keys: [msgkey...]} or {client, all: true} and marks the notifications as read.
+// Both take the name of the client in {client}, it defaults to DefaultClient.
+func New(rootLog margaret.Log, idx indexes.NotificationIndex, state *ReadState) ssb.Plugin {
+	return plugin{
+		h: handler{
+			root:  rootLog,
+			idx:   idx,
+			state: state,
+		},
+	}
+}
+
+func (p plugin) Name() string { return "notifications" }
+
+func (p plugin) Method() muxrpc.Method {
+	return muxrpc.Method{"notifications"}
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type handler struct {
+	root  margaret.Log
+	idx   indexes.NotificationIndex
+	state *ReadState
+}
+
+func (h handler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	switch req.Method.String() {
+	case "notifications.stream":
+		h.stream(ctx, req)
+	case "notifications.markRead":
+		h.markRead(ctx, req)
+	default:
+		req.CloseWithError(errors.Errorf("unknown command: %s", req.Method))
+	}
+}
+
+// clientArgs returns the first argument of req as a map and the client in it
+func clientArgs(req *muxrpc.Request) (map[string]interface{}, string, error) {
+	if len(req.Args) < 1 {
+		return map[string]interface{}{}, DefaultClient, nil
+	}
+	args, ok := req.Args[0].(map[string]interface{})
+	if !ok {
+		return nil, "", errors.Errorf("invalid argument type %T", req.Args[0])
+	}
+	client := DefaultClient
+	if cv, has := args["client"]; has {
+		client, ok = cv.(string)
+		if !ok || client == "" {
+			return nil, "", errors.Errorf("bad request - client needs to be a name")
+		}
+	}
+	return args, client, nil
+}
+
+func (h handler) stream(ctx context.Context, req *muxrpc.Request) {
+	args, client, err := clientArgs(req)
+	if err != nil {
+		req.CloseWithError(err)
+		return
+	}
+	qry, err := message.NewCreateHistArgsFromMap(args)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request"))
+		return
+	}
+	unread, _ := args["unread"].(bool)
+
+	send := func(n indexes.Notification) error {
+		v, err := h.root.Get(margaret.BaseSeq(n.Seq))
+		if err != nil {
+			return errors.Wrap(err, "failed to get message")
+		}
+		msg, ok := v.(message.StoredMessage)
+		if !ok {
+			if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+				return nil
+			}
+			return errors.Errorf("wrong message type. expected %T - got %T", msg, v)
+		}
+		received := msg.Timestamp.UnixNano() / 1000000
+		read := h.state.IsRead(client, msg.Key, received)
+		if unread && read {
+			return nil
+		}
+		b, err := json.Marshal(Update{
+			Key:       msg.Key,
+			Author:    msg.Author,
+			Kinds:     n.Kinds,
+			Target:    n.Target,
+			Timestamp: received,
+			Read:      read,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to encode update")
+		}
+		return req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: b})
+	}
+
+	// registered before going through the old ones, so that none are missed in between.
+	// the buffer holds the new ones while the old ones are sent, the index waits when it's full.
+	// done is closed once this returns, so that the index doesn't wait for a stream that is gone.
+	var live chan indexes.Notification
+	if qry.Live {
+		live = make(chan indexes.Notification, 64)
+		done := make(chan struct{})
+		defer close(done)
+		cancel := h.idx.Changes().Register(luigi.FuncSink(func(_ context.Context, v interface{}, err error) error {
+			if err != nil {
+				return nil
+			}
+			n, ok := v.(indexes.Notification)
+			if !ok {
+				return errors.Errorf("notifications: wrong update type %T", v)
+			}
+			select {
+			case live <- n:
+				return nil
+			case <-done:
+				return nil
+			}
+		}))
+		defer cancel()
+	}
+
+	var last int64 = -1
+	if qry.WantOld() {
+		err := h.idx.Notifications(-1, func(n indexes.Notification) error {
+			last = n.Seq
+			return send(n)
+		})
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "notifications.stream: failed to send notifications"))
+			return
+		}
+	}
+
+	if !qry.Live {
+		req.Stream.Close()
+		return
+	}
+	if qry.Sync && qry.WantOld() {
+		if err := req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: message.SyncMarker}); err != nil {
+			req.CloseWithError(errors.Wrap(err, "notifications.stream: failed to send sync marker"))
+			return
+		}
+	}
+	for {
+		select {
+		case n := <-live:
+			if n.Seq <= last {
+				continue // already sent
+			}
+			last = n.Seq
+			if err := send(n); err != nil {
+				req.CloseWithError(errors.Wrap(err, "notifications.stream: failed to send notification"))
+				return
+			}
+		case <-ctx.Done():
+			req.Stream.Close()
+			return
+		}
+	}
+}
+
+func (h handler) markRead(ctx context.Context, req *muxrpc.Request) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: notifications.markRead {client, keys: [msgkey...]} or {client, all: true}"))
+		return
+	}
+	args, client, err := clientArgs(req)
+	if err != nil {
+		req.CloseWithError(err)
+		return
+	}
+
+	if all, _ := args["all"].(bool); all {
+		err = h.state.MarkAllRead(client, time.Now().UnixNano()/1000000+1)
+	} else {
+		list, ok := args["keys"].([]interface{})
+		if !ok {
+			req.CloseWithError(errors.Errorf("bad request - keys needs to be a list of message keys"))
+			return
+		}
+		keys := make([]*ssb.MessageRef, len(list))
+		for i, kv := range list {
+			ks, ok := kv.(string)
+			if !ok {
+				req.CloseWithError(errors.Errorf("bad request - keys needs to be a list of message keys, not %T", kv))
+				return
+			}
+			keys[i], err = ssb.ParseMessageRef(ks)
+			if err != nil {
+				req.CloseWithError(errors.Wrapf(err, "bad request - invalid message key %q", ks))
+				return
+			}
+		}
+		err = h.state.MarkRead(client, keys...)
+	}
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "notifications.markRead failed"))
+		return
+	}
+
+	if err := req.Return(ctx, true); err != nil {
+		req.CloseWithError(errors.Wrap(err, "notifications.markRead: failed to return"))
+	}
+}
@@ -0,0 +1,128 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// ReadStateFileName is where the read state of the clients is stored in the repo.
+// It's not part of the index, so that it survives rebuilding it.
+const ReadStateFileName = "notifications.json"
+
+// clientState is what one client has read.
+// It refers to messages by their key and receive time, not by their sequence in the root log,
+// since that changes when the log is compacted.
+type clientState struct {
+	Before int64    `json:"before"`         // all notifications received before this, in milliseconds
+	Read   []string `json:"read,omitempty"` // and the ones for the messages with these keys, sorted
+}
+
+func (cs clientState) isRead(key string, received int64) bool {
+	if received < cs.Before {
+		return true
+	}
+	i := sort.SearchStrings(cs.Read, key)
+	return i < len(cs.Read) && cs.Read[i] == key
+}
+
+// ReadState keeps track of the notifications each client has read
+type ReadState struct {
+	mu      sync.Mutex
+	path    string // empty for memory repos
+	clients map[string]clientState
+}
+
+// OpenReadState loads the read state of the repo
+func OpenReadState(r repo.Interface) (*ReadState, error) {
+	rs := &ReadState{clients: make(map[string]clientState)}
+	if repo.IsMemory(r) {
+		return rs, nil
+	}
+	rs.path = r.GetPath(ReadStateFileName)
+
+	b, err := ioutil.ReadFile(rs.path)
+	if os.IsNotExist(err) {
+		return rs, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "notifications: failed to read state file")
+	}
+	if err := json.Unmarshal(b, &rs.clients); err != nil {
+		return nil, errors.Wrap(err, "notifications: failed to decode state file")
+	}
+	return rs, nil
+}
+
+// IsRead returns true if client marked the notification for the message with key as read.
+// received is the time the message was received at, in milliseconds.
+func (rs *ReadState) IsRead(client string, key *ssb.MessageRef, received int64) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.clients[client].isRead(key.Ref(), received)
+}
+
+// MarkRead marks the notifications for the messages with the passed keys as read by client
+func (rs *ReadState) MarkRead(client string, keys ...*ssb.MessageRef) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	old := rs.clients[client]
+	cs := clientState{Before: old.Before, Read: append([]string{}, old.Read...)}
+	for _, key := range keys {
+		ref := key.Ref()
+		i := sort.SearchStrings(cs.Read, ref)
+		if i < len(cs.Read) && cs.Read[i] == ref {
+			continue
+		}
+		cs.Read = append(cs.Read, "")
+		copy(cs.Read[i+1:], cs.Read[i:])
+		cs.Read[i] = ref
+	}
+	return rs.set(client, old, cs)
+}
+
+// MarkAllRead marks all notifications for messages received before the passed time (in milliseconds) as read by client.
+// The keys that were marked one by one are forgotten, so before needs to be later than any message they belong to.
+func (rs *ReadState) MarkAllRead(client string, before int64) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	old := rs.clients[client]
+	if before < old.Before {
+		return nil
+	}
+	return rs.set(client, old, clientState{Before: before})
+}
+
+// set replaces the state of client and saves it, keeping the old one if that fails
+func (rs *ReadState) set(client string, old, cs clientState) error {
+	rs.clients[client] = cs
+	if err := rs.save(); err != nil {
+		rs.clients[client] = old
+		return err
+	}
+	return nil
+}
+
+// save writes the state to a temporary file and moves it over the old one
+func (rs *ReadState) save() error {
+	if rs.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(rs.clients, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "notifications: failed to encode state")
+	}
+	tmp := rs.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrap(err, "notifications: failed to write state file")
+	}
+	return errors.Wrap(os.Rename(tmp, rs.path), "notifications: failed to replace state file")
+}
@@ -0,0 +1,48 @@
+package notifications
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestReadState(t *testing.T) {
+	r := require.New(t)
+
+	dir, err := ioutil.TempDir("", "notifications")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	key := func(i int) *ssb.MessageRef {
+		return &ssb.MessageRef{Algo: "sha256", Hash: []byte(fmt.Sprintf("%032d", i))}
+	}
+
+	rs, err := OpenReadState(repo.New(dir))
+	r.NoError(err)
+	r.False(rs.IsRead("phone", key(0), 0))
+
+	r.NoError(rs.MarkRead("phone", key(7), key(3)))
+	r.NoError(rs.MarkRead("phone", key(3)))
+	r.NoError(rs.MarkRead("laptop", key(12)))
+	r.True(rs.IsRead("phone", key(3), 300))
+	r.True(rs.IsRead("phone", key(7), 700))
+	r.False(rs.IsRead("phone", key(5), 500))
+	r.False(rs.IsRead("phone", key(12), 1200), "clients have their own state")
+
+	r.NoError(rs.MarkAllRead("phone", 800))
+	r.NoError(rs.MarkAllRead("phone", 200), "doesn't go back")
+
+	rs, err = OpenReadState(repo.New(dir))
+	r.NoError(err)
+	for i, read := range map[int]bool{0: true, 5: true, 7: true, 8: false, 9: false} {
+		r.Equal(read, rs.IsRead("phone", key(i), int64(i*100)), "msg %d", i)
+	}
+	r.True(rs.IsRead("laptop", key(12), 1200))
+	r.False(rs.IsRead("laptop", key(11), 1100))
+}
@@ -0,0 +1,104 @@
+// Package query offers query.read, which streams the messages that match a declarative filter (see package go.cryptoscope.co/ssb/query).
+package query
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/query"
+)
+
+// ~> sbot query.read --help
+// (query) Stream the messages that match a filter.
+// query '{"value": {"content": {"type": "post"}}}' [--live] [--reverse] [--limit n] [--sort path] [--keys]
+//
+// The multilogs are used for filters on the author, tangle root or type, otherwise it scans all messages.
+type plugin struct {
+	h muxrpc.Handler
+}
+
+// New returns the query.read call. The multilogs may be nil.
+func New(rootLog margaret.Log, userFeeds, types, tangles multilog.MultiLog) ssb.Plugin {
+	return plugin{
+		h: handler{
+			src: query.Sources{
+				Root:      rootLog,
+				UserFeeds: userFeeds,
+				Types:     types,
+				Tangles:   tangles,
+			},
+		},
+	}
+}
+
+func (p plugin) Name() string { return "query" }
+
+func (p plugin) Method() muxrpc.Method {
+	return muxrpc.Method{"query", "read"}
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type handler struct {
+	src query.Sources
+}
+
+func (h handler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: query.read {query: [{$filter: {...}}]}"))
+		return
+	}
+	argMap, ok := req.Args[0].(map[string]interface{})
+	if !ok {
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+	qry, err := query.ParseArgs(argMap)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request"))
+		return
+	}
+	keys := true
+	if v, has := argMap["keys"]; has {
+		keys, ok = v.(bool)
+		if !ok {
+			req.CloseWithError(errors.Errorf("bad request: keys needs to be a bool, not %T", v))
+			return
+		}
+	}
+
+	src, err := h.src.Run(qry)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "query: failed to run query"))
+		return
+	}
+
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return err
+		}
+		msg, ok := v.([]byte)
+		if !ok {
+			return errors.Errorf("b4pour: expected []byte - got %T", v)
+		}
+		return req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: msg})
+	})
+	err = luigi.Pump(ctx, snk, transform.NewKeyValueWrapper(src, keys))
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "query: failed to pump messages"))
+		return
+	}
+	req.Stream.Close()
+}
@@ -0,0 +1,195 @@
+package rawread
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/internal/mutil"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+)
+
+// ~> sbot channels --help
+// (channels) Stream the messages of a channel, with content.channel or a #hashtag mention of it.
+// channels.read {name: channel} [--live] [--limit n] [--reverse] [--keys]
+//
+// channels.list returns [{name, messages, subscribers}] for every channel we have messages of.
+// channels.subscriptions returns the channels a feed subscribed to: channels.subscriptions @feed
+type channelPlug struct {
+	h muxrpc.Handler
+}
+
+func NewChannelPlug(root margaret.Log, channels multilog.MultiLog, subs indexes.SubscriptionIndex) ssb.Plugin {
+	return channelPlug{
+		h: channelHandler{
+			root:     root,
+			channels: channels,
+			subs:     subs,
+		},
+	}
+}
+
+func (channelPlug) Name() string { return "channels" }
+
+func (channelPlug) Method() muxrpc.Method {
+	return muxrpc.Method{"channels"}
+}
+
+func (p channelPlug) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type channelHandler struct {
+	root     margaret.Log
+	channels multilog.MultiLog
+	subs     indexes.SubscriptionIndex
+}
+
+// Channel is what channels.list returns for every channel
+type Channel struct {
+	Name        string `json:"name"`
+	Messages    int64  `json:"messages"`
+	Subscribers int    `json:"subscribers"`
+}
+
+func (g channelHandler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (g channelHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	switch req.Method.String() {
+	case "channels.list":
+		g.list(ctx, req)
+	case "channels.read":
+		g.read(ctx, req)
+	case "channels.subscriptions":
+		g.subscriptions(ctx, req)
+	default:
+		req.CloseWithError(errors.Errorf("unknown command: %s", req.Method))
+	}
+}
+
+func (g channelHandler) list(ctx context.Context, req *muxrpc.Request) {
+	addrs, err := g.channels.List()
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "channels.list: failed to list channels"))
+		return
+	}
+
+	list := make([]Channel, 0, len(addrs))
+	for _, addr := range addrs {
+		sublog, err := g.channels.Get(addr)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "channels.list: failed to open channel"))
+			return
+		}
+		sv, err := sublog.Seq().Value()
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "channels.list: failed to get channel length"))
+			return
+		}
+		ch := Channel{Name: string(addr)}
+		if seq, ok := sv.(margaret.Seq); ok { // empty sublogs are unset
+			ch.Messages = seq.Seq() + 1
+		}
+		subscribers, err := g.subs.Subscribers(ch.Name)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "channels.list: failed to get subscribers"))
+			return
+		}
+		ch.Subscribers = len(subscribers)
+		list = append(list, ch)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	if err := req.Return(ctx, list); err != nil {
+		req.CloseWithError(errors.Wrap(err, "channels.list: failed to return channels"))
+	}
+}
+
+func (g channelHandler) read(ctx context.Context, req *muxrpc.Request) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: channels.read {name: channel}"))
+		return
+	}
+	var (
+		qry  message.CreateHistArgs
+		name string
+	)
+	switch v := req.Args[0].(type) {
+	case string:
+		name = v
+		qry.Limit = -1
+	case map[string]interface{}:
+		name, _ = v["name"].(string)
+		q, err := message.NewCreateHistArgsFromMap(v)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "bad request"))
+			return
+		}
+		qry = *q
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+	ch, ok := multilogs.NormalizeChannel(name)
+	if !ok {
+		req.CloseWithError(errors.Errorf("bad request - invalid channel name %q", name))
+		return
+	}
+
+	chLog, err := g.channels.Get(librarian.Addr(ch))
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "failed to load channel"))
+		return
+	}
+
+	err = transform.PourLog(ctx, req, mutil.Indirect(g.root, chLog), qry, nil)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "channels.read: failed to pump msgs"))
+		return
+	}
+
+	req.Stream.Close()
+}
+
+func (g channelHandler) subscriptions(ctx context.Context, req *muxrpc.Request) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: channels.subscriptions @feed.ed25519"))
+		return
+	}
+	var feedStr string
+	switch v := req.Args[0].(type) {
+	case string:
+		feedStr = v
+	case map[string]interface{}:
+		feedStr, _ = v["id"].(string)
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+	feed, err := ssb.ParseFeedRef(feedStr)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request - invalid feed"))
+		return
+	}
+
+	channels, err := g.subs.Subscriptions(feed)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "channels.subscriptions failed"))
+		return
+	}
+	if channels == nil {
+		channels = []string{}
+	}
+	if err := req.Return(ctx, channels); err != nil {
+		req.CloseWithError(errors.Wrap(err, "channels.subscriptions: failed to return channels"))
+	}
+}
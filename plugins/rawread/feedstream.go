@@ -0,0 +1,261 @@
+package rawread
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// ~> sbot createFeedStream --help
+// (feed) Fetch messages ordered by their claimed timestamps.
+// feed [--live] [--gt ts] [--gte ts] [--lt ts] [--lte ts] [--reverse] [--keys] [--limit n] [--old false] [--sync]
+//
+// Timestamps that are later than the time we received the message are treated as the receive time.
+type feedStreamPlug struct {
+	h muxrpc.Handler
+}
+
+func NewFeedStream(rootLog margaret.Log, timestamps indexes.TimestampIndex) ssb.Plugin {
+	plug := &feedStreamPlug{}
+	plug.h = feedStreamHandler{
+		root:       rootLog,
+		timestamps: timestamps,
+	}
+	return plug
+}
+
+func (lt feedStreamPlug) Name() string { return "createFeedStream" }
+
+func (feedStreamPlug) Method() muxrpc.Method {
+	return muxrpc.Method{"createFeedStream"}
+}
+func (lt feedStreamPlug) Handler() muxrpc.Handler {
+	return lt.h
+}
+
+type feedStreamHandler struct {
+	root       margaret.Log
+	timestamps indexes.TimestampIndex
+}
+
+func (g feedStreamHandler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {
+}
+
+func (g feedStreamHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	qry := message.CreateHistArgs{Keys: true, Limit: -1}
+	if len(req.Args) > 0 {
+		argMap, ok := req.Args[0].(map[string]interface{})
+		if !ok {
+			req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+			return
+		}
+		q, err := message.NewCreateHistArgsFromMap(argMap)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "bad request"))
+			return
+		}
+		qry = *q
+		if _, has := argMap["keys"]; !has {
+			qry.Keys = true
+		}
+	}
+	if qry.Live && qry.Reverse {
+		req.CloseWithError(errors.Errorf("bad request: live and reverse can't be combined"))
+		return
+	}
+	tsQry := indexes.TimestampQuery{
+		Gt:      qry.After(),
+		Lt:      qry.Before(),
+		Reverse: qry.Reverse,
+		Limit:   -1, // some entries might be skipped, the limit is applied while sending
+	}
+
+	// the live part starts after this, older messages come from the index
+	sv, err := g.root.Seq().Value()
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "feedStream: failed to get root log sequence"))
+		return
+	}
+	liveFrom := sv.(margaret.Seq).Seq()
+
+	// the ones the index doesn't have yet are read from the root log and merged in
+	indexed, err := g.timestamps.Seq()
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "feedStream: failed to get indexed sequence"))
+		return
+	}
+	if indexed > liveFrom {
+		indexed = liveFrom
+	}
+
+	var sent int64
+	pour := func(msg message.StoredMessage) error {
+		if qry.Limit >= 0 && sent >= qry.Limit {
+			return errFeedStreamDone
+		}
+		raw := msg.Raw
+		if qry.Keys {
+			var err error
+			raw, err = json.Marshal(message.KeyValueRaw{
+				Key:       msg.Key,
+				Value:     msg.Raw,
+				Timestamp: msg.Timestamp.UnixNano() / 1000000,
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed to encode message")
+			}
+		}
+		sent++
+		return req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: raw})
+	}
+
+	if qry.WantOld() {
+		gap, err := g.unindexed(indexed, liveFrom, tsQry)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "feedStream: failed to read unindexed messages"))
+			return
+		}
+		// sends the ones from the gap that come before the entry at ts and seq
+		pourGap := func(ts, seq int64) error {
+			for len(gap) > 0 && gap[0].before(ts, seq, qry.Reverse) {
+				if err := pour(gap[0].msg); err != nil {
+					return err
+				}
+				gap = gap[1:]
+			}
+			return nil
+		}
+
+		err = indexes.IterateTimestamps(g.timestamps, tsQry, func(ts int64, seq margaret.Seq) error {
+			if seq.Seq() > indexed {
+				return nil // in the gap or live
+			}
+			if err := pourGap(ts, seq.Seq()); err != nil {
+				return err
+			}
+			v, err := g.root.Get(seq)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get message %d", seq.Seq())
+			}
+			msg, ok := v.(message.StoredMessage)
+			if !ok {
+				if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+					return nil
+				}
+				return errors.Errorf("wrong message type. expected %T - got %T", msg, v)
+			}
+			return pour(msg)
+		})
+		if err == nil {
+			for _, e := range gap {
+				if err = pour(e.msg); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil && errors.Cause(err) != errFeedStreamDone {
+			req.CloseWithError(errors.Wrap(err, "feedStream: failed to send messages"))
+			return
+		}
+	}
+
+	if !qry.Live || (qry.Limit >= 0 && sent >= qry.Limit) {
+		req.Stream.Close()
+		return
+	}
+
+	if qry.Sync && qry.WantOld() {
+		if err := req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: message.SyncMarker}); err != nil {
+			req.CloseWithError(errors.Wrap(err, "feedStream: failed to send sync marker"))
+			return
+		}
+	}
+
+	src, err := g.root.Query(margaret.Gt(margaret.BaseSeq(liveFrom)), margaret.Live(true))
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "feedStream: failed to query root log"))
+		return
+	}
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return err
+		}
+		msg, ok := v.(message.StoredMessage)
+		if !ok {
+			if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+				return nil
+			}
+			return errors.Errorf("wrong message type. expected %T - got %T", msg, v)
+		}
+		ts, err := indexes.FeedTimestamp(msg)
+		if err != nil || !tsQry.Matches(ts) {
+			return nil
+		}
+		if err := pour(msg); err != nil {
+			return err
+		}
+		if qry.Limit >= 0 && sent >= qry.Limit {
+			return errFeedStreamDone
+		}
+		return nil
+	})
+	err = luigi.Pump(ctx, snk, src)
+	if err != nil && errors.Cause(err) != errFeedStreamDone {
+		req.CloseWithError(errors.Wrap(err, "feedStream: failed to pump live messages"))
+		return
+	}
+	req.Stream.Close()
+}
+
+var errFeedStreamDone = errors.Errorf("feedStream: limit reached")
+
+// gapEntry is a message that isn't in the timestamp index yet
+type gapEntry struct {
+	ts, seq int64
+	msg     message.StoredMessage
+}
+
+// before returns true if e is sent before the entry at ts and seq
+func (e gapEntry) before(ts, seq int64, reverse bool) bool {
+	less := e.ts < ts || (e.ts == ts && e.seq < seq)
+	if reverse {
+		return !less
+	}
+	return less
+}
+
+// unindexed returns the messages after the sequence indexed up to and including upto that match qry, in the order of the index
+func (g feedStreamHandler) unindexed(indexed, upto int64, qry indexes.TimestampQuery) ([]gapEntry, error) {
+	var gap []gapEntry
+	for seq := indexed + 1; seq <= upto; seq++ {
+		v, err := g.root.Get(margaret.BaseSeq(seq))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get message %d", seq)
+		}
+		msg, ok := v.(message.StoredMessage)
+		if !ok {
+			if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, errors.Errorf("wrong message type. expected %T - got %T", msg, v)
+		}
+		ts, err := indexes.FeedTimestamp(msg)
+		if err != nil || !qry.Matches(ts) {
+			continue
+		}
+		gap = append(gap, gapEntry{ts: ts, seq: seq, msg: msg})
+	}
+	sort.Slice(gap, func(i, j int) bool {
+		return gap[i].before(gap[j].ts, gap[j].seq, qry.Reverse)
+	})
+	return gap, nil
+}
@@ -0,0 +1,96 @@
+package rawread
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestFeedStream(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	rp := repo.NewMemory()
+	rootLog, err := repo.OpenLog(rp)
+	r.NoError(err)
+
+	tsIdx, _, serve, err := indexes.OpenTimestamps(rp)
+	r.NoError(err)
+
+	appendMsg := func(i int, claimed, received int64) {
+		_, err := rootLog.Append(message.StoredMessage{
+			Author:    &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+			Key:       &ssb.MessageRef{Algo: "sha256", Hash: []byte(fmt.Sprintf("%032d", i))},
+			Sequence:  margaret.BaseSeq(i + 1),
+			Timestamp: time.Unix(0, received*int64(time.Millisecond)),
+			Raw:       []byte(fmt.Sprintf(`{"sequence":%d,"timestamp":%d,"content":{"type":"test","i":%d}}`, i+1, claimed, i)),
+		})
+		r.NoError(err)
+	}
+
+	appendMsg(0, 30, 100)
+	appendMsg(1, 10, 101)
+	r.NoError(serve(ctx, rootLog, false))
+
+	// not indexed yet
+	appendMsg(2, 9999, 50) // from the future, sorts at the receive time
+	appendMsg(3, 20, 103)
+
+	cli, done := serveHandler(t, feedStreamHandler{root: rootLog, timestamps: tsIdx})
+	defer done()
+
+	open := func(args map[string]interface{}) luigi.Source {
+		src, err := cli.Source(ctx, map[string]interface{}{}, muxrpc.Method{"createFeedStream"}, args)
+		r.NoError(err)
+		return src
+	}
+	ids := func(msgs []map[string]interface{}) []int {
+		var got []int
+		for _, m := range msgs {
+			val, ok := m["value"].(map[string]interface{})
+			r.True(ok, "not a message: %v", m)
+			got = append(got, int(val["content"].(map[string]interface{})["i"].(float64)))
+		}
+		return got
+	}
+	read := func(args map[string]interface{}) []int {
+		return ids(readAll(t, open(args)))
+	}
+
+	r.Equal([]int{1, 3, 0, 2}, read(map[string]interface{}{}))
+	r.Equal([]int{2, 0, 3, 1}, read(map[string]interface{}{"reverse": true}))
+	r.Equal([]int{1, 3}, read(map[string]interface{}{"limit": 2}))
+	r.Equal([]int{2, 0, 3}, read(map[string]interface{}{"reverse": true, "limit": 3}))
+	r.Equal([]int{3, 0, 2}, read(map[string]interface{}{"gt": 15}))
+	r.Equal([]int{1, 3}, read(map[string]interface{}{"lt": 30}))
+
+	// old ones, sync marker, new ones
+	live := open(map[string]interface{}{"live": true, "sync": true})
+	var old []map[string]interface{}
+	for i := 0; i < 4; i++ {
+		old = append(old, next(t, live))
+	}
+	r.Equal([]int{1, 3, 0, 2}, ids(old))
+	r.Equal(true, next(t, live)["sync"])
+	appendMsg(4, 60, 104)
+	r.Equal([]int{4}, ids([]map[string]interface{}{next(t, live)}))
+
+	// the limit counts both parts
+	limited := open(map[string]interface{}{"live": true, "limit": 6})
+	for i := 0; i < 5; i++ {
+		r.NotNil(next(t, limited))
+	}
+	appendMsg(5, 70, 105)
+	r.Equal([]int{5}, ids(readAll(t, limited)))
+}
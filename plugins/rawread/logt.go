@@ -3,10 +3,8 @@ package rawread
 import (
 	"context"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/pkg/errors"
 	"go.cryptoscope.co/librarian"
-	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/margaret/multilog"
 	"go.cryptoscope.co/muxrpc"
@@ -19,7 +17,11 @@ import (
 
 //  messagesByType --help
 // (logt) Retrieve messages with a given type, ordered by receive-time.
-// logt --type {type} [--gt index] [--gte index] [--lt index] [--lte index] [--reverse]  [--keys] [--values] [--limit n]
+// logt --type {type} [--gt ts] [--gte ts] [--lt ts] [--lte ts] [--reverse]  [--keys] [--values] [--limit n] [--old false] [--sync]
+//
+// Note: the bounds are receive times in milliseconds, like the ones of createLogStream.
+// They used to be documented as indexes into the sublog of the type (which were ignored).
+// This is an incompatible change for callers that pass sequence numbers: a small gt now matches every message and a small lt none.
 type logTplug struct {
 	h muxrpc.Handler
 }
@@ -69,13 +71,13 @@ func (g logThandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp mu
 			return
 		}
 		qry = *q
+		tipe = librarian.Addr(qry.Type)
 	default:
 		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
 		return
 	}
 
 	if len(req.Args) == 2 {
-		spew.Dump(req.Args)
 		mv, ok := req.Args[1].(map[string]interface{})
 		if !ok {
 			req.CloseWithError(errors.Errorf("bad request"))
@@ -87,7 +89,7 @@ func (g logThandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp mu
 			return
 		}
 		qry = *q
-	} else {
+	} else if _, onlyType := req.Args[0].(string); onlyType {
 		qry.Limit = -1
 		// TODO: msg should be wrapped in obj with key and rxt
 		qry.Keys = true
@@ -102,25 +104,7 @@ func (g logThandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp mu
 		return
 	}
 
-	resolved := mutil.Indirect(g.root, tipeLog)
-	src, err := resolved.Query(margaret.Limit(int(qry.Limit)), margaret.Live(qry.Live))
-	if err != nil {
-		req.CloseWithError(errors.Wrap(err, "logT: failed to qry tipe"))
-		return
-	}
-
-	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
-		if err != nil {
-			return err
-		}
-		msg, ok := v.([]byte)
-		if !ok {
-			return errors.Errorf("b4pour: expected []byte - got %T", v)
-		}
-		return req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: msg})
-	})
-
-	err = luigi.Pump(ctx, snk, transform.NewKeyValueWrapper(src, qry.Keys))
+	err = transform.PourLog(ctx, req, mutil.Indirect(g.root, tipeLog), qry, nil)
 	if err != nil {
 		req.CloseWithError(errors.Wrap(err, "logT: failed to pump msgs"))
 		return
@@ -0,0 +1,75 @@
+package rawread
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb/plugins/test"
+)
+
+// serveHandler connects a client to a server that answers with h.
+// The returned function shuts both down.
+func serveHandler(t *testing.T, h muxrpc.Handler) (muxrpc.Endpoint, func()) {
+	srvRepo, srvPath := test.MakeEmptyPeer(t)
+	cliRepo, cliPath := test.MakeEmptyPeer(t)
+
+	pkr1, pkr2, _, serve := test.PrepareConnectAndServe(t, srvRepo, cliRepo)
+	srv := muxrpc.Handle(pkr1, h)
+	cli := muxrpc.Handle(pkr2, noCalls{})
+	finish := serve(srv, cli)
+
+	return cli, func() {
+		finish()
+		os.RemoveAll(srvPath)
+		os.RemoveAll(cliPath)
+	}
+}
+
+// noCalls is the handler of the client side
+type noCalls struct{}
+
+func (noCalls) HandleConnect(context.Context, muxrpc.Endpoint) {}
+
+func (noCalls) HandleCall(ctx context.Context, req *muxrpc.Request, _ muxrpc.Endpoint) {
+	req.CloseWithError(errors.Errorf("test client: no calls"))
+}
+
+// readAll returns all the values of the stream
+func readAll(t *testing.T, src luigi.Source) []map[string]interface{} {
+	var got []map[string]interface{}
+	for {
+		v := next(t, src)
+		if v == nil {
+			return got
+		}
+		got = append(got, v)
+	}
+}
+
+// next returns the next value of the stream or nil if it ended
+func next(t *testing.T, src luigi.Source) map[string]interface{} {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	v, err := src.Next(ctx)
+	if luigi.IsEOS(err) {
+		return nil
+	}
+	require.NoError(t, err)
+
+	b, ok := v.(json.RawMessage)
+	if !ok {
+		b, err = json.Marshal(v)
+		require.NoError(t, err)
+	}
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &m))
+	return m
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
-	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/muxrpc"
 
@@ -15,7 +14,15 @@ import (
 
 // ~> sbot createLogStream --help
 // (log) Fetch messages ordered by the time received.
-// log [--live] [--gt index] [--gte index] [--lt index] [--lte index] [--reverse]  [--keys] [--values] [--limit n]
+// log [--live] [--gt ts] [--gte ts] [--lt ts] [--lte ts] [--reverse]  [--keys] [--values] [--limit n]
+//
+// The bounds are receive times in milliseconds. Additionally:
+// --old false             only live messages
+// --sync                  send {sync: true} once the old messages are sent
+// --receivedFrom feed     only messages that peer sent us
+// --receivedAfter ms      only messages received after that time
+// --receivedBefore ms     only messages received before that time
+// --provenance            add receivedFrom to the returned {key, value, timestamp} objects
 type rxLogPlug struct {
 	h muxrpc.Handler
 }
@@ -65,33 +72,9 @@ func (g rxLogHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp m
 		return
 	}
 
-	if qry.Live {
-		qry.Limit = -1
-	}
-
-	// // only return message keys
-	// qry.Values = true
-
-	src, err := g.root.Query(margaret.Limit(int(qry.Limit)), margaret.Live(qry.Live), margaret.Reverse(qry.Reverse))
-	if err != nil {
-		req.CloseWithError(errors.Wrap(err, "logT: failed to qry tipe"))
-		return
-	}
-
-	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
-		if err != nil {
-			return err
-		}
-		msg, ok := v.([]byte)
-		if !ok {
-			return errors.Errorf("b4pour: expected []byte - got %T", v)
-		}
-		return req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: msg})
-	})
-
-	err = luigi.Pump(ctx, snk, transform.NewKeyValueWrapper(src, qry.Keys))
+	err := transform.PourLog(ctx, req, g.root, qry, nil)
 	if err != nil {
-		req.CloseWithError(errors.Wrap(err, "logT: failed to pump msgs"))
+		req.CloseWithError(errors.Wrap(err, "createLogStream failed"))
 		return
 	}
 
@@ -0,0 +1,157 @@
+package rawread
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestLogStreams(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rp := repo.NewMemory()
+	rootLog, err := repo.OpenLog(rp)
+	r.NoError(err)
+
+	types, _, serveTypes, err := multilogs.OpenMessageTypes(rp)
+	r.NoError(err)
+	tangles, _, serveTangles, err := multilogs.OpenTangles(rp)
+	r.NoError(err)
+	for _, serve := range []repo.ServeFunc{serveTypes, serveTangles} {
+		go serve(ctx, rootLog, true)
+	}
+
+	key := func(i int) *ssb.MessageRef {
+		return &ssb.MessageRef{Algo: "sha256", Hash: []byte(fmt.Sprintf("%032d", i))}
+	}
+	thread := key(0)
+	appendMsg := func(i int, tipe string, reply bool) {
+		var root string
+		if reply {
+			root = fmt.Sprintf(`,"root":%q`, thread.Ref())
+		}
+		_, err := rootLog.Append(message.StoredMessage{
+			Author:    &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+			Key:       key(i),
+			Sequence:  margaret.BaseSeq(i + 1),
+			Timestamp: time.Unix(0, int64(100+i)*int64(time.Millisecond)),
+			Raw:       []byte(fmt.Sprintf(`{"sequence":%d,"content":{"type":%q,"i":%d%s}}`, i+1, tipe, i, root)),
+		})
+		r.NoError(err)
+	}
+	// waits until the sublog has n entries
+	indexed := func(mlog multilog.MultiLog, addr librarian.Addr, n int64) {
+		for i := 0; ; i++ {
+			sublog, err := mlog.Get(addr)
+			r.NoError(err)
+			v, err := sublog.Seq().Value()
+			r.NoError(err)
+			if seq, ok := v.(margaret.Seq); ok && seq.Seq() == n-1 {
+				return
+			}
+			r.True(i < 100, "sublog wasn't updated")
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	appendMsg(0, "post", false)
+	appendMsg(1, "vote", false)
+	appendMsg(2, "post", true)
+	appendMsg(3, "post", true)
+	appendMsg(4, "post", false)
+	indexed(types, librarian.Addr("post"), 4)
+	indexed(tangles, multilogs.TangleAddr("", thread), 2)
+
+	logCli, done := serveHandler(t, rxLogHandler{root: rootLog})
+	defer done()
+	typeCli, done := serveHandler(t, logThandler{root: rootLog, types: types})
+	defer done()
+	tangleCli, done := serveHandler(t, tangleHandler{root: rootLog, tangle: tangles})
+	defer done()
+
+	type stream struct {
+		cli    muxrpc.Endpoint
+		method muxrpc.Method
+		args   map[string]interface{}
+	}
+	streams := map[string]stream{
+		"log":     {logCli, muxrpc.Method{"createLogStream"}, map[string]interface{}{}},
+		"type":    {typeCli, muxrpc.Method{"messagesByType"}, map[string]interface{}{"type": "post"}},
+		"tangles": {tangleCli, muxrpc.Method{"tangles"}, map[string]interface{}{"root": thread.Ref()}},
+	}
+	open := func(name string, opts map[string]interface{}) luigi.Source {
+		s := streams[name]
+		args := map[string]interface{}{"keys": true}
+		for k, v := range s.args {
+			args[k] = v
+		}
+		for k, v := range opts {
+			args[k] = v
+		}
+		src, err := s.cli.Source(ctx, map[string]interface{}{}, s.method, args)
+		r.NoError(err)
+		return src
+	}
+	ids := func(msgs ...map[string]interface{}) []int {
+		var got []int
+		for _, m := range msgs {
+			val, ok := m["value"].(map[string]interface{})
+			r.True(ok, "not a message: %v", m)
+			got = append(got, int(val["content"].(map[string]interface{})["i"].(float64)))
+		}
+		return got
+	}
+	read := func(name string, opts map[string]interface{}) []int {
+		return ids(readAll(t, open(name, opts))...)
+	}
+
+	r.Equal([]int{0, 1, 2, 3, 4}, read("log", nil))
+	r.Equal([]int{4, 3, 2, 1, 0}, read("log", map[string]interface{}{"reverse": true}))
+	r.Equal([]int{2, 3}, read("log", map[string]interface{}{"gt": 101, "lt": 104}))
+	r.Equal([]int{0, 1}, read("log", map[string]interface{}{"limit": 2}))
+
+	r.Equal([]int{0, 2, 3, 4}, read("type", nil))
+	r.Equal([]int{4, 3, 2, 0}, read("type", map[string]interface{}{"reverse": true}))
+	r.Equal([]int{2, 3, 4}, read("type", map[string]interface{}{"gte": 102}))
+
+	r.Equal([]int{2, 3}, read("tangles", nil))
+	r.Equal([]int{3}, read("tangles", map[string]interface{}{"reverse": true, "limit": 1}))
+
+	// old ones, sync marker, one live one and then the limit ends the stream
+	old := map[string][]int{
+		"log":     {0, 1, 2, 3, 4},
+		"type":    {0, 2, 3, 4},
+		"tangles": {2, 3},
+	}
+	live := make(map[string]luigi.Source)
+	for name, want := range old {
+		src := open(name, map[string]interface{}{"live": true, "sync": true, "limit": len(want) + 1})
+		var got []map[string]interface{}
+		for range want {
+			got = append(got, next(t, src))
+		}
+		r.Equal(want, ids(got...), name)
+		r.Equal(true, next(t, src)["sync"], name)
+		live[name] = src
+	}
+
+	appendMsg(5, "post", true)
+	for name, src := range live {
+		r.Equal([]int{5}, ids(readAll(t, src)...), name)
+	}
+}
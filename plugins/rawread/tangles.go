@@ -4,19 +4,23 @@ import (
 	"context"
 
 	"go.cryptoscope.co/ssb/internal/mutil"
-
-	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/multilogs"
 
 	"github.com/pkg/errors"
-	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/margaret/multilog"
 	"go.cryptoscope.co/muxrpc"
 	"go.cryptoscope.co/ssb"
-	"go.cryptoscope.co/ssb/internal/transform"
 	"go.cryptoscope.co/ssb/message"
 )
 
+// ~> sbot tangles --help
+// (tangles) Stream the messages of a tangle.
+// tangles --root %msg [--name tangle] [--live] [--limit n] [--reverse] [--keys]
+//
+// Without a name it returns the replies of a thread (content.root), otherwise the messages in content.tangles.<name>.
+// tangles.tips returns the messages a new one in the tangle lists as previous: tangles.tips {root, name}
 type tanglePlug struct {
 	h muxrpc.Handler
 }
@@ -47,6 +51,10 @@ type tangleHandler struct {
 func (g tangleHandler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
 
 func (g tangleHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	if req.Method.String() == "tangles.tips" {
+		g.tips(ctx, req)
+		return
+	}
 	if len(req.Args) < 1 {
 		req.CloseWithError(errors.Errorf("invalid arguments"))
 		return
@@ -54,6 +62,7 @@ func (g tangleHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp
 	var qry struct {
 		message.CreateHistArgs
 		Root *ssb.MessageRef
+		Name string
 	}
 
 	switch v := req.Args[0].(type) {
@@ -77,43 +86,62 @@ func (g tangleHandler) HandleCall(ctx context.Context, req *muxrpc.Request, edp
 			req.CloseWithError(errors.Wrap(err, "bad request - invalid root"))
 			return
 		}
+
+		if name, has := v["name"]; has {
+			qry.Name, ok = name.(string)
+			if !ok {
+				req.CloseWithError(errors.Errorf("bad request - name needs to be a string"))
+				return
+			}
+		}
 	default:
 		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
 		return
 	}
 
-	if qry.Live {
-		qry.Limit = -1
-	}
-
-	threadLog, err := g.tangle.Get(librarian.Addr(qry.Root.Hash))
+	threadLog, err := g.tangle.Get(multilogs.TangleAddr(qry.Name, qry.Root))
 	if err != nil {
 		req.CloseWithError(errors.Wrap(err, "failed to load thread"))
 		return
 	}
 
-	src, err := mutil.Indirect(g.root, threadLog).Query(margaret.Limit(int(qry.Limit)), margaret.Live(qry.Live), margaret.Reverse(qry.Reverse))
+	err = transform.PourLog(ctx, req, mutil.Indirect(g.root, threadLog), qry.CreateHistArgs, nil)
 	if err != nil {
-		req.CloseWithError(errors.Wrap(err, "logT: failed to qry tipe"))
+		req.CloseWithError(errors.Wrap(err, "logT: failed to pump msgs"))
 		return
 	}
 
-	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
-		if err != nil {
-			return err
-		}
-		msg, ok := v.([]byte)
-		if !ok {
-			return errors.Errorf("b4pour: expected []byte - got %T", v)
-		}
-		return req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: msg})
-	})
+	req.Stream.Close()
+}
 
-	err = luigi.Pump(ctx, snk, transform.NewKeyValueWrapper(src, qry.Keys))
+func (g tangleHandler) tips(ctx context.Context, req *muxrpc.Request) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: tangles.tips {root: %%msg, name: tangle}"))
+		return
+	}
+	args, ok := req.Args[0].(map[string]interface{})
+	if !ok {
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+	rootStr, _ := args["root"].(string)
+	root, err := ssb.ParseMessageRef(rootStr)
 	if err != nil {
-		req.CloseWithError(errors.Wrap(err, "logT: failed to pump msgs"))
+		req.CloseWithError(errors.Wrap(err, "bad request - invalid root"))
+		return
+	}
+	name, _ := args["name"].(string)
+	if name == "" {
+		req.CloseWithError(errors.Errorf("bad request - tips need the name of the tangle"))
 		return
 	}
 
-	req.Stream.Close()
+	tips, err := multilogs.TangleTips(g.root, g.tangle, name, root)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "tangles.tips failed"))
+		return
+	}
+	if err := req.Return(ctx, tips); err != nil {
+		req.CloseWithError(errors.Wrap(err, "tangles.tips: failed to return tips"))
+	}
 }
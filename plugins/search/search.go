@@ -0,0 +1,155 @@
+// Package search offers search.query, which finds posts and about descriptions by the words in them.
+package search
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/graph"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// ~> sbot search.query --help
+// (search) Stream the posts and abouts that contain all the words, best matches first.
+// search 'some words' [--limit n] [--hops n] [--keys]
+//
+// Words also match longer ones that start with them. Only messages of feeds within hops are returned, -1 for all of them.
+type plugin struct {
+	h muxrpc.Handler
+}
+
+// New returns the search.query call. hops is the default distance of the authors from self.
+func New(rootLog margaret.Log, idx indexes.SearchIndex, gb graph.Builder, self *ssb.FeedRef, hops int) ssb.Plugin {
+	return plugin{
+		h: handler{
+			root:  rootLog,
+			idx:   idx,
+			graph: gb,
+			self:  self,
+			hops:  hops,
+		},
+	}
+}
+
+func (p plugin) Name() string { return "search" }
+
+func (p plugin) Method() muxrpc.Method {
+	return muxrpc.Method{"search", "query"}
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type handler struct {
+	root  margaret.Log
+	idx   indexes.SearchIndex
+	graph graph.Builder
+	self  *ssb.FeedRef
+	hops  int
+}
+
+func (h handler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	args := struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+		Hops  *int   `json:"hops"`
+		Keys  bool   `json:"keys"`
+	}{Limit: -1, Keys: true}
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: search.query {query: 'some words'}"))
+		return
+	}
+	switch v := req.Args[0].(type) {
+	case string:
+		args.Query = v
+	case map[string]interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "invalid arguments"))
+			return
+		}
+		if err := json.Unmarshal(b, &args); err != nil {
+			req.CloseWithError(errors.Wrap(err, "invalid arguments"))
+			return
+		}
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+
+	terms := indexes.SearchTokens(args.Query)
+	if len(terms) == 0 {
+		req.CloseWithError(errors.Errorf("bad request: no words to search for"))
+		return
+	}
+
+	hops := h.hops
+	if args.Hops != nil {
+		hops = *args.Hops
+	}
+	var inHops graph.FeedSet
+	if hops >= 0 && h.graph != nil {
+		inHops = h.graph.Hops(h.self, hops)
+		if inHops == nil {
+			req.CloseWithError(errors.Errorf("search: failed to get feeds in hops"))
+			return
+		}
+	}
+
+	results, err := h.idx.Search(terms)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "search: query failed"))
+		return
+	}
+
+	var sent int
+	for _, res := range results {
+		if args.Limit >= 0 && sent >= args.Limit {
+			break
+		}
+		v, err := h.root.Get(res.Seq)
+		if err != nil {
+			req.CloseWithError(errors.Wrapf(err, "search: failed to get message %d", res.Seq.Seq()))
+			return
+		}
+		msg, ok := v.(message.StoredMessage)
+		if !ok {
+			if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+				continue
+			}
+			req.CloseWithError(errors.Errorf("search: wrong message type. expected %T - got %T", msg, v))
+			return
+		}
+		if inHops != nil && !inHops.Has(msg.Author) {
+			continue
+		}
+
+		raw := msg.Raw
+		if args.Keys {
+			raw, err = json.Marshal(message.KeyValueRaw{
+				Key:       msg.Key,
+				Value:     msg.Raw,
+				Timestamp: msg.Timestamp.UnixNano() / 1000000,
+			})
+			if err != nil {
+				req.CloseWithError(errors.Wrap(err, "search: failed to encode message"))
+				return
+			}
+		}
+		if err := req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: raw}); err != nil {
+			req.CloseWithError(errors.Wrap(err, "search: failed to send message"))
+			return
+		}
+		sent++
+	}
+	req.Stream.Close()
+}
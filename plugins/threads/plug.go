@@ -0,0 +1,163 @@
+// Package threads offers threads.get and threads.recent (see package go.cryptoscope.co/ssb/threads) over muxrpc.
+package threads
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/threads"
+)
+
+// Thread is what threads.get returns.
+// Messages are {key, value, timestamp} objects, the root first (if we have it) and the replies in causal order after it.
+type Thread struct {
+	Messages []json.RawMessage `json:"messages"`
+	Missing  []*ssb.MessageRef `json:"missing"`
+}
+
+type plugin struct {
+	h muxrpc.Handler
+}
+
+// New returns the threads.get and threads.recent calls.
+//
+// threads.get takes the root of a thread, as a string or {root: ...}, and returns a Thread.
+// threads.recent streams summaries of the threads with the latest replies, {limit: n} selects how many (default 10).
+func New(g threads.Getter, rootLog margaret.Log, tangles multilog.MultiLog) ssb.Plugin {
+	return plugin{
+		h: handler{
+			get:     g,
+			root:    rootLog,
+			tangles: tangles,
+		},
+	}
+}
+
+func (p plugin) Name() string { return "threads" }
+
+func (p plugin) Method() muxrpc.Method {
+	return muxrpc.Method{"threads"}
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type handler struct {
+	get     threads.Getter
+	root    margaret.Log
+	tangles multilog.MultiLog
+}
+
+func (h handler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	switch req.Method.String() {
+	case "threads.get":
+		h.getThread(ctx, req)
+	case "threads.recent":
+		h.recent(ctx, req)
+	default:
+		req.CloseWithError(errors.Errorf("unknown command: %s", req.Method))
+	}
+}
+
+func (h handler) getThread(ctx context.Context, req *muxrpc.Request) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: threads.get %%root.sha256"))
+		return
+	}
+	var rootStr string
+	switch v := req.Args[0].(type) {
+	case string:
+		rootStr = v
+	case map[string]interface{}:
+		rootStr, _ = v["root"].(string)
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+	root, err := ssb.ParseMessageRef(rootStr)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request - invalid root"))
+		return
+	}
+
+	t, err := threads.Get(h.get, h.root, h.tangles, root)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "threads.get failed"))
+		return
+	}
+
+	ret := Thread{
+		Messages: make([]json.RawMessage, 0, len(t.Replies)+1),
+		Missing:  t.Missing,
+	}
+	if ret.Missing == nil {
+		ret.Missing = []*ssb.MessageRef{}
+	}
+	msgs := t.Replies
+	if t.Root != nil {
+		msgs = append([]message.StoredMessage{*t.Root}, msgs...)
+	}
+	for _, msg := range msgs {
+		kv, err := json.Marshal(message.KeyValueRaw{
+			Key:       msg.Key,
+			Value:     msg.Raw,
+			Timestamp: msg.Timestamp.UnixNano() / 1000000,
+		})
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "threads.get: failed to encode message"))
+			return
+		}
+		ret.Messages = append(ret.Messages, kv)
+	}
+
+	if err := req.Return(ctx, ret); err != nil {
+		req.CloseWithError(errors.Wrap(err, "threads.get: failed to return thread"))
+	}
+}
+
+func (h handler) recent(ctx context.Context, req *muxrpc.Request) {
+	limit := 10
+	if len(req.Args) > 0 {
+		args, ok := req.Args[0].(map[string]interface{})
+		if !ok {
+			req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+			return
+		}
+		if l, has := args["limit"]; has {
+			lf, ok := l.(float64)
+			if !ok {
+				req.CloseWithError(errors.Errorf("bad request - limit needs to be a number, not %T", l))
+				return
+			}
+			limit = int(lf)
+		}
+	}
+
+	sums, err := threads.Recent(h.get, h.root, h.tangles, limit)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "threads.recent failed"))
+		return
+	}
+	for _, s := range sums {
+		b, err := json.Marshal(s)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "threads.recent: failed to encode summary"))
+			return
+		}
+		if err := req.Stream.Pour(ctx, message.RawSignedMessage{RawMessage: b}); err != nil {
+			req.CloseWithError(errors.Wrap(err, "threads.recent: failed to send summary"))
+			return
+		}
+	}
+	req.Stream.Close()
+}
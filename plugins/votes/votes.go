@@ -0,0 +1,204 @@
+// Package votes offers the vote index (see indexes.VoteIndex) over muxrpc.
+package votes
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/muxrpc"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/graph"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/internal/mutil"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// Update is what votes.stream sends for every vote message
+type Update struct {
+	Key        *ssb.MessageRef `json:"key"`
+	Voter      *ssb.FeedRef    `json:"voter"`
+	Target     *ssb.MessageRef `json:"target"`
+	Value      int             `json:"value"`
+	Expression string          `json:"expression,omitempty"`
+	Timestamp  int64           `json:"timestamp"` // when we received it, in milliseconds
+}
+
+type plugin struct {
+	h muxrpc.Handler
+}
+
+// New returns the votes.get and votes.stream calls. hops is the default distance of the voters from self.
+//
+// votes.get takes a message, as a string or {id, hops}, and returns the indexes.VoteSummary of the voters within hops (-1 for all of them).
+// votes.stream sends an Update for every vote message, {id} only the ones on that message.
+// It takes the options of createLogStream as well, like {old: false, live: true} for only the new ones.
+func New(rootLog margaret.Log, types multilog.MultiLog, idx indexes.VoteIndex, gb graph.Builder, self *ssb.FeedRef, hops int) ssb.Plugin {
+	return plugin{
+		h: handler{
+			root:  rootLog,
+			types: types,
+			idx:   idx,
+			graph: gb,
+			self:  self,
+			hops:  hops,
+		},
+	}
+}
+
+func (p plugin) Name() string { return "votes" }
+
+func (p plugin) Method() muxrpc.Method {
+	return muxrpc.Method{"votes"}
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
+
+type handler struct {
+	root  margaret.Log
+	types multilog.MultiLog
+	idx   indexes.VoteIndex
+	graph graph.Builder
+	self  *ssb.FeedRef
+	hops  int
+}
+
+func (h handler) HandleConnect(ctx context.Context, e muxrpc.Endpoint) {}
+
+func (h handler) HandleCall(ctx context.Context, req *muxrpc.Request, edp muxrpc.Endpoint) {
+	switch req.Method.String() {
+	case "votes.get":
+		h.get(ctx, req)
+	case "votes.stream":
+		h.stream(ctx, req)
+	default:
+		req.CloseWithError(errors.Errorf("unknown command: %s", req.Method))
+	}
+}
+
+func (h handler) get(ctx context.Context, req *muxrpc.Request) {
+	if len(req.Args) < 1 {
+		req.CloseWithError(errors.Errorf("usage: votes.get %%msg.sha256"))
+		return
+	}
+	var (
+		idStr string
+		hops  = h.hops
+	)
+	switch v := req.Args[0].(type) {
+	case string:
+		idStr = v
+	case map[string]interface{}:
+		idStr, _ = v["id"].(string)
+		if hv, has := v["hops"]; has {
+			hf, ok := hv.(float64)
+			if !ok {
+				req.CloseWithError(errors.Errorf("bad request - hops needs to be a number, not %T", hv))
+				return
+			}
+			hops = int(hf)
+		}
+	default:
+		req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+		return
+	}
+	target, err := ssb.ParseMessageRef(idStr)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "bad request - invalid message"))
+		return
+	}
+
+	votes, err := h.idx.Votes(target)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "votes.get failed"))
+		return
+	}
+	if hops >= 0 && h.graph != nil {
+		inHops := h.graph.Hops(h.self, hops)
+		if inHops == nil {
+			req.CloseWithError(errors.Errorf("votes.get: failed to get feeds in hops"))
+			return
+		}
+		filtered := votes[:0]
+		for _, v := range votes {
+			if inHops.Has(v.Voter) {
+				filtered = append(filtered, v)
+			}
+		}
+		votes = filtered
+	}
+
+	if err := req.Return(ctx, indexes.SummarizeVotes(target, votes)); err != nil {
+		req.CloseWithError(errors.Wrap(err, "votes.get: failed to return summary"))
+	}
+}
+
+func (h handler) stream(ctx context.Context, req *muxrpc.Request) {
+	var (
+		qry    = message.CreateHistArgs{Limit: -1}
+		target *ssb.MessageRef
+	)
+	if len(req.Args) > 0 {
+		args, ok := req.Args[0].(map[string]interface{})
+		if !ok {
+			req.CloseWithError(errors.Errorf("invalid argument type %T", req.Args[0]))
+			return
+		}
+		q, err := message.NewCreateHistArgsFromMap(args)
+		if err != nil {
+			req.CloseWithError(errors.Wrap(err, "bad request"))
+			return
+		}
+		qry = *q
+		if qry.Id != "" {
+			target, err = ssb.ParseMessageRef(qry.Id)
+			if err != nil {
+				req.CloseWithError(errors.Wrap(err, "bad request - invalid message"))
+				return
+			}
+		}
+	}
+
+	sublog, err := h.types.Get(librarian.Addr("vote"))
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "votes.stream: failed to open vote messages"))
+		return
+	}
+
+	enc := func(msg message.StoredMessage) ([]byte, error) {
+		var value struct {
+			Content json.RawMessage `json:"content"`
+		}
+		if err := json.Unmarshal(msg.Raw, &value); err != nil {
+			return nil, nil
+		}
+		vote, err := indexes.ParseVote(value.Content)
+		if err != nil {
+			return nil, nil // invalid vote
+		}
+		if target != nil && vote.Link.Ref() != target.Ref() {
+			return nil, nil
+		}
+		return json.Marshal(Update{
+			Key:        msg.Key,
+			Voter:      msg.Author,
+			Target:     vote.Link,
+			Value:      vote.Value,
+			Expression: vote.Expression,
+			Timestamp:  msg.Timestamp.UnixNano() / 1000000,
+		})
+	}
+	err = transform.PourLog(ctx, req, mutil.Indirect(h.root, sublog), qry, enc)
+	if err != nil {
+		req.CloseWithError(errors.Wrap(err, "votes.stream: failed to send updates"))
+		return
+	}
+	req.Stream.Close()
+}
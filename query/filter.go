@@ -0,0 +1,199 @@
+// Package query implements declarative filters over messages, like ssb-query does for the JavaScript stack.
+//
+// A filter is a JSON object that mirrors the {key, value, timestamp} object of a message.
+// Plain values have to be equal, objects with operators compare the value at their path:
+//
+//	{"value": {"author": "@...", "content": {"type": "post", "channel": {"$in": ["go", "ssb"]}}}, "timestamp": {"$gt": 1550000000000}}
+//
+// The supported operators are $gt, $gte, $lt, $lte, $ne, $in and $prefix.
+// Keys with dots are paths, {"value.content.type": "post"} is the same as {"value": {"content": {"type": "post"}}}.
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter is a parsed filter
+type Filter struct {
+	conds []condition
+}
+
+// condition checks the value at path
+type condition struct {
+	path []string
+	op   string // one of the operators or $eq
+	arg  interface{}
+}
+
+var operators = map[string]bool{
+	"$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$ne": true, "$in": true, "$prefix": true,
+}
+
+// ParseFilter parses a filter from it's decoded JSON
+func ParseFilter(v interface{}) (*Filter, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("query: filter needs to be an object, not %T", v)
+	}
+	var f Filter
+	if err := f.parse(nil, obj); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (f *Filter) parse(path []string, obj map[string]interface{}) error {
+	// sorted, so that the conditions are in a stable order
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := obj[k]
+		if strings.HasPrefix(k, "$") {
+			if !operators[k] {
+				return errors.Errorf("query: unsupported operator %s", k)
+			}
+			if len(path) == 0 {
+				return errors.Errorf("query: operator %s needs a path", k)
+			}
+			if k == "$in" {
+				if _, ok := v.([]interface{}); !ok {
+					return errors.Errorf("query: $in needs an array, not %T", v)
+				}
+			}
+			f.conds = append(f.conds, condition{path: path, op: k, arg: v})
+			continue
+		}
+
+		sub := append(append([]string{}, path...), strings.Split(k, ".")...)
+		if nested, ok := v.(map[string]interface{}); ok {
+			if err := f.parse(sub, nested); err != nil {
+				return err
+			}
+			continue
+		}
+		f.conds = append(f.conds, condition{path: sub, op: "$eq", arg: v})
+	}
+	return nil
+}
+
+// Equal returns the value that the filter requires at path, if it requires one
+func (f *Filter) Equal(path ...string) (interface{}, bool) {
+	for _, c := range f.conds {
+		if c.op == "$eq" && pathEqual(c.path, path) {
+			return c.arg, true
+		}
+	}
+	return nil, false
+}
+
+func pathEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns true if all the conditions of the filter hold for v
+func (f *Filter) Match(v interface{}) bool {
+	for _, c := range f.conds {
+		if !c.match(Lookup(v, c.path...)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup returns the value at path in v, nil if there is none
+func Lookup(v interface{}, path ...string) interface{} {
+	for _, p := range path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = obj[p]
+	}
+	return v
+}
+
+func (c condition) match(v interface{}) bool {
+	switch c.op {
+	case "$eq":
+		return equal(v, c.arg)
+	case "$ne":
+		return !equal(v, c.arg)
+	case "$in":
+		for _, a := range c.arg.([]interface{}) {
+			if equal(v, a) {
+				return true
+			}
+		}
+		return false
+	case "$prefix":
+		s, ok := v.(string)
+		p, ok2 := c.arg.(string)
+		return ok && ok2 && strings.HasPrefix(s, p)
+	}
+
+	cmp, ok := compare(v, c.arg)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "$gt":
+		return cmp > 0
+	case "$gte":
+		return cmp >= 0
+	case "$lt":
+		return cmp < 0
+	case "$lte":
+		return cmp <= 0
+	}
+	panic(fmt.Sprintf("query: unhandled operator %s", c.op))
+}
+
+func equal(a, b interface{}) bool {
+	switch a.(type) {
+	case nil, string, float64, bool:
+		return a == b
+	}
+	return false // objects and arrays can't be compared
+}
+
+// compare orders numbers and strings, ok is false for other or mixed types
+func compare(a, b interface{}) (int, bool) {
+	switch ta := a.(type) {
+	case float64:
+		tb, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case ta < tb:
+			return -1, true
+		case ta > tb:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		tb, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(ta, tb), true
+	}
+	return 0, false
+}
@@ -0,0 +1,82 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	r := require.New(t)
+
+	var msg interface{}
+	err := json.Unmarshal([]byte(`{
+		"key": "%foo.sha256",
+		"value": {
+			"author": "@alice.ed25519",
+			"sequence": 3,
+			"content": {"type": "post", "channel": "go", "text": "hello"}
+		},
+		"timestamp": 1500
+	}`), &msg)
+	r.NoError(err)
+
+	tcases := []struct {
+		filter string
+		match  bool
+	}{
+		{`{}`, true},
+		{`{"value": {"content": {"type": "post"}}}`, true},
+		{`{"value.content.type": "post"}`, true},
+		{`{"value": {"content.type": "vote"}}`, false},
+		{`{"value": {"author": "@alice.ed25519", "content": {"type": "post"}}}`, true},
+		{`{"value": {"author": "@bob.ed25519", "content": {"type": "post"}}}`, false},
+		{`{"value": {"content": {"channel": {"$in": ["ssb", "go"]}}}}`, true},
+		{`{"value": {"content": {"channel": {"$in": ["ssb"]}}}}`, false},
+		{`{"value": {"content": {"channel": {"$ne": "ssb"}}}}`, true},
+		{`{"value": {"content": {"root": {"$ne": "%bar.sha256"}}}}`, true},
+		{`{"value": {"content": {"root": null}}}`, true},
+		{`{"value": {"sequence": {"$gt": 2, "$lte": 3}}}`, true},
+		{`{"value": {"sequence": {"$gte": 4}}}`, false},
+		{`{"timestamp": {"$lt": 1500}}`, false},
+		{`{"timestamp": {"$gt": "1000"}}`, false}, // mixed types don't compare
+		{`{"value": {"author": {"$prefix": "@ali"}}}`, true},
+		{`{"value": {"content": {"text": {"$prefix": "bye"}}}}`, false},
+	}
+	for i, tc := range tcases {
+		var fv interface{}
+		r.NoError(json.Unmarshal([]byte(tc.filter), &fv), "case %d", i)
+		f, err := ParseFilter(fv)
+		r.NoError(err, "case %d", i)
+		r.Equal(tc.match, f.Match(msg), "case %d: %s", i, tc.filter)
+	}
+
+	for i, bad := range []string{
+		`[]`,
+		`{"$gt": 1}`,
+		`{"value": {"$regex": "a"}}`,
+		`{"value": {"author": {"$in": "@alice.ed25519"}}}`,
+	} {
+		var fv interface{}
+		r.NoError(json.Unmarshal([]byte(bad), &fv), "bad %d", i)
+		_, err := ParseFilter(fv)
+		r.Error(err, "bad %d: %s", i, bad)
+	}
+}
+
+func TestFilterEqual(t *testing.T) {
+	r := require.New(t)
+
+	var fv interface{}
+	r.NoError(json.Unmarshal([]byte(`{"value": {"author": {"$ne": "@a"}, "content.type": "post"}}`), &fv))
+	f, err := ParseFilter(fv)
+	r.NoError(err)
+
+	v, ok := f.Equal("value", "content", "type")
+	r.True(ok)
+	r.Equal("post", v)
+
+	_, ok = f.Equal("value", "author")
+	r.False(ok, "$ne is not an equality")
+}
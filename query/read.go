@@ -0,0 +1,266 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/mutil"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+)
+
+// Query is a parsed query.read request
+type Query struct {
+	Filter  *Filter
+	Limit   int // negative for all of them
+	Reverse bool
+	Live    bool
+	Sort    []string // path to order the results by, nil for the receive order
+}
+
+// ParseArgs parses the arguments of query.read:
+//
+//	{"query": [{"$filter": {...}}], "limit": 10, "reverse": true, "live": false, "sort": "value.timestamp"}
+//
+// Only $filter stages are supported, several of them all have to match.
+func ParseArgs(args map[string]interface{}) (*Query, error) {
+	q := Query{
+		Filter: &Filter{},
+		Limit:  -1,
+	}
+
+	for k, v := range args {
+		switch k {
+		case "query":
+			stages, ok := v.([]interface{})
+			if !ok {
+				return nil, errors.Errorf("query: query needs to be an array of stages, not %T", v)
+			}
+			for i, st := range stages {
+				stage, ok := st.(map[string]interface{})
+				if !ok || len(stage) != 1 {
+					return nil, errors.Errorf("query: stage %d needs to be an object with one operator", i)
+				}
+				fv, ok := stage["$filter"]
+				if !ok {
+					for op := range stage {
+						return nil, errors.Errorf("query: unsupported stage %s", op)
+					}
+				}
+				f, err := ParseFilter(fv)
+				if err != nil {
+					return nil, errors.Wrapf(err, "query: invalid filter in stage %d", i)
+				}
+				q.Filter.conds = append(q.Filter.conds, f.conds...)
+			}
+		case "limit":
+			n, ok := v.(float64)
+			if !ok {
+				return nil, errors.Errorf("query: limit needs to be a number, not %T", v)
+			}
+			q.Limit = int(n)
+		case "reverse", "live":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, errors.Errorf("query: %s needs to be a bool, not %T", k, v)
+			}
+			if k == "live" {
+				q.Live = b
+			} else {
+				q.Reverse = b
+			}
+		case "sort":
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.Errorf("query: sort needs to be a path like value.timestamp, not %T", v)
+			}
+			q.Sort = strings.Split(s, ".")
+		}
+	}
+
+	if q.Live && (q.Reverse || q.Sort != nil) {
+		return nil, errors.Errorf("query: live can't be combined with reverse or sort")
+	}
+	return &q, nil
+}
+
+// Sources are the logs that queries read from. The multilogs are optional, queries scan the root log without them.
+type Sources struct {
+	Root margaret.Log
+
+	UserFeeds multilog.MultiLog
+	Types     multilog.MultiLog
+	Tangles   multilog.MultiLog
+}
+
+// Plan returns the log that q reads from and a short description of it, like "scan" or "type:post".
+// It uses a multilog if the filter requires one author, tangle root or message type, in that order.
+func (s Sources) Plan(q *Query) (margaret.Log, string, error) {
+	if s.UserFeeds != nil {
+		if v, ok := q.Filter.Equal("value", "author"); ok {
+			if str, ok := v.(string); ok {
+				if ref, err := ssb.ParseFeedRef(str); err == nil {
+					sublog, err := s.UserFeeds.Get(librarian.Addr(ref.ID))
+					if err != nil {
+						return nil, "", errors.Wrap(err, "query: failed to open sublog of author")
+					}
+					return mutil.Indirect(s.Root, sublog), "author:" + ref.Ref(), nil
+				}
+			}
+		}
+	}
+
+	if s.Tangles != nil {
+		if v, ok := q.Filter.Equal("value", "content", "root"); ok {
+			if str, ok := v.(string); ok {
+				if ref, err := ssb.ParseMessageRef(str); err == nil {
+					sublog, err := s.Tangles.Get(multilogs.TangleAddr("", ref))
+					if err != nil {
+						return nil, "", errors.Wrap(err, "query: failed to open sublog of tangle")
+					}
+					return mutil.Indirect(s.Root, sublog), "root:" + ref.Ref(), nil
+				}
+			}
+		}
+	}
+
+	if s.Types != nil {
+		if v, ok := q.Filter.Equal("value", "content", "type"); ok {
+			if str, ok := v.(string); ok && str != "" {
+				sublog, err := s.Types.Get(librarian.Addr(str))
+				if err != nil {
+					return nil, "", errors.Wrap(err, "query: failed to open sublog of type")
+				}
+				return mutil.Indirect(s.Root, sublog), "type:" + str, nil
+			}
+		}
+	}
+
+	return s.Root, "scan", nil
+}
+
+// Run returns the stored messages that match q
+func (s Sources) Run(q *Query) (luigi.Source, error) {
+	lg, _, err := s.Plan(q)
+	if err != nil {
+		return nil, err
+	}
+
+	qrySpecs := []margaret.QuerySpec{margaret.Live(q.Live)}
+	if q.Sort == nil {
+		qrySpecs = append(qrySpecs, margaret.Reverse(q.Reverse))
+	}
+	src, err := lg.Query(qrySpecs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query: failed to query log")
+	}
+
+	ms := &matchSource{src: src, filter: q.Filter, limit: q.Limit}
+	if q.Sort == nil {
+		return ms, nil
+	}
+
+	// sorting needs all of them
+	ms.limit = -1
+	var matches []match
+	for {
+		_, err := ms.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		matches = append(matches, ms.last)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		cmp, _ := compare(Lookup(matches[i].obj, q.Sort...), Lookup(matches[j].obj, q.Sort...))
+		if q.Reverse {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	if q.Limit >= 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return &sliceSource{matches: matches}, nil
+}
+
+// KeyValue returns the {key, value, timestamp} object of msg, as it's matched by filters
+func KeyValue(msg message.StoredMessage) (map[string]interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(msg.Raw, &value); err != nil {
+		return nil, errors.Wrap(err, "query: failed to decode message")
+	}
+	return map[string]interface{}{
+		"key":       msg.Key.Ref(),
+		"value":     value,
+		"timestamp": float64(msg.Timestamp.UnixNano() / 1000000),
+	}, nil
+}
+
+type match struct {
+	msg message.StoredMessage
+	obj map[string]interface{}
+}
+
+type matchSource struct {
+	src    luigi.Source
+	filter *Filter
+
+	limit, sent int
+	last        match
+}
+
+func (ms *matchSource) Next(ctx context.Context) (interface{}, error) {
+	if ms.limit >= 0 && ms.sent >= ms.limit {
+		return nil, luigi.EOS{}
+	}
+	for {
+		v, err := ms.src.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		msg, ok := v.(message.StoredMessage)
+		if !ok {
+			if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, errors.Errorf("query: wrong message type. expected %T - got %T", msg, v)
+		}
+
+		obj, err := KeyValue(msg)
+		if err != nil {
+			continue // not our problem here
+		}
+		if !ms.filter.Match(obj) {
+			continue
+		}
+
+		ms.sent++
+		ms.last = match{msg, obj}
+		return msg, nil
+	}
+}
+
+type sliceSource struct {
+	matches []match
+}
+
+func (ss *sliceSource) Next(context.Context) (interface{}, error) {
+	if len(ss.matches) == 0 {
+		return nil, luigi.EOS{}
+	}
+	m := ss.matches[0]
+	ss.matches = ss.matches[1:]
+	return m.msg, nil
+}
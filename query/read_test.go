@@ -0,0 +1,113 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestRead(t *testing.T) {
+	r := require.New(t)
+
+	rp := repo.NewMemory()
+	rootLog, err := repo.OpenLog(rp)
+	r.NoError(err)
+
+	authors := []*ssb.FeedRef{
+		{Algo: "ed25519", ID: make([]byte, 32)},
+		{Algo: "ed25519", ID: append(make([]byte, 31), 1)},
+	}
+	contents := []string{
+		`{"type":"post","channel":"go","text":"a"}`,
+		`{"type":"post","channel":"ssb","text":"b"}`,
+		`{"type":"vote","vote":{"value":1}}`,
+		`{"type":"post","text":"c"}`,
+		`{"type":"post","channel":"go","text":"d"}`,
+	}
+	for i, c := range contents {
+		author := authors[i%2]
+		_, err := rootLog.Append(message.StoredMessage{
+			Author:    author,
+			Key:       &ssb.MessageRef{Algo: "sha256", Hash: []byte(fmt.Sprintf("%032d", i))},
+			Sequence:  margaret.BaseSeq(i/2 + 1),
+			Timestamp: time.Unix(int64(1000-i), 0),
+			Raw:       []byte(fmt.Sprintf(`{"author":%q,"sequence":%d,"content":%s}`, author.Ref(), i/2+1, c)),
+		})
+		r.NoError(err)
+	}
+
+	uf, _, serveUF, err := multilogs.OpenUserFeeds(rp)
+	r.NoError(err)
+	r.NoError(serveUF(context.TODO(), rootLog, false))
+	mt, _, serveMT, err := multilogs.OpenMessageTypes(rp)
+	r.NoError(err)
+	r.NoError(serveMT(context.TODO(), rootLog, false))
+
+	src := Sources{Root: rootLog, UserFeeds: uf, Types: mt}
+
+	read := func(args string) (string, []string) {
+		var argMap map[string]interface{}
+		r.NoError(json.Unmarshal([]byte(args), &argMap))
+		q, err := ParseArgs(argMap)
+		r.NoError(err)
+
+		_, plan, err := src.Plan(q)
+		r.NoError(err)
+
+		s, err := src.Run(q)
+		r.NoError(err)
+		var texts []string
+		for {
+			v, err := s.Next(context.TODO())
+			if luigi.IsEOS(err) {
+				break
+			}
+			r.NoError(err)
+			obj, err := KeyValue(v.(message.StoredMessage))
+			r.NoError(err)
+			text, _ := Lookup(obj, "value", "content", "text").(string)
+			texts = append(texts, text)
+		}
+		return plan, texts
+	}
+
+	plan, texts := read(`{"query": [{"$filter": {"value": {"content": {"type": "post", "channel": {"$in": ["go"]}}}}}]}`)
+	r.Equal("type:post", plan)
+	r.Equal([]string{"a", "d"}, texts)
+
+	plan, texts = read(fmt.Sprintf(`{"query": [{"$filter": {"value": {"author": %q}}}], "reverse": true}`, authors[1].Ref()))
+	r.Equal("author:"+authors[1].Ref(), plan)
+	r.Equal([]string{"c", "b"}, texts)
+
+	plan, texts = read(`{"query": [{"$filter": {"value": {"content": {"text": {"$gt": "a"}}}}}], "limit": 2}`)
+	r.Equal("scan", plan)
+	r.Equal([]string{"b", "c"}, texts)
+
+	_, texts = read(`{"query": [{"$filter": {"value.content.type": "post"}}], "sort": "timestamp", "limit": 3}`)
+	r.Equal([]string{"d", "c", "b"}, texts)
+
+	_, texts = read(`{"query": [{"$filter": {"value.content.type": "post"}}, {"$filter": {"value.content.channel": "go"}}], "sort": "value.content.text", "reverse": true}`)
+	r.Equal([]string{"d", "a"}, texts)
+
+	for _, bad := range []string{
+		`{"query": [{"$map": {"key": true}}]}`,
+		`{"query": [], "live": true, "sort": "timestamp"}`,
+		`{"query": {"$filter": {}}}`,
+	} {
+		var argMap map[string]interface{}
+		r.NoError(json.Unmarshal([]byte(bad), &argMap))
+		_, err := ParseArgs(argMap)
+		r.Error(err, bad)
+	}
+}
@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// BackupManifestName is the name of the file that describes a backup, relative to it's folder
+const BackupManifestName = "backup.json"
+
+// BadgerBackupName is the file name of the backup of an index database, it replaces the db folder of the index
+const BadgerBackupName = "db.backup"
+
+// BackupManifest describes a snapshot of a repo.
+// The folder of a snapshot has the same layout as a repo but the databases of the indexes are stored as badger backups.
+type BackupManifest struct {
+	Version int       `json:"version"` // the layout version of the repo
+	Created time.Time `json:"created"`
+
+	// Seq is the last entry of the root log that is included, -1 for an empty log.
+	// The indexes might be behind it but never ahead.
+	Seq int64 `json:"seq"`
+
+	// Indexes maps the name of each included index to the version of it's encoding
+	Indexes map[string]int `json:"indexes"`
+
+	// Secret is true if the secret of the repo is included
+	Secret bool `json:"secret"`
+}
+
+// ReadBackupManifest loads the manifest of the backup in the folder at path
+func ReadBackupManifest(path string) (*BackupManifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(path, BackupManifestName))
+	if err != nil {
+		return nil, errors.Wrap(err, "repo: failed to read backup manifest")
+	}
+	var m BackupManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrap(err, "repo: failed to decode backup manifest")
+	}
+	return &m, nil
+}
+
+// WriteBackupManifest writes m into the backup folder at path
+func WriteBackupManifest(path string, m BackupManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "repo: failed to encode backup manifest")
+	}
+	err = ioutil.WriteFile(filepath.Join(path, BackupManifestName), b, 0600)
+	return errors.Wrap(err, "repo: failed to write backup manifest")
+}
+
+// LoadBadger creates the database at dbPath from a badger backup.
+// The database must not exist yet.
+func LoadBadger(dbPath string, backup io.Reader) error {
+	if _, err := os.Stat(dbPath); err == nil {
+		return errors.Errorf("repo: database %s already exists", dbPath)
+	}
+	if err := os.MkdirAll(dbPath, 0700); err != nil {
+		return errors.Wrapf(err, "mkdir error for %q", dbPath)
+	}
+
+	db, err := badger.Open(badgerOpts(dbPath))
+	if err != nil {
+		return errors.Wrap(err, "repo: badger failed to open")
+	}
+	if err := db.Load(backup, 256); err != nil {
+		db.Close()
+		return errors.Wrap(err, "repo: failed to load badger backup")
+	}
+	return errors.Wrap(db.Close(), "repo: failed to close restored database")
+}
@@ -0,0 +1,169 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/margaret/codec"
+	"go.cryptoscope.co/margaret/codec/msgpack"
+
+	"go.cryptoscope.co/ssb/message"
+)
+
+const (
+	// LogCodecMsgpack stores the entries of the root log as plain msgpack. This is the default.
+	LogCodecMsgpack = "msgpack"
+
+	// LogCodecDeflate compresses the msgpack encoded entries with deflate,
+	// using a preset dictionary of the strings that are common to most SSB messages.
+	LogCodecDeflate = "msgpack+deflate"
+)
+
+// NewLogCodec returns the codec for the root log entries with the passed name
+func NewLogCodec(name string) (codec.Codec, error) {
+	switch name {
+	case "", LogCodecMsgpack:
+		return msgpack.New(&message.StoredMessage{}), nil
+	case LogCodecDeflate:
+		return newDeflateCodec(msgpack.New(&message.StoredMessage{}), deflateDictV1), nil
+	}
+	return nil, errors.Errorf("repo: unsupported log codec %q", name)
+}
+
+// rootLogCodec returns the codec that is selected in the manifest of the repo
+func rootLogCodec(r Interface) (codec.Codec, error) {
+	m, err := ReadManifest(r)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return NewLogCodec(LogCodecMsgpack)
+		}
+		return nil, errors.Wrap(err, "repo: failed to read manifest for log codec")
+	}
+	return NewLogCodec(m.LogCodec)
+}
+
+// deflateDictV1 is used as the preset dictionary for LogCodecDeflate.
+// It is assembled from the field names and values that appear in most messages, the most common ones at the end.
+// Entries are unreadable without the exact same bytes, don't change it. Add a new codec name instead.
+var deflateDictV1 = []byte(`Author` + `Previous` + `Key` + `Sequence` + `Timestamp` + `Raw` +
+	`"type": "git-update",` + `"type": "pub",` + `"address": {` + `"host": "` + `"port": 8008,` +
+	`"type": "channel",` + `"subscribed": true` + `"channel": "` +
+	`"recps": [` + `"mentions": [` + `"link": "&` + `"link": "@` + `"name": "` +
+	`"type": "about",` + `"about": "@` + `"image": "&` + `"description": "` +
+	`"type": "contact",` + `"contact": "@` + `"following": true` + `"blocking": false` +
+	`"type": "vote",` + `"vote": {` + `"value": 1,` + `"expression": "Like"` +
+	`"root": "%` + `"branch": "%` + `"fork": "%` + `"text": "` +
+	`"type": "post",` + `.box",` +
+	`"content": {` + `"hash": "sha256",` + `"timestamp": ` + `"sequence": ` +
+	`.ed25519",` + `.sha256",` + `"signature": "` + `.sig.ed25519"` +
+	`{` + "\n  " + `"previous": "%` + `.sha256",` + "\n  " + `"author": "@` + `.ed25519",` + "\n  ")
+
+// deflateCodec compresses the output of another codec
+type deflateCodec struct {
+	inner codec.Codec
+	dict  []byte
+
+	writers, readers sync.Pool
+}
+
+func newDeflateCodec(inner codec.Codec, dict []byte) codec.Codec {
+	return &deflateCodec{inner: inner, dict: dict}
+}
+
+func (c *deflateCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := c.inner.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, ok := c.writers.Get().(*flate.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w, err = flate.NewWriterDict(&buf, flate.DefaultCompression, c.dict)
+		if err != nil {
+			return nil, errors.Wrap(err, "deflate: failed to create writer")
+		}
+	}
+	defer c.writers.Put(w)
+
+	if _, err := w.Write(b); err != nil {
+		return nil, errors.Wrap(err, "deflate: failed to compress")
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "deflate: failed to compress")
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *deflateCodec) Unmarshal(data []byte) (interface{}, error) {
+	src := bytes.NewReader(data)
+	r, ok := c.readers.Get().(io.ReadCloser)
+	if ok {
+		if err := r.(flate.Resetter).Reset(src, c.dict); err != nil {
+			return nil, errors.Wrap(err, "deflate: failed to reset reader")
+		}
+	} else {
+		r = flate.NewReaderDict(src, c.dict)
+	}
+	defer c.readers.Put(r)
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "deflate: failed to decompress")
+	}
+	return c.inner.Unmarshal(b)
+}
+
+// NewEncoder writes each value as an uvarint length followed by it's compressed encoding
+func (c *deflateCodec) NewEncoder(w io.Writer) codec.Encoder {
+	return &deflateEncoder{c: c, w: w}
+}
+
+func (c *deflateCodec) NewDecoder(r io.Reader) codec.Decoder {
+	return &deflateDecoder{c: c, r: bufio.NewReader(r)}
+}
+
+type deflateEncoder struct {
+	c *deflateCodec
+	w io.Writer
+}
+
+func (enc *deflateEncoder) Encode(v interface{}) error {
+	b, err := enc.c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+	if _, err := enc.w.Write(lenBuf[:n]); err != nil {
+		return errors.Wrap(err, "deflate: failed to write length")
+	}
+	_, err = enc.w.Write(b)
+	return errors.Wrap(err, "deflate: failed to write value")
+}
+
+type deflateDecoder struct {
+	c *deflateCodec
+	r *bufio.Reader
+}
+
+func (dec *deflateDecoder) Decode() (interface{}, error) {
+	n, err := binary.ReadUvarint(dec.r)
+	if err != nil {
+		return nil, err // might be io.EOF
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(dec.r, b); err != nil {
+		return nil, errors.Wrap(err, "deflate: failed to read value")
+	}
+	return dec.c.Unmarshal(b)
+}
@@ -0,0 +1,152 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// testMessage returns an entry that looks like a signed post
+func testMessage(i int) message.StoredMessage {
+	rnd := func(n int) string {
+		b := make([]byte, n)
+		rand.Read(b)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	raw := fmt.Sprintf(`{
+  "previous": "%%%s.sha256",
+  "author": "@%s.ed25519",
+  "sequence": %d,
+  "timestamp": %d,
+  "hash": "sha256",
+  "content": {
+    "type": "post",
+    "text": "this is test post number %d, it has a bit of text in it.",
+    "mentions": []
+  },
+  "signature": "%s.sig.ed25519"
+}`, rnd(32), rnd(32), i+1, time.Now().UnixNano()/1000000, i, rnd(64))
+
+	return message.StoredMessage{
+		Author:    &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+		Key:       &ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)},
+		Sequence:  margaret.BaseSeq(i + 1),
+		Timestamp: time.Now(),
+		Raw:       []byte(raw),
+	}
+}
+
+func TestConvertLog(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+
+	repo := New(rpath)
+	rl, err := OpenLog(repo)
+	r.NoError(err)
+
+	const n = 50
+	var msgs []message.StoredMessage
+	for i := 0; i < n; i++ {
+		msg := testMessage(i)
+		msgs = append(msgs, msg)
+		_, err := rl.Append(msg)
+		r.NoError(err)
+	}
+	r.NoError(rl.(margaret.Alterer).Null(margaret.BaseSeq(3)))
+	r.NoError(rl.(io.Closer).Close())
+
+	rep, err := ConvertLog(repo, LogCodecDeflate)
+	r.NoError(err)
+	r.EqualValues(n, rep.Entries)
+	r.Equal(LogCodecMsgpack, rep.From)
+	r.True(rep.SizeAfter < rep.SizeBefore, "not compressed: %+v", rep)
+
+	m, err := ReadManifest(repo)
+	r.NoError(err)
+	r.Equal(LogCodecDeflate, m.LogCodec)
+
+	rl, err = OpenLog(repo)
+	r.NoError(err)
+	for i, want := range msgs {
+		v, err := rl.Get(margaret.BaseSeq(i))
+		r.NoError(err)
+		if i == 3 {
+			r.True(margaret.IsErrNulled(v.(error)), "entry %d: %v", i, v)
+			continue
+		}
+		r.Equal(string(want.Raw), string(v.(message.StoredMessage).Raw))
+	}
+	r.NoError(rl.(io.Closer).Close())
+
+	// and back
+	rep, err = ConvertLog(repo, LogCodecMsgpack)
+	r.NoError(err)
+	r.EqualValues(n, rep.Entries)
+
+	_, err = ConvertLog(repo, "nope")
+	r.Error(err)
+}
+
+func BenchmarkReadLog(b *testing.B) {
+	const n = 5000
+	for _, name := range []string{LogCodecMsgpack, LogCodecDeflate} {
+		b.Run(name, func(b *testing.B) {
+			r := require.New(b)
+
+			rpath, err := ioutil.TempDir("", "BenchmarkReadLog")
+			r.NoError(err)
+			defer os.RemoveAll(rpath)
+
+			repo := New(rpath)
+			r.NoError(WriteManifest(repo, Manifest{Version: CurrentVersion, LogCodec: name}))
+			rl, err := OpenLog(repo)
+			r.NoError(err)
+			defer rl.(io.Closer).Close()
+
+			var raw int64
+			for i := 0; i < n; i++ {
+				msg := testMessage(i)
+				raw += int64(len(msg.Raw))
+				_, err := rl.Append(msg)
+				r.NoError(err)
+			}
+			size, err := LogSize(repo)
+			r.NoError(err)
+			b.Logf("%s: %d bytes of messages stored in %d bytes", name, raw, size)
+
+			b.SetBytes(raw)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				src, err := rl.Query()
+				r.NoError(err)
+
+				var cnt int
+				err = luigi.Pump(context.TODO(), luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+					if err != nil {
+						return err
+					}
+					cnt++
+					return nil
+				}), src)
+				r.NoError(err)
+				r.Equal(n, cnt)
+			}
+		})
+	}
+}
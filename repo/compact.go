@@ -0,0 +1,235 @@
+package repo
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/offset2"
+)
+
+// CompactReport sums up what CompactLog did
+type CompactReport struct {
+	Entries int64 // entries in the log before compaction
+	Dropped int64 // nulled entries that were removed
+
+	SizeBefore, SizeAfter int64 // bytes used by the log folder
+}
+
+// Reclaimed returns the number of bytes that were freed
+func (rep CompactReport) Reclaimed() int64 {
+	return rep.SizeBefore - rep.SizeAfter
+}
+
+// CompactLog rewrites the root log without the entries that were nulled.
+// This changes the sequence numbers of all the entries after the first nulled one,
+// all the indexes need to be rebuilt afterwards.
+// The log must not be open while this runs.
+//
+// The compacted log is written to a new folder next to the old one (log.1 after log and so on)
+// and then selected in the manifest, see replaceLog.
+// If it is interrupted before that, the old log is untouched and Migrate removes the new folder.
+//
+// If entries were dropped, beforeSwap is called right before the compacted log is switched to.
+// It needs to get rid of everything that refers to the old sequences (like the indexes),
+// so that an interruption after the switch can't leave them pointing to the wrong entries.
+func CompactLog(r Interface, beforeSwap func() error) (*CompactReport, error) {
+	var rep CompactReport
+
+	oldDir, err := rootLogDir(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo/compact")
+	}
+	newDir := nextLogDir(oldDir)
+	newPath := r.GetPath(newDir)
+
+	rep.SizeBefore, err = dirSize(r.GetPath(oldDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "repo/compact: failed to get size of log")
+	}
+
+	if err := os.RemoveAll(newPath); err != nil {
+		return nil, errors.Wrap(err, "repo/compact: failed to remove previous attempt")
+	}
+
+	from, err := OpenLog(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo/compact: failed to open log")
+	}
+	fromCloser := from.(io.Closer)
+
+	cdc, err := rootLogCodec(r)
+	if err != nil {
+		fromCloser.Close()
+		return nil, errors.Wrap(err, "repo/compact")
+	}
+
+	var to margaret.Log
+	to, err = offset2.Open(newPath, cdc)
+	if err != nil {
+		fromCloser.Close()
+		return nil, errors.Wrap(err, "repo/compact: failed to create compacted log")
+	}
+
+	err = copyUnnulled(from, to, &rep)
+	if cerr := fromCloser.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "failed to close log")
+	}
+	if cerr := to.(io.Closer).Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "failed to close compacted log")
+	}
+	if err != nil {
+		os.RemoveAll(newPath)
+		return nil, errors.Wrap(err, "repo/compact")
+	}
+
+	if rep.Dropped == 0 {
+		// nothing to gain
+		rep.SizeAfter = rep.SizeBefore
+		return &rep, errors.Wrap(os.RemoveAll(newPath), "repo/compact: failed to remove unneeded copy")
+	}
+
+	if beforeSwap != nil {
+		if err := beforeSwap(); err != nil {
+			os.RemoveAll(newPath)
+			return nil, errors.Wrap(err, "repo/compact: failed to prepare switch over")
+		}
+	}
+
+	if err := replaceLog(r, newDir, nil); err != nil {
+		return nil, errors.Wrap(err, "repo/compact")
+	}
+
+	rep.SizeAfter, err = dirSize(newPath)
+	return &rep, errors.Wrap(err, "repo/compact: failed to get size of compacted log")
+}
+
+func copyUnnulled(from margaret.Log, to margaret.Log, rep *CompactReport) error {
+	src, err := from.Query()
+	if err != nil {
+		return errors.Wrap(err, "failed to query log")
+	}
+
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+		rep.Entries++
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				rep.Dropped++
+				return nil
+			}
+			return err
+		}
+		_, err = to.Append(v)
+		return errors.Wrapf(err, "failed to copy entry %d", rep.Entries-1)
+	})
+	return luigi.Pump(context.TODO(), snk, src)
+}
+
+// LogSize returns the number of bytes the root log uses on disk, including nulled entries.
+func LogSize(r Interface) (int64, error) {
+	if IsMemory(r) {
+		return 0, ErrNeedsDisk
+	}
+	dir, err := rootLogDir(r)
+	if err != nil {
+		return 0, err
+	}
+	return dirSize(r.GetPath(dir))
+}
+
+// replaceLog switches the root log over to the one in the folder newDir.
+// The switch is a single write of the manifest that names the new folder, update can change other fields in the same write.
+// An interruption before it leaves the old log in use, one after it the new one.
+// The old folder is removed afterwards, if that doesn't happen Migrate removes it on the next start.
+func replaceLog(r Interface, newDir string, update func(*Manifest)) error {
+	m, err := ReadManifest(r)
+	if os.IsNotExist(errors.Cause(err)) {
+		m = &Manifest{Version: CurrentVersion, Indexes: make(map[string]int)}
+	} else if err != nil {
+		return errors.Wrap(err, "failed to read manifest")
+	}
+
+	if err := syncPath(r.GetPath(newDir)); err != nil {
+		return errors.Wrap(err, "failed to flush new log")
+	}
+
+	oldDir := m.rootLogDir()
+	m.LogDir = newDir
+	if update != nil {
+		update(m)
+	}
+	if err := WriteManifest(r, *m); err != nil {
+		return errors.Wrap(err, "failed to switch to new log")
+	}
+	return errors.Wrap(os.RemoveAll(r.GetPath(oldDir)), "failed to remove old log")
+}
+
+// removeStaleLogs removes the root log folders that are not selected in m.
+// They are left behind by CompactLog and ConvertLog when they are interrupted.
+func removeStaleLogs(r Interface, m Manifest) error {
+	if IsMemory(r) || IsReadOnly(r) {
+		return nil
+	}
+	fis, err := ioutil.ReadDir(r.GetPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	current := m.rootLogDir()
+	for _, fi := range fis {
+		name := fi.Name()
+		if _, ok := logDirNumber(name); !ok || name == current {
+			continue
+		}
+		if err := os.RemoveAll(r.GetPath(name)); err != nil {
+			return errors.Wrapf(err, "failed to remove %s", name)
+		}
+	}
+	return nil
+}
+
+// syncPath flushes all the files in dir to disk
+func syncPath(dir string) error {
+	return filepath.Walk(dir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		f, err := os.OpenFile(pth, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// dirSize sums up the size of all the files in dir
+func dirSize(dir string) (int64, error) {
+	var sum int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			sum += info.Size()
+		}
+		return nil
+	})
+	return sum, err
+}
@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+func fillTestLog(t *testing.T, rl margaret.Log, n int) {
+	for i := 0; i < n; i++ {
+		_, err := rl.Append(message.StoredMessage{
+			Author:    &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+			Key:       &ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)},
+			Sequence:  margaret.BaseSeq(i + 1),
+			Timestamp: time.Now(),
+			Raw:       []byte(`{}`),
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestCompactLog(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+
+	repo := New(rpath)
+	rl, err := OpenLog(repo)
+	r.NoError(err)
+
+	const n = 10
+	fillTestLog(t, rl, n)
+
+	var swaps int
+	beforeSwap := func() error {
+		// called before the compacted copy is switched to
+		_, err := os.Stat(repo.GetPath("log.1"))
+		r.NoError(err)
+		swaps++
+		return nil
+	}
+
+	// nothing nulled, nothing to do
+	r.NoError(rl.(io.Closer).Close())
+	rep, err := CompactLog(repo, beforeSwap)
+	r.NoError(err)
+	r.Equal(0, swaps)
+	r.EqualValues(n, rep.Entries)
+	r.EqualValues(0, rep.Dropped)
+	r.EqualValues(0, rep.Reclaimed())
+
+	rl, err = OpenLog(repo)
+	r.NoError(err)
+	alter := rl.(margaret.Alterer)
+	for _, seq := range []int64{0, 4, 5} {
+		r.NoError(alter.Null(margaret.BaseSeq(seq)))
+	}
+	r.NoError(rl.(io.Closer).Close())
+
+	rep, err = CompactLog(repo, beforeSwap)
+	r.NoError(err)
+	r.Equal(1, swaps)
+	r.EqualValues(n, rep.Entries)
+	r.EqualValues(3, rep.Dropped)
+	r.True(rep.Reclaimed() > 0, "no space reclaimed: %+v", rep)
+
+	_, err = os.Stat(repo.GetPath("log"))
+	r.True(os.IsNotExist(err), "old log not removed: %v", err)
+
+	rl, err = OpenLog(repo)
+	r.NoError(err)
+	defer rl.(io.Closer).Close()
+	seq, err := rl.Seq().Value()
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(n-3-1), seq)
+
+	// the order is kept
+	want := []margaret.BaseSeq{2, 3, 4, 7, 8, 9, 10}
+	for i, s := range want {
+		v, err := rl.Get(margaret.BaseSeq(i))
+		r.NoError(err)
+		r.Equal(s, v.(message.StoredMessage).Sequence)
+	}
+}
+
+func TestCompactLogInterrupted(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+
+	repo := New(rpath)
+	rl, err := OpenLog(repo)
+	r.NoError(err)
+
+	const n = 10
+	fillTestLog(t, rl, n)
+	alter := rl.(margaret.Alterer)
+	for _, seq := range []int64{0, 4, 5} {
+		r.NoError(alter.Null(margaret.BaseSeq(seq)))
+	}
+	r.NoError(rl.(io.Closer).Close())
+
+	// the state on disk if the process died right before the switch
+	crashed, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(crashed)
+	crashed = filepath.Join(crashed, "repo")
+	_, err = CompactLog(repo, func() error {
+		return copyPath(crashed, rpath)
+	})
+	r.NoError(err)
+
+	checkSeq := func(repo Interface, want margaret.BaseSeq) {
+		_, _, err := Migrate(repo)
+		r.NoError(err)
+		rl, err := OpenLog(repo)
+		r.NoError(err)
+		defer rl.(io.Closer).Close()
+		seq, err := rl.Seq().Value()
+		r.NoError(err)
+		r.Equal(want, seq)
+		_, err = rl.Get(margaret.BaseSeq(1))
+		r.NoError(err, "message lost")
+	}
+
+	// after the switch but before the old log was removed: the compacted one is used and the old one removed
+	r.NoError(copyPath(repo.GetPath("log"), filepath.Join(crashed, "log")))
+	checkSeq(repo, margaret.BaseSeq(n-3-1))
+	_, err = os.Stat(repo.GetPath("log"))
+	r.True(os.IsNotExist(err), "old log not removed: %v", err)
+
+	// before the switch: the old log is still in use and the unused copy is removed
+	before := New(crashed)
+	checkSeq(before, margaret.BaseSeq(n-1))
+	_, err = os.Stat(before.GetPath("log.1"))
+	r.True(os.IsNotExist(err), "unused copy not removed: %v", err)
+
+	// and it can be tried again
+	_, err = CompactLog(before, nil)
+	r.NoError(err)
+	checkSeq(before, margaret.BaseSeq(n-3-1))
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/offset2"
+
+	"go.cryptoscope.co/ssb/message"
+)
+
+// ConvertReport sums up what ConvertLog did
+type ConvertReport struct {
+	Entries int64 // including the nulled ones
+
+	From, To string // names of the codecs
+
+	SizeBefore, SizeAfter int64 // bytes used by the log folder
+}
+
+// ConvertLog rewrites the root log using the codec with the passed name and selects it in the manifest.
+// Nulled entries stay nulled, the sequences don't change and the indexes stay valid.
+// The log must not be open while this runs.
+//
+// The converted log is written to a new folder next to the old one and then selected in the manifest
+// together with the codec, see replaceLog. If it is interrupted before that, the old log is untouched.
+func ConvertLog(r Interface, codecName string) (*ConvertReport, error) {
+	if IsMemory(r) {
+		return nil, ErrNeedsDisk
+	}
+
+	cdc, err := NewLogCodec(codecName)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo/convert")
+	}
+
+	m, _, err := Migrate(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo/convert: failed to migrate repo")
+	}
+
+	rep := ConvertReport{From: m.LogCodec, To: codecName}
+	if rep.From == "" {
+		rep.From = LogCodecMsgpack
+	}
+	if rep.From == rep.To {
+		return &rep, nil
+	}
+
+	oldDir := m.rootLogDir()
+	newDir := nextLogDir(oldDir)
+	newPath := r.GetPath(newDir)
+
+	rep.SizeBefore, err = dirSize(r.GetPath(oldDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "repo/convert: failed to get size of log")
+	}
+
+	if err := os.RemoveAll(newPath); err != nil {
+		return nil, errors.Wrap(err, "repo/convert: failed to remove previous attempt")
+	}
+
+	from, err := OpenLog(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo/convert: failed to open log")
+	}
+	fromCloser := from.(io.Closer)
+
+	var to margaret.Log
+	to, err = offset2.Open(newPath, cdc)
+	if err != nil {
+		fromCloser.Close()
+		return nil, errors.Wrap(err, "repo/convert: failed to create converted log")
+	}
+
+	err = copyKeepNulled(from, to, &rep)
+	if cerr := fromCloser.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "failed to close log")
+	}
+	if cerr := to.(io.Closer).Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "failed to close converted log")
+	}
+	if err != nil {
+		os.RemoveAll(newPath)
+		return nil, errors.Wrap(err, "repo/convert")
+	}
+
+	err = replaceLog(r, newDir, func(m *Manifest) {
+		m.LogCodec = codecName
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "repo/convert")
+	}
+
+	rep.SizeAfter, err = dirSize(newPath)
+	return &rep, errors.Wrap(err, "repo/convert: failed to get size of converted log")
+}
+
+func copyKeepNulled(from margaret.Log, to margaret.Log, rep *ConvertReport) error {
+	alter, ok := to.(margaret.Alterer)
+	if !ok {
+		return errors.Errorf("log can't be altered: %T", to)
+	}
+
+	src, err := from.Query()
+	if err != nil {
+		return errors.Wrap(err, "failed to query log")
+	}
+
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+		rep.Entries++
+		if err, ok := v.(error); ok {
+			if !margaret.IsErrNulled(err) {
+				return err
+			}
+			seq, err := to.Append(message.StoredMessage{})
+			if err != nil {
+				return errors.Wrap(err, "failed to append placeholder for nulled entry")
+			}
+			return alter.Null(seq)
+		}
+		_, err = to.Append(v)
+		return errors.Wrapf(err, "failed to copy entry %d", rep.Entries-1)
+	})
+	return luigi.Pump(context.TODO(), snk, src)
+}
@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const lockFileName = "lock"
+
+// ErrLocked is returned if another process holds the lock of the repo
+type ErrLocked struct {
+	Path string
+	PID  int // zero if the repo is opened read-only
+}
+
+func (e ErrLocked) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("repo: %s is opened read-only by another process", e.Path)
+	}
+	return fmt.Sprintf("repo: %s is in use by process %d", e.Path, e.PID)
+}
+
+// IsLocked returns true if err was caused by the repo being used by another process
+func IsLocked(err error) bool {
+	_, ok := errors.Cause(err).(ErrLocked)
+	return ok
+}
+
+// errWouldBlock is returned by lockFile if the lock is held by another process
+var errWouldBlock = errors.New("repo: lock is held")
+
+// Lock takes the advisory lock of the repo for writing to it.
+// It fails with ErrLocked if another process holds the lock, read-only or not, and with ErrReadOnly for repos from NewReadOnly.
+//
+// Locks are held per process. Taking it again from the same process succeeds,
+// so that tools can hold the lock while calling code that takes it as well (like sbot.New).
+// Each returned closer releases one reference and the lock is let go once all of them are closed.
+func Lock(r Interface) (io.Closer, error) {
+	if IsReadOnly(r) {
+		return nil, errors.Wrap(ErrReadOnly, "repo: can't lock for writing")
+	}
+	return lock(r, true)
+}
+
+// LockReadOnly takes a shared lock of the repo, for inspection tools that don't change it.
+// Any number of processes can hold it at the same time, but not while one holds the lock for writing.
+// The lock alone doesn't keep the process from writing, open the repo with NewReadOnly for that.
+func LockReadOnly(r Interface) (io.Closer, error) {
+	return lock(r, false)
+}
+
+// held keeps the locks of this process by the absolute path of their file
+var (
+	heldMu sync.Mutex
+	held   = make(map[string]*repoLock)
+)
+
+type repoLock struct {
+	path      string
+	f         *os.File
+	refs      int
+	exclusive bool
+}
+
+func lock(r Interface, exclusive bool) (io.Closer, error) {
+	if IsMemory(r) {
+		return nopCloser{}, nil
+	}
+
+	pth, err := filepath.Abs(r.GetPath(lockFileName))
+	if err != nil {
+		return nil, errors.Wrap(err, "repo: failed to get lock path")
+	}
+
+	heldMu.Lock()
+	defer heldMu.Unlock()
+
+	l, ok := held[pth]
+	if !ok {
+		if err := os.MkdirAll(filepath.Dir(pth), 0700); err != nil {
+			return nil, errors.Wrap(err, "repo: failed to create repo folder")
+		}
+		f, err := os.OpenFile(pth, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "repo: failed to open lock file")
+		}
+		l = &repoLock{path: pth, f: f}
+		if err := l.take(exclusive); err != nil {
+			f.Close()
+			return nil, err
+		}
+		held[pth] = l
+	} else if exclusive && !l.exclusive {
+		if err := l.take(true); err != nil {
+			// converting might have dropped the shared lock
+			if rerr := lockFile(l.f, false); rerr != nil {
+				return nil, errors.Wrap(rerr, "repo: failed to retake read-only lock")
+			}
+			return nil, err
+		}
+	}
+	l.refs++
+	return &lockRef{l: l}, nil
+}
+
+func (l *repoLock) take(exclusive bool) error {
+	err := lockFile(l.f, exclusive)
+	if err == errWouldBlock {
+		return ErrLocked{Path: filepath.Dir(l.path), PID: l.readPID()}
+	} else if err != nil {
+		return errors.Wrap(err, "repo: failed to lock")
+	}
+	l.exclusive = exclusive
+	if !exclusive {
+		return nil
+	}
+
+	if err := l.f.Truncate(0); err != nil {
+		return errors.Wrap(err, "repo: failed to clear lock file")
+	}
+	if _, err := l.f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		return errors.Wrap(err, "repo: failed to write pid to lock file")
+	}
+	return errors.Wrap(l.f.Sync(), "repo: failed to sync lock file")
+}
+
+// readPID returns the pid written by the process that holds the lock for writing, zero if there is none
+func (l *repoLock) readPID() int {
+	b, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+func (l *repoLock) release() error {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+
+	l.refs--
+	if l.refs > 0 {
+		return nil
+	}
+	delete(held, l.path)
+
+	if l.exclusive {
+		// the pid is stale once we let go
+		l.f.Truncate(0)
+	}
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Wrap(err, "repo: failed to release lock")
+}
+
+type lockRef struct {
+	once sync.Once
+	l    *repoLock
+}
+
+func (ref *lockRef) Close() error {
+	var err error
+	ref.once.Do(func() {
+		err = ref.l.release()
+	})
+	return err
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestLockHelper is run as a separate process by TestLock
+func TestLockHelper(t *testing.T) {
+	rpath := os.Getenv("SSB_LOCK_HELPER_REPO")
+	if rpath == "" {
+		t.Skip("only used by TestLock")
+	}
+	lock := Lock
+	if os.Getenv("SSB_LOCK_HELPER_RO") != "" {
+		lock = LockReadOnly
+	}
+	l, err := lock(New(rpath))
+	if err != nil {
+		fmt.Println("locked:", err)
+		return
+	}
+	l.Close()
+	fmt.Println("unlocked")
+}
+
+func TestLock(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+
+	tryLock := func(readOnly bool) string {
+		cmd := exec.Command(os.Args[0], "-test.run=TestLockHelper")
+		cmd.Env = append(os.Environ(), "SSB_LOCK_HELPER_REPO="+rpath)
+		if readOnly {
+			cmd.Env = append(cmd.Env, "SSB_LOCK_HELPER_RO=1")
+		}
+		out, err := cmd.CombinedOutput()
+		r.NoError(err, "helper failed: %s", out)
+		return string(out)
+	}
+
+	repo := New(rpath)
+	l, err := Lock(repo)
+	r.NoError(err)
+
+	// nested from the same process
+	nested, err := LockReadOnly(repo)
+	r.NoError(err)
+	r.NoError(nested.Close())
+
+	out := tryLock(false)
+	r.Contains(out, fmt.Sprintf("in use by process %d", os.Getpid()))
+	out = tryLock(true)
+	r.Contains(out, "locked:")
+
+	r.NoError(l.Close())
+	r.NoError(l.Close(), "closing twice is fine")
+	r.Contains(tryLock(false), "unlocked")
+
+	// readers share the lock but keep writers out
+	ro, err := LockReadOnly(repo)
+	r.NoError(err)
+	r.Contains(tryLock(true), "unlocked")
+	out = tryLock(false)
+	r.Contains(out, "opened read-only")
+	r.True(strings.Contains(out, rpath))
+	r.NoError(ro.Close())
+}
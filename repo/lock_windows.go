@@ -0,0 +1,56 @@
+// +build windows
+
+package repo
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errLockViolation syscall.Errno = 33  // ERROR_LOCK_VIOLATION
+	errNotLocked     syscall.Errno = 158 // ERROR_NOT_LOCKED
+)
+
+// lockRange is the byte of the file that is locked.
+// Locks are mandatory on windows, it's far behind the pid so that other processes can still read it.
+func lockRange() *syscall.Overlapped {
+	return &syscall.Overlapped{OffsetHigh: 0x7fffffff}
+}
+
+func lockFile(f *os.File, exclusive bool) error {
+	flags := uintptr(lockfileFailImmediately)
+	if exclusive {
+		flags |= lockfileExclusiveLock
+		// LockFileEx can't convert a shared lock, it has to be dropped first
+		if err := unlockFile(f); err != nil && err != errNotLocked {
+			return err
+		}
+	}
+	ok, _, err := procLockFileEx.Call(f.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(lockRange())))
+	if ok == 0 {
+		if err == errLockViolation {
+			return errWouldBlock
+		}
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	ok, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(lockRange())))
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
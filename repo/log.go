@@ -1,9 +1,15 @@
 package repo
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/pkg/errors"
 
 	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/codec"
 	"go.cryptoscope.co/margaret/codec/msgpack"
 	"go.cryptoscope.co/margaret/offset2"
 
@@ -11,13 +17,79 @@ import (
 )
 
 func OpenLog(r Interface, path ...string) (margaret.Log, error) {
+	if mr, ok := r.(*memRepo); ok {
+		return mr.log(strings.Join(path, "/")), nil
+	}
+
 	// prefix path with "logs" if path is not empty, otherwise use "log"
 	path = append([]string{"log"}, path...)
 	if len(path) > 1 {
 		path[0] = "logs"
 	}
 
-	// TODO use proper log message type here
-	log, err := offset2.Open(r.GetPath(path...), msgpack.New(&message.StoredMessage{}))
-	return log, errors.Wrap(err, "failed to open log")
+	// the root log can be compressed and moved, the others use the defaults
+	var cdc codec.Codec = msgpack.New(&message.StoredMessage{})
+	if len(path) == 1 {
+		var err error
+		cdc, err = rootLogCodec(r)
+		if err != nil {
+			return nil, err
+		}
+		path[0], err = rootLogDir(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log, err := offset2.Open(r.GetPath(path...), cdc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open log")
+	}
+	if IsReadOnly(r) {
+		return readOnlyLog{log}, nil
+	}
+	return log, nil
+}
+
+// defaultLogDir is the folder of the root log until it is replaced for the first time
+const defaultLogDir = "log"
+
+// rootLogDir returns the folder of the root log that is selected in the manifest of the repo
+func rootLogDir(r Interface) (string, error) {
+	m, err := ReadManifest(r)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return defaultLogDir, nil
+		}
+		return "", errors.Wrap(err, "repo: failed to read manifest for log folder")
+	}
+	return m.rootLogDir(), nil
+}
+
+func (m Manifest) rootLogDir() string {
+	if m.LogDir == "" {
+		return defaultLogDir
+	}
+	return m.LogDir
+}
+
+// nextLogDir returns the folder for the log that replaces the one in dir: log.1 after log, log.2 after log.1 and so on
+func nextLogDir(dir string) string {
+	n, _ := logDirNumber(dir)
+	return fmt.Sprintf("%s.%d", defaultLogDir, n+1)
+}
+
+// logDirNumber returns the number of a root log folder and false if name is not one
+func logDirNumber(name string) (int, bool) {
+	if name == defaultLogDir {
+		return 0, true
+	}
+	if !strings.HasPrefix(name, defaultLogDir+".") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(name, defaultLogDir+"."))
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
 }
@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// CurrentVersion is the version of the repo layout this code reads and writes
+const CurrentVersion = 2
+
+const manifestFileName = "manifest.json"
+
+// Manifest records the format versions of a repo and the indexes in it
+type Manifest struct {
+	Version int `json:"version"`
+
+	// Indexes maps the name of an index to the version of it's encoding
+	Indexes map[string]int `json:"indexes"`
+
+	// LogCodec is the name of the codec the entries of the root log are stored with (see NewLogCodec).
+	// Empty means LogCodecMsgpack. Use ConvertLog to change it.
+	LogCodec string `json:"log_codec,omitempty"`
+
+	// CompactPending is set when feeds were evicted from the log or a compaction was scheduled.
+	// The log is compacted and all the indexes are rebuilt the next time the bot starts.
+	CompactPending bool `json:"compact_pending,omitempty"`
+
+	// LogDir is the folder of the root log, relative to the repo. Empty means "log".
+	// CompactLog and ConvertLog write a new folder and switch to it by changing this field.
+	LogDir string `json:"log_dir,omitempty"`
+}
+
+// ErrRepoTooNew is returned when a repo was written by a newer version of this code
+type ErrRepoTooNew struct {
+	Has, Supported int
+}
+
+func (e ErrRepoTooNew) Error() string {
+	return fmt.Sprintf("repo: layout version %d is newer than the supported version %d", e.Has, e.Supported)
+}
+
+// ReadManifest loads the manifest of the repo. The returned error satisfies os.IsNotExist if there is none.
+func ReadManifest(r Interface) (*Manifest, error) {
+	if mr, ok := r.(*memRepo); ok {
+		mr.mu.Lock()
+		defer mr.mu.Unlock()
+		if mr.manifest == nil {
+			return nil, &os.PathError{Op: "open", Path: manifestFileName, Err: os.ErrNotExist}
+		}
+		m := *mr.manifest
+		m.Indexes = make(map[string]int)
+		for k, v := range mr.manifest.Indexes {
+			m.Indexes[k] = v
+		}
+		return &m, nil
+	}
+
+	b, err := ioutil.ReadFile(r.GetPath(manifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrap(err, "repo: failed to decode manifest")
+	}
+	if m.Indexes == nil {
+		m.Indexes = make(map[string]int)
+	}
+	return &m, nil
+}
+
+// WriteManifest replaces the manifest of the repo with m
+func WriteManifest(r Interface, m Manifest) error {
+	if IsReadOnly(r) {
+		return errors.Wrap(ErrReadOnly, "repo: can't write manifest")
+	}
+	if mr, ok := r.(*memRepo); ok {
+		mr.mu.Lock()
+		defer mr.mu.Unlock()
+		mr.manifest = &m
+		return nil
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "repo: failed to encode manifest")
+	}
+
+	pth := r.GetPath(manifestFileName)
+	if err := os.MkdirAll(r.GetPath(), 0700); err != nil {
+		return errors.Wrap(err, "repo: failed to create repo folder")
+	}
+	if err := writeFileSync(pth+".tmp", b); err != nil {
+		return errors.Wrap(err, "repo: failed to write manifest")
+	}
+	return errors.Wrap(os.Rename(pth+".tmp", pth), "repo: failed to replace manifest")
+}
+
+// writeFileSync is ioutil.WriteFile but makes sure the data is on disk before it returns,
+// so that renaming the file into place can't leave an empty one behind after a crash
+func writeFileSync(pth string, b []byte) error {
+	f, err := os.OpenFile(pth, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,295 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/mem"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/blobstore"
+)
+
+// NewMemory returns a repo that keeps everything in memory, nothing is written to disk.
+// OpenLog, OpenMultiLog, OpenIndex, OpenBlobStore and OpenKeyPair hand out in-memory versions for it.
+// Opening the same thing twice returns the same data, it lives as long as the repo value.
+// Indexes that need badger directly (OpenBadgerIndex) can't be used with it.
+func NewMemory() Interface {
+	return &memRepo{
+		logs:    make(map[string]margaret.Log),
+		mlogs:   make(map[string]*memMultiLog),
+		indexes: make(map[string]*memIndex),
+	}
+}
+
+// IsMemory returns true if r was created by NewMemory
+func IsMemory(r Interface) bool {
+	_, ok := r.(*memRepo)
+	return ok
+}
+
+// ErrNeedsDisk is returned when something is opened on an in-memory repo that only exists on disk
+var ErrNeedsDisk = errors.New("repo: not supported by in-memory repos")
+
+type memRepo struct {
+	mu sync.Mutex
+
+	logs    map[string]margaret.Log
+	mlogs   map[string]*memMultiLog
+	indexes map[string]*memIndex
+	blobs   ssb.BlobStore
+
+	keyPair  *ssb.KeyPair
+	manifest *Manifest
+}
+
+// GetPath returns paths below the null device, so that accidental file access fails instead of writing somewhere
+func (r *memRepo) GetPath(rel ...string) string {
+	return filepath.Join(append([]string{os.DevNull}, rel...)...)
+}
+
+func (r *memRepo) log(name string) margaret.Log {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.logs[name]
+	if !ok {
+		l = memLog{mem.New()}
+		r.logs[name] = l
+	}
+	return l
+}
+
+func (r *memRepo) multiLog(name string) *memMultiLog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ml, ok := r.mlogs[name]
+	if !ok {
+		ml = &memMultiLog{
+			sublogs: make(map[librarian.Addr]margaret.Log),
+			seq:     margaret.BaseSeq(-1),
+		}
+		r.mlogs[name] = ml
+	}
+	return ml
+}
+
+func (r *memRepo) index(name string) *memIndex {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx, ok := r.indexes[name]
+	if !ok {
+		idx = &memIndex{
+			seq:  margaret.BaseSeq(-1),
+			obvs: make(map[librarian.Addr]luigi.Observable),
+		}
+		r.indexes[name] = idx
+	}
+	return idx
+}
+
+func (r *memRepo) blobStore() ssb.BlobStore {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blobs == nil {
+		r.blobs = blobstore.NewMemory()
+	}
+	return r.blobs
+}
+
+func (r *memRepo) getKeyPair() (*ssb.KeyPair, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keyPair == nil {
+		kp, err := ssb.NewKeyPair(nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "repo: couldn't create key pair")
+		}
+		r.keyPair = kp
+	}
+	return r.keyPair, nil
+}
+
+// memLog makes the mem log look like the ones on disk, which need to be closed
+type memLog struct {
+	margaret.Log
+}
+
+func (memLog) Close() error { return nil }
+
+// memMultiLog is a multilog that keeps it's sublogs in memory
+type memMultiLog struct {
+	mu      sync.Mutex
+	sublogs map[librarian.Addr]margaret.Log
+
+	// seq is the last entry of the root log that was processed
+	seq margaret.Seq
+}
+
+var _ multilog.MultiLog = (*memMultiLog)(nil)
+
+func (ml *memMultiLog) Get(addr librarian.Addr) (margaret.Log, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	sl, ok := ml.sublogs[addr]
+	if !ok {
+		sl = mem.New()
+		ml.sublogs[addr] = sl
+	}
+	return sl, nil
+}
+
+// List returns the addresses of all sublogs that have entries
+func (ml *memMultiLog) List() ([]librarian.Addr, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	var addrs []librarian.Addr
+	for addr, sl := range ml.sublogs {
+		v, err := sl.Seq().Value()
+		if err != nil {
+			return nil, err
+		}
+		if seq, ok := v.(margaret.Seq); ok && seq.Seq() >= 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs, nil
+}
+
+func (ml *memMultiLog) Close() error { return nil }
+
+func (ml *memMultiLog) serve(f multilog.Func) ServeFunc {
+	return func(ctx context.Context, rootLog margaret.Log, live bool) error {
+		ml.mu.Lock()
+		from := ml.seq
+		ml.mu.Unlock()
+
+		src, err := rootLog.Query(margaret.Live(live), margaret.SeqWrap(true), margaret.Gt(from))
+		if err != nil {
+			return errors.Wrap(err, "error querying rootLog for mlog")
+		}
+
+		snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+			if err != nil {
+				if luigi.IsEOS(err) {
+					return nil
+				}
+				return err
+			}
+			sw, ok := v.(margaret.SeqWrapper)
+			if !ok {
+				return errors.Errorf("expected a sequence wrapper, got %T", v)
+			}
+			if err := f(ctx, sw.Seq(), sw.Value(), ml); err != nil {
+				return err
+			}
+			ml.mu.Lock()
+			ml.seq = sw.Seq()
+			ml.mu.Unlock()
+			return nil
+		})
+
+		err = luigi.Pump(ctx, snk, src)
+		if err == ssb.ErrShuttingDown {
+			return nil
+		}
+		return errors.Wrap(err, "error reading query for mlog")
+	}
+}
+
+// memIndex is a librarian.SeqSetterIndex that keeps the values in memory
+type memIndex struct {
+	mu   sync.Mutex
+	seq  margaret.Seq
+	obvs map[librarian.Addr]luigi.Observable
+}
+
+var _ librarian.SeqSetterIndex = (*memIndex)(nil)
+
+func (idx *memIndex) observable(addr librarian.Addr) luigi.Observable {
+	obv, ok := idx.obvs[addr]
+	if !ok {
+		obv = luigi.NewObservable(librarian.UnsetValue{Addr: addr})
+		idx.obvs[addr] = obv
+	}
+	return obv
+}
+
+func (idx *memIndex) Get(ctx context.Context, addr librarian.Addr) (luigi.Observable, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.observable(addr), nil
+}
+
+func (idx *memIndex) Set(ctx context.Context, addr librarian.Addr, v interface{}) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.observable(addr).Set(v)
+}
+
+func (idx *memIndex) Delete(ctx context.Context, addr librarian.Addr) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.observable(addr).Set(librarian.UnsetValue{Addr: addr})
+}
+
+func (idx *memIndex) SetSeq(seq margaret.Seq) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.seq = seq
+	return nil
+}
+
+func (idx *memIndex) GetSeq() (margaret.Seq, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.seq, nil
+}
+
+// IteratePrefix calls fn for every set key that starts with prefix, in sorted order
+func (idx *memIndex) IteratePrefix(prefix librarian.Addr, fn func(librarian.Addr, interface{}) error) error {
+	type kv struct {
+		k librarian.Addr
+		v interface{}
+	}
+	idx.mu.Lock()
+	var matches []kv
+	for addr, obv := range idx.obvs {
+		if !strings.HasPrefix(string(addr), string(prefix)) {
+			continue
+		}
+		v, err := obv.Value()
+		if err != nil {
+			idx.mu.Unlock()
+			return err
+		}
+		if _, unset := v.(librarian.UnsetValue); unset {
+			continue
+		}
+		matches = append(matches, kv{addr, v})
+	}
+	idx.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool { return bytes.Compare([]byte(matches[i].k), []byte(matches[j].k)) < 0 })
+	for _, m := range matches {
+		if err := fn(m.k, m.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrefixIterator is implemented by the indexes OpenIndex returns for in-memory repos
+type PrefixIterator interface {
+	IteratePrefix(prefix librarian.Addr, fn func(librarian.Addr, interface{}) error) error
+}
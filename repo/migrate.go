@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Migration upgrades a repo from one layout version to the next
+type Migration struct {
+	// From is the version this migration upgrades from, it results in From+1
+	From int
+
+	Name string
+
+	// Backup lists the paths (relative to the repo) that are copied aside before Run is called
+	Backup []string
+
+	Run func(Interface) error
+}
+
+// MigrationRun describes a migration that was applied by Migrate
+type MigrationRun struct {
+	Name    string
+	Version int    // of the repo after it
+	Backup  string // where the paths listed by the migration were copied to, empty if there were none
+	Took    time.Duration
+}
+
+var migrations = make(map[int]Migration)
+
+// RegisterMigration adds m to the migrations that Migrate applies
+func RegisterMigration(m Migration) {
+	if _, has := migrations[m.From]; has {
+		panic(fmt.Sprintf("repo: migration from version %d registered twice", m.From))
+	}
+	migrations[m.From] = m
+}
+
+// Migrate brings the layout of the repo up to CurrentVersion.
+// It refuses to touch repos that were written by a newer version.
+// The returned manifest is also written to the repo, the runs list the migrations that were applied.
+// Log folders left behind by an interrupted CompactLog or ConvertLog are removed.
+func Migrate(r Interface) (*Manifest, []MigrationRun, error) {
+	return runMigrations(r, migrations, CurrentVersion)
+}
+
+func runMigrations(r Interface, table map[int]Migration, target int) (*Manifest, []MigrationRun, error) {
+	m, err := ReadManifest(r)
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			return nil, nil, errors.Wrap(err, "repo/migrate: failed to read manifest")
+		}
+
+		v, err := detectVersion(r, target)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "repo/migrate: failed to detect layout version")
+		}
+		m = &Manifest{
+			Version: v,
+			Indexes: make(map[string]int),
+		}
+	}
+
+	if m.Version > target {
+		return nil, nil, ErrRepoTooNew{Has: m.Version, Supported: target}
+	}
+
+	var runs []MigrationRun
+	for m.Version < target {
+		mig, has := table[m.Version]
+		if !has {
+			return nil, runs, errors.Errorf("repo/migrate: no migration from version %d", m.Version)
+		}
+
+		start := time.Now()
+		bpath, err := backup(r, mig)
+		if err != nil {
+			return nil, runs, errors.Wrapf(err, "repo/migrate: backup for %s failed", mig.Name)
+		}
+
+		if err := mig.Run(r); err != nil {
+			return nil, runs, errors.Wrapf(err, "repo/migrate: %s failed", mig.Name)
+		}
+		m.Version = mig.From + 1
+
+		if err := WriteManifest(r, *m); err != nil {
+			return nil, runs, errors.Wrapf(err, "repo/migrate: failed to update manifest after %s", mig.Name)
+		}
+		runs = append(runs, MigrationRun{Name: mig.Name, Version: m.Version, Backup: bpath, Took: time.Since(start)})
+	}
+
+	if err := WriteManifest(r, *m); err != nil {
+		return nil, runs, err
+	}
+	return m, runs, errors.Wrap(removeStaleLogs(r, *m), "repo/migrate: failed to clean up log folders")
+}
+
+// detectVersion figures out the layout of repos that don't have a manifest yet
+func detectVersion(r Interface, current int) (int, error) {
+	if IsMemory(r) {
+		return current, nil
+	}
+	fi, err := os.Stat(r.GetPath("log"))
+	if os.IsNotExist(err) {
+		if _, err := os.Stat(r.GetPath("log.v1")); err == nil {
+			// the offset2 migration was interrupted
+			return 1, nil
+		}
+		// nothing there yet
+		return current, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if fi.IsDir() {
+		// offset2
+		return 2, nil
+	}
+
+	// single file offset log
+	return 1, nil
+}
+
+// backup copies the paths listed by the migration to backup/v<from>-<date> and returns that folder
+func backup(r Interface, m Migration) (string, error) {
+	if len(m.Backup) == 0 {
+		return "", nil
+	}
+
+	dst := r.GetPath("backup", fmt.Sprintf("v%d-%s", m.From, time.Now().Format("2006-01-02_15-04-05")))
+	for _, p := range m.Backup {
+		src := r.GetPath(p)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyPath(filepath.Join(dst, p), src); err != nil {
+			return "", errors.Wrapf(err, "failed to copy %s", p)
+		}
+	}
+	return dst, nil
+}
+
+// copyPath recursivly copies the file or folder src to dst
+func copyPath(dst, src string) error {
+	return filepath.Walk(src, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, pth)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		return copyFile(target, pth)
+	})
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/codec/msgpack"
+	"go.cryptoscope.co/margaret/framing/lengthprefixed"
+	"go.cryptoscope.co/margaret/offset"
+	"go.cryptoscope.co/margaret/offset2"
+
+	"go.cryptoscope.co/ssb/message"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		From:   1,
+		Name:   "offset2",
+		Backup: []string{"log"},
+		Run:    migrateOffset2,
+	})
+}
+
+// migrateOffset2 copies the v1 offset log (a single file) into an offset2 log (data, journal and offset files in a folder).
+// v2 offers a much denser encoding (less gaps)
+//
+// The new log is written to log.offset2 and only moved in place once it is complete.
+// The v1 log is moved to log.v1 for the moment in between, so that an interrupted migration can pick it up again.
+func migrateOffset2(r Interface) error {
+	logPath := r.GetPath("log")
+	v1Path := r.GetPath("log.v1")
+	tmpPath := r.GetPath("log.offset2")
+
+	if _, err := os.Stat(logPath); os.IsNotExist(err) {
+		// interrupted after the v1 log was moved aside, the copy might be incomplete
+		if err := os.Rename(v1Path, logPath); err != nil {
+			return errors.Wrap(err, "offset2: failed to restore v1 log")
+		}
+	}
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return errors.Wrap(err, "offset2: failed to remove previous attempt")
+	}
+
+	fromFile, err := os.OpenFile(logPath, os.O_RDWR, 0600)
+	if err != nil {
+		return errors.Wrap(err, "offset2: failed to open v1 log")
+	}
+	defer fromFile.Close()
+
+	from, err := offset.New(fromFile, lengthprefixed.New32(16*1024), msgpack.New(&message.StoredMessage{}))
+	if err != nil {
+		return errors.Wrap(err, "offset2: failed to read v1 log")
+	}
+
+	var to margaret.Log
+	to, err = offset2.Open(tmpPath, msgpack.New(&message.StoredMessage{}))
+	if err != nil {
+		return errors.Wrap(err, "offset2: failed to create v2 log")
+	}
+	toCloser := to.(io.Closer)
+
+	src, err := from.Query()
+	if err != nil {
+		toCloser.Close()
+		return errors.Wrap(err, "offset2: failed to query v1 log")
+	}
+
+	err = luigi.Pump(context.TODO(), luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+		_, err = to.Append(v)
+		return err
+	}), src)
+	if err != nil {
+		toCloser.Close()
+		return errors.Wrap(err, "offset2: failed to copy messages")
+	}
+
+	if err := toCloser.Close(); err != nil {
+		return errors.Wrap(err, "offset2: failed to close v2 log")
+	}
+	if err := fromFile.Close(); err != nil {
+		return errors.Wrap(err, "offset2: failed to close v1 log")
+	}
+
+	if err := os.Rename(logPath, v1Path); err != nil {
+		return errors.Wrap(err, "offset2: failed to move v1 log aside")
+	}
+	if err := os.Rename(tmpPath, logPath); err != nil {
+		return errors.Wrap(err, "offset2: failed to move v2 log in place")
+	}
+
+	// the backup step made a copy of it
+	return errors.Wrap(os.Remove(v1Path), "offset2: failed to remove v1 log")
+}
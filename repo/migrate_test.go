@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/codec/msgpack"
+	"go.cryptoscope.co/margaret/framing/lengthprefixed"
+	"go.cryptoscope.co/margaret/offset"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+func TestMigrateFresh(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+
+	repo := New(rpath)
+	m, runs, err := Migrate(repo)
+	r.NoError(err)
+	r.Equal(CurrentVersion, m.Version)
+	r.Len(runs, 0)
+
+	m2, err := ReadManifest(repo)
+	r.NoError(err)
+	r.Equal(m.Version, m2.Version)
+
+	m2.Version = CurrentVersion + 1
+	r.NoError(WriteManifest(repo, *m2))
+
+	_, _, err = Migrate(repo)
+	r.Error(err)
+	_, ok := err.(ErrRepoTooNew)
+	r.True(ok, "wrong error: %v", err)
+}
+
+func TestMigrateSteps(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+
+	repo := New(rpath)
+	r.NoError(WriteManifest(repo, Manifest{Version: 1}))
+	r.NoError(ioutil.WriteFile(repo.GetPath("state"), []byte("one"), 0600))
+
+	var ran []int
+	table := map[int]Migration{
+		1: {From: 1, Name: "one", Backup: []string{"state"}, Run: func(Interface) error {
+			ran = append(ran, 1)
+			return ioutil.WriteFile(repo.GetPath("state"), []byte("two"), 0600)
+		}},
+		2: {From: 2, Name: "two", Run: func(Interface) error {
+			ran = append(ran, 2)
+			return nil
+		}},
+	}
+
+	m, runs, err := runMigrations(repo, table, 3)
+	r.NoError(err)
+	r.Equal(3, m.Version)
+	r.Equal([]int{1, 2}, ran)
+	r.Len(runs, 2)
+	r.Equal("two", runs[1].Name)
+	r.Equal(3, runs[1].Version)
+	r.Equal("", runs[1].Backup)
+
+	backups, err := filepath.Glob(repo.GetPath("backup", "v1-*", "state"))
+	r.NoError(err)
+	r.Len(backups, 1)
+	r.Equal(filepath.Dir(backups[0]), runs[0].Backup)
+	old, err := ioutil.ReadFile(backups[0])
+	r.NoError(err)
+	r.Equal("one", string(old))
+
+	// nothing to do anymore
+	_, runs, err = runMigrations(repo, table, 3)
+	r.NoError(err)
+	r.Equal([]int{1, 2}, ran)
+	r.Len(runs, 0)
+
+	_, _, err = runMigrations(repo, table, 4)
+	r.Error(err, "no migration from 3")
+}
+
+func TestMigrateOffset2(t *testing.T) {
+	t.Run("fresh", testMigrateOffset2(nil))
+	t.Run("interrupted", testMigrateOffset2(func(repo Interface) error {
+		// the state after the v1 log was moved aside, with a partial copy
+		if err := os.Rename(repo.GetPath("log"), repo.GetPath("log.v1")); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(repo.GetPath("log.offset2"), 0700); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(repo.GetPath("log.offset2", "data"), []byte("partial"), 0600)
+	}))
+}
+
+func testMigrateOffset2(interrupt func(Interface) error) func(*testing.T) {
+	return func(t *testing.T) {
+		r := require.New(t)
+
+		rpath, err := ioutil.TempDir("", "migrate")
+		r.NoError(err)
+		defer os.RemoveAll(rpath)
+
+		repo := New(rpath)
+
+		// create a v1 log
+		f, err := os.Create(repo.GetPath("log"))
+		r.NoError(err)
+		v1, err := offset.New(f, lengthprefixed.New32(16*1024), msgpack.New(&message.StoredMessage{}))
+		r.NoError(err)
+
+		const n = 10
+		for i := 0; i < n; i++ {
+			_, err := v1.Append(message.StoredMessage{
+				Author:    &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+				Key:       &ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)},
+				Sequence:  margaret.BaseSeq(i + 1),
+				Timestamp: time.Now(),
+				Raw:       []byte(`{}`),
+			})
+			r.NoError(err)
+		}
+		r.NoError(f.Close())
+
+		if interrupt != nil {
+			r.NoError(interrupt(repo))
+		}
+
+		m, runs, err := Migrate(repo)
+		r.NoError(err)
+		r.Equal(CurrentVersion, m.Version)
+		r.Len(runs, 1)
+		r.Equal("offset2", runs[0].Name)
+
+		rl, err := OpenLog(repo)
+		r.NoError(err)
+		seq, err := rl.Seq().Value()
+		r.NoError(err)
+		r.Equal(margaret.BaseSeq(n-1), seq)
+
+		if interrupt == nil { // the interrupted run made it before
+			backups, err := filepath.Glob(repo.GetPath("backup", "v1-*", "log"))
+			r.NoError(err)
+			r.Len(backups, 1)
+			r.Equal(filepath.Dir(backups[0]), runs[0].Backup)
+		}
+
+		for _, leftover := range []string{"log.v1", "log.offset2"} {
+			_, err = os.Stat(repo.GetPath(leftover))
+			r.True(os.IsNotExist(err), "%s should be gone", leftover)
+		}
+	}
+}
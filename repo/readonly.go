@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/margaret"
+)
+
+// NewReadOnly returns the repo at basePath for inspection tools that must not change it.
+// OpenLog hands out logs that refuse appends and nulling. The databases of multilogs and indexes are opened read-only
+// and serving them fails. Lock refuses it, it needs to be locked with LockReadOnly.
+func NewReadOnly(basePath string) Interface {
+	return repo{basePath: basePath, readOnly: true}
+}
+
+// IsReadOnly returns true if r was created by NewReadOnly
+func IsReadOnly(r Interface) bool {
+	rr, ok := r.(repo)
+	return ok && rr.readOnly
+}
+
+// ErrReadOnly is returned when a repo created by NewReadOnly would be changed
+var ErrReadOnly = errors.New("repo: opened read-only")
+
+// openBadger opens the database at dbPath, creating it unless r is read-only
+func openBadger(r Interface, dbPath string) (*badger.DB, error) {
+	opts := badgerOpts(dbPath)
+	if IsReadOnly(r) {
+		opts.ReadOnly = true
+	} else if err := os.MkdirAll(dbPath, 0700); err != nil {
+		return nil, errors.Wrapf(err, "mkdir error for %q", dbPath)
+	}
+
+	db, err := badger.Open(opts)
+	return db, errors.Wrap(err, "db/idx: badger failed to open")
+}
+
+// readOnlyLog is what OpenLog returns for read-only repos
+type readOnlyLog struct {
+	margaret.Log
+}
+
+func (readOnlyLog) Append(interface{}) (margaret.Seq, error) {
+	return nil, ErrReadOnly
+}
+
+func (readOnlyLog) Null(margaret.Seq) error {
+	return ErrReadOnly
+}
+
+func (readOnlyLog) Replace(margaret.Seq, []byte) error {
+	return ErrReadOnly
+}
+
+func (l readOnlyLog) Close() error {
+	if c, ok := l.Log.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// readOnlyServe is the ServeFunc of the multilogs and indexes of read-only repos
+func readOnlyServe(ctx context.Context, rootLog margaret.Log, live bool) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+func TestReadOnly(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+
+	rw := New(rpath)
+	rl, err := OpenLog(rw)
+	r.NoError(err)
+	_, err = rl.Append(message.StoredMessage{
+		Author: &ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)},
+		Key:    &ssb.MessageRef{Algo: "sha256", Hash: make([]byte, 32)},
+		Raw:    []byte(`{}`),
+	})
+	r.NoError(err)
+	r.NoError(rl.(io.Closer).Close())
+
+	noop := func(context.Context, margaret.Seq, interface{}, multilog.MultiLog) error { return nil }
+	_, db, _, err := OpenMultiLog(rw, "test", noop)
+	r.NoError(err)
+	r.NoError(db.Close())
+
+	ro := NewReadOnly(rpath)
+	r.True(IsReadOnly(ro))
+	r.False(IsReadOnly(rw))
+
+	_, err = Lock(ro)
+	r.Equal(ErrReadOnly, errors.Cause(err))
+	lck, err := LockReadOnly(ro)
+	r.NoError(err)
+	defer lck.Close()
+
+	rl, err = OpenLog(ro)
+	r.NoError(err)
+	defer rl.(io.Closer).Close()
+
+	_, err = rl.Get(margaret.BaseSeq(0))
+	r.NoError(err)
+	_, err = rl.Append(message.StoredMessage{})
+	r.Equal(ErrReadOnly, err)
+	r.Equal(ErrReadOnly, rl.(margaret.Alterer).Null(margaret.BaseSeq(0)))
+
+	_, db, serve, err := OpenMultiLog(ro, "test", noop)
+	r.NoError(err)
+	defer db.Close()
+	r.Equal(ErrReadOnly, serve(context.TODO(), rl, false))
+
+	err = WriteManifest(ro, Manifest{Version: CurrentVersion})
+	r.Equal(ErrReadOnly, errors.Cause(err))
+}
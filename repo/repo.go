@@ -28,6 +28,7 @@ func New(basePath string) Interface {
 
 type repo struct {
 	basePath string
+	readOnly bool
 }
 
 func (r repo) GetPath(rel ...string) string {
@@ -43,40 +44,36 @@ type ServeFunc func(context.Context, margaret.Log, bool) error
 // Exposes the badger db for 100% hackability. This will go away in future versions!
 // badger + librarian as index
 func OpenMultiLog(r Interface, name string, f multilog.Func) (multilog.MultiLog, *badger.DB, ServeFunc, error) {
-
-	dbPath := r.GetPath(PrefixMultiLog, name, "db")
-	err := os.MkdirAll(dbPath, 0700)
-	if err != nil {
-		return nil, nil, nil, errors.Wrapf(err, "mkdir error for %q", dbPath)
+	if mr, ok := r.(*memRepo); ok {
+		mlog := mr.multiLog(name)
+		return mlog, nil, mlog.serve(f), nil
 	}
 
-	db, err := badger.Open(badgerOpts(dbPath))
+	dbPath := r.GetPath(PrefixMultiLog, name, "db")
+	db, err := openBadger(r, dbPath)
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "db/idx: badger failed to open")
+		return nil, nil, nil, err
 	}
 
 	mlog := multibadger.New(db, msgpack.New(margaret.BaseSeq(0)))
-
-	statePath := r.GetPath(PrefixMultiLog, name, "state.json")
-	mode := os.O_RDWR | os.O_EXCL
-	if _, err := os.Stat(statePath); os.IsNotExist(err) {
-		mode |= os.O_CREATE
-	}
-	idxStateFile, err := os.OpenFile(statePath, mode, 0700)
-	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error opening state file")
+	if IsReadOnly(r) {
+		return mlog, db, readOnlyServe, nil
 	}
 
-	mlogSink := multilog.NewSink(idxStateFile, mlog, f)
-
+	// the state file is only held while serving, so that opening the multilog just to read it leaves nothing open besides db
+	statePath := r.GetPath(PrefixMultiLog, name, "state.json")
 	serve := func(ctx context.Context, rootLog margaret.Log, live bool) error {
-		/*
-			defer func() {
-				// todo: fsck
-				log.Printf("mlog %s: badger closed: %v", name, errors.Wrapf(db.Close(), "failed to close badger db %s", dbPath))
-				log.Printf("mlog %s: state file closed:%v", name, errors.Wrapf(idxStateFile.Close(), "failed to close index file %s", statePath))
-			}()
-		*/
+		mode := os.O_RDWR | os.O_EXCL
+		if _, err := os.Stat(statePath); os.IsNotExist(err) {
+			mode |= os.O_CREATE
+		}
+		idxStateFile, err := os.OpenFile(statePath, mode, 0700)
+		if err != nil {
+			return errors.Wrap(err, "error opening state file")
+		}
+		defer idxStateFile.Close()
+
+		mlogSink := multilog.NewSink(idxStateFile, mlog, f)
 		src, err := rootLog.Query(margaret.Live(live), margaret.SeqWrap(true), mlogSink.QuerySpec())
 		if err != nil {
 			return errors.Wrap(err, "error querying rootLog for mlog")
@@ -95,20 +92,28 @@ func OpenMultiLog(r Interface, name string, f multilog.Func) (multilog.MultiLog,
 
 const PrefixIndex = "indexes"
 
+// OpenIndex opens the index with the passed name. The index handed to f is a librarian.SeqSetterIndex.
+// For in-memory repos the returned database is nil and the index implements PrefixIterator.
 func OpenIndex(r Interface, name string, f func(librarian.Index) librarian.SinkIndex) (librarian.Index, *badger.DB, ServeFunc, error) {
-	pth := r.GetPath(PrefixIndex, name, "db")
-	err := os.MkdirAll(pth, 0700)
-	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error making index directory")
-	}
+	var (
+		idx librarian.SeqSetterIndex
+		db  *badger.DB
+	)
+	if mr, ok := r.(*memRepo); ok {
+		idx = mr.index(name)
+	} else {
+		var err error
+		db, err = openBadger(r, r.GetPath(PrefixIndex, name, "db"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
 
-	db, err := badger.Open(badgerOpts(pth))
-	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "db/idx: badger failed to open")
+		idx = libbadger.NewIndex(db, 0)
 	}
-
-	idx := libbadger.NewIndex(db, 0)
 	sinkidx := f(idx)
+	if IsReadOnly(r) {
+		return idx, db, readOnlyServe, nil
+	}
 
 	serve := func(ctx context.Context, rootLog margaret.Log, live bool) error {
 		/*
@@ -135,18 +140,18 @@ func OpenIndex(r Interface, name string, f func(librarian.Index) librarian.SinkI
 }
 
 func OpenBadgerIndex(r Interface, name string, f func(*badger.DB) librarian.SinkIndex) (*badger.DB, librarian.SinkIndex, ServeFunc, error) {
-	pth := r.GetPath(PrefixIndex, name, "db")
-	err := os.MkdirAll(pth, 0700)
-	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error making index directory")
+	if IsMemory(r) {
+		return nil, nil, nil, ErrNeedsDisk
 	}
-
-	db, err := badger.Open(badgerOpts(pth))
+	db, err := openBadger(r, r.GetPath(PrefixIndex, name, "db"))
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "db/idx: badger failed to open")
+		return nil, nil, nil, err
 	}
 
 	sinkidx := f(db)
+	if IsReadOnly(r) {
+		return db, sinkidx, readOnlyServe, nil
+	}
 
 	serve := func(ctx context.Context, rootLog margaret.Log, live bool) error {
 		/*
@@ -173,6 +178,9 @@ func OpenBadgerIndex(r Interface, name string, f func(*badger.DB) librarian.Sink
 }
 
 func OpenBlobStore(r Interface) (ssb.BlobStore, error) {
+	if mr, ok := r.(*memRepo); ok {
+		return mr.blobStore(), nil
+	}
 	bs, err := blobstore.New(r.GetPath("blobs"))
 	return bs, errors.Wrap(err, "error opening blob store")
 }
@@ -9,10 +9,14 @@ import (
 )
 
 func OpenKeyPair(r Interface) (*ssb.KeyPair, error) {
+	if mr, ok := r.(*memRepo); ok {
+		return mr.getKeyPair()
+	}
+
 	secPath := r.GetPath("secret")
 	keyPair, err := ssb.LoadKeyPair(secPath)
 	if err != nil {
-		if !os.IsNotExist(errors.Cause(err)) {
+		if !os.IsNotExist(errors.Cause(err)) || IsReadOnly(r) {
 			return nil, errors.Wrap(err, "repo: error opening key pair")
 		}
 
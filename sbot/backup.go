@@ -0,0 +1,353 @@
+package sbot
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// Backup writes a consistent snapshot of the repo into the folder at path, while the bot keeps running.
+//
+// Each index is saved as a badger backup first. Multilogs keep their state outside of the database,
+// so their serving is paused while they are saved. Publishing is blocked while the user feeds are paused,
+// since it needs them to find the latest message of our feed. Afterwards the root log is copied up to it's current sequence,
+// which makes sure no index is ahead of the log. On restore they catch up from where they were.
+//
+// The secret is only included if withSecret is true.
+func (s *Sbot) Backup(path string, withSecret bool) (*repo.BackupManifest, error) {
+	if repo.IsMemory(s.repo) {
+		return nil, errors.Wrap(repo.ErrNeedsDisk, "sbot/backup")
+	}
+	if err := createEmptyDir(path); err != nil {
+		return nil, errors.Wrap(err, "sbot/backup")
+	}
+
+	m := repo.BackupManifest{
+		Version: s.manifest.Version,
+		Created: time.Now(),
+		Indexes: make(map[string]int),
+		Secret:  withSecret,
+	}
+
+	// claim all the indexes so that they aren't rebuilt while we copy them
+	s.indexLock.Lock()
+	var handles []*indexHandle
+	for _, h := range s.indexes {
+		if h.busy {
+			s.indexLock.Unlock()
+			releaseIndexes(s, handles)
+			return nil, errors.Errorf("sbot/backup: %s is being rebuilt or backed up", h.name)
+		}
+		h.busy = true
+		handles = append(handles, h)
+		m.Indexes[h.name] = s.manifest.Indexes[h.name]
+	}
+	s.indexLock.Unlock()
+	defer releaseIndexes(s, handles)
+
+	sort.Slice(handles, func(i, j int) bool { return handles[i].name < handles[j].name })
+	for _, h := range handles {
+		start := time.Now()
+		if err := s.backupIndex(h, path); err != nil {
+			return nil, errors.Wrapf(err, "sbot/backup: failed to save %s", h.name)
+		}
+		s.info.Log("event", "backup", "idx", h.name, "took", time.Since(start))
+	}
+
+	sv, err := s.RootLog.Seq().Value()
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/backup: failed to get root log sequence")
+	}
+	m.Seq = sv.(margaret.Seq).Seq()
+
+	start := time.Now()
+	if err := copyLogTo(repo.New(path), s.RootLog, m.Seq); err != nil {
+		return nil, errors.Wrap(err, "sbot/backup: failed to copy root log")
+	}
+	s.info.Log("event", "backup", "log", m.Seq+1, "took", time.Since(start))
+
+	if withSecret {
+		if err := copyFile(filepath.Join(path, "secret"), s.repo.GetPath("secret")); err != nil {
+			return nil, errors.Wrap(err, "sbot/backup: failed to copy secret")
+		}
+	}
+
+	if err := repo.WriteBackupManifest(path, m); err != nil {
+		return nil, errors.Wrap(err, "sbot/backup")
+	}
+	return &m, nil
+}
+
+func releaseIndexes(s *Sbot, handles []*indexHandle) {
+	s.indexLock.Lock()
+	for _, h := range handles {
+		h.busy = false
+	}
+	s.indexLock.Unlock()
+}
+
+// backupIndex writes the database of the index (and the state file of multilogs) into the backup folder
+func (s *Sbot) backupIndex(h *indexHandle, path string) error {
+	if h.db == nil {
+		return errors.Errorf("index has no database")
+	}
+	dir := filepath.Join(append([]string{path}, h.dir...)...)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, repo.BadgerBackupName), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	isMultiLog := h.dir[0] == repo.PrefixMultiLog
+	if !isMultiLog {
+		// these keep their state in the same database and updating them twice doesn't change anything.
+		// a snapshot of the database is all we need.
+		if _, err := h.db.Backup(f, 0); err != nil {
+			return errors.Wrap(err, "badger backup failed")
+		}
+		return f.Close()
+	}
+
+	// appending to sublogs isn't idempotent, the state file needs to match the database exactly
+	if h.name == multilogs.IndexNameFeeds {
+		// publishing needs to see our latest message in there
+		s.publisher.Lock()
+		defer s.publisher.Unlock()
+	}
+	h.pause()
+	defer s.serveIndex(h)
+
+	if _, err := h.db.Backup(f, 0); err != nil {
+		return errors.Wrap(err, "badger backup failed")
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return copyFile(filepath.Join(dir, "state.json"), s.repo.GetPath(append(h.dir, "state.json")...))
+}
+
+// Restore creates a repo at repoPath from the backup at backupPath, which was made by Backup.
+// It checks that the backup is complete, lets the indexes catch up with the log and runs FSCK on the result.
+// The returned report lists the problems that were found, the error is non-nil if there are any.
+// If the backup doesn't include the secret, a new one is created for the restored repo.
+func Restore(backupPath, repoPath string, hmacSecret *[32]byte) (*FSCKReport, error) {
+	m, err := repo.ReadBackupManifest(backupPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/restore")
+	}
+	if m.Version != repo.CurrentVersion {
+		return nil, errors.Errorf("sbot/restore: backup has layout version %d, only %d is supported", m.Version, repo.CurrentVersion)
+	}
+
+	backup := repo.New(backupPath)
+	if err := validateBackup(backup, m); err != nil {
+		return nil, errors.Wrap(err, "sbot/restore: invalid backup")
+	}
+
+	if err := createEmptyDir(repoPath); err != nil {
+		return nil, errors.Wrap(err, "sbot/restore")
+	}
+	r := repo.New(repoPath)
+
+	lck, err := repo.Lock(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/restore")
+	}
+	defer lck.Close()
+
+	backupLog, err := repo.OpenLog(backup)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/restore: failed to open log of backup")
+	}
+	err = copyLogTo(r, backupLog, m.Seq)
+	backupLog.(io.Closer).Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/restore: failed to copy log")
+	}
+
+	for name := range m.Indexes {
+		dir := indexFolders[name]
+		f, err := os.Open(backup.GetPath(append(dir, repo.BadgerBackupName)...))
+		if err != nil {
+			return nil, errors.Wrapf(err, "sbot/restore: failed to open backup of %s", name)
+		}
+		err = repo.LoadBadger(r.GetPath(append(dir, "db")...), f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "sbot/restore: failed to restore %s", name)
+		}
+
+		if dir[0] == repo.PrefixMultiLog {
+			err := copyFile(r.GetPath(append(dir, "state.json")...), backup.GetPath(append(dir, "state.json")...))
+			if err != nil {
+				return nil, errors.Wrapf(err, "sbot/restore: failed to restore state of %s", name)
+			}
+		}
+	}
+
+	if m.Secret {
+		if err := copyFile(r.GetPath("secret"), backup.GetPath("secret")); err != nil {
+			return nil, errors.Wrap(err, "sbot/restore: failed to restore secret")
+		}
+	}
+
+	err = repo.WriteManifest(r, repo.Manifest{Version: m.Version, Indexes: m.Indexes})
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/restore")
+	}
+
+	// indexes might be a bit behind the log
+	if err := RebuildIndicies(repoPath); err != nil {
+		return nil, errors.Wrap(err, "sbot/restore: failed to update indexes")
+	}
+
+	rep, err := FSCK(r, hmacSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/restore: failed to check restored repo")
+	}
+	if n := len(rep.Problems); n > 0 {
+		return rep, errors.Errorf("sbot/restore: restored repo has %d problems", n)
+	}
+	return rep, nil
+}
+
+// validateBackup checks that all the parts listed in the manifest are there
+func validateBackup(backup repo.Interface, m *repo.BackupManifest) error {
+	for name, v := range m.Indexes {
+		dir, ok := indexFolders[name]
+		if !ok {
+			return errors.Errorf("unknown index %q", name)
+		}
+		if want := indexVersions[name]; v != want {
+			return errors.Errorf("index %s has version %d, expected %d", name, v, want)
+		}
+		if _, err := os.Stat(backup.GetPath(append(dir, repo.BadgerBackupName)...)); err != nil {
+			return errors.Wrapf(err, "missing database of %s", name)
+		}
+		if dir[0] == repo.PrefixMultiLog {
+			if _, err := os.Stat(backup.GetPath(append(dir, "state.json")...)); err != nil {
+				return errors.Wrapf(err, "missing state of %s", name)
+			}
+		}
+	}
+
+	if m.Secret {
+		if _, err := os.Stat(backup.GetPath("secret")); err != nil {
+			return errors.Wrap(err, "missing secret")
+		}
+	}
+
+	backupLog, err := repo.OpenLog(backup)
+	if err != nil {
+		return errors.Wrap(err, "failed to open log")
+	}
+	defer backupLog.(io.Closer).Close()
+	sv, err := backupLog.Seq().Value()
+	if err != nil {
+		return errors.Wrap(err, "failed to get log sequence")
+	}
+	if has := sv.(margaret.Seq).Seq(); has != m.Seq {
+		return errors.Errorf("log ends at %d, manifest says %d", has, m.Seq)
+	}
+	return nil
+}
+
+// copyLogTo copies the entries of from up to (and including) upto into the root log of r.
+// Nulled entries stay nulled so that the sequences match.
+func copyLogTo(r repo.Interface, from margaret.Log, upto int64) error {
+	to, err := repo.OpenLog(r)
+	if err != nil {
+		return err
+	}
+	defer to.(io.Closer).Close()
+	alter, ok := to.(margaret.Alterer)
+	if !ok {
+		return errors.Errorf("log can't be altered: %T", to)
+	}
+
+	if upto < 0 {
+		return nil // empty
+	}
+
+	src, err := from.Query(margaret.Limit(int(upto + 1)))
+	if err != nil {
+		return errors.Wrap(err, "failed to query log")
+	}
+
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+		if err, ok := v.(error); ok {
+			if !margaret.IsErrNulled(err) {
+				return err
+			}
+			seq, err := to.Append(message.StoredMessage{})
+			if err != nil {
+				return errors.Wrap(err, "failed to append placeholder for nulled entry")
+			}
+			return alter.Null(seq)
+		}
+		_, err = to.Append(v)
+		return err
+	})
+	return luigi.Pump(context.TODO(), snk, src)
+}
+
+// createEmptyDir makes sure that path is an empty folder
+func createEmptyDir(path string) error {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	if len(fis) > 0 {
+		var names []string
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+		return errors.Errorf("%s is not empty (%s)", path, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
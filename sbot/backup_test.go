@@ -0,0 +1,82 @@
+package sbot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cryptix/go/logging/logtest"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestBackupRestore(t *testing.T) {
+	r := require.New(t)
+
+	os.RemoveAll("testrun")
+
+	mainLog, _ := logtest.KitLogger(t.Name(), t)
+	bot, err := New(
+		WithInfo(mainLog),
+		WithRepoPath(filepath.Join("testrun", t.Name(), "bot")),
+		DisableNetworkNode())
+	r.NoError(err)
+
+	const n = 25
+	for i := 0; i < n; i++ {
+		_, err := bot.PublishLog.Append(map[string]interface{}{
+			"type": "test",
+			"i":    i,
+		})
+		r.NoError(err)
+	}
+
+	backupPath := filepath.Join("testrun", t.Name(), "backup")
+	m, err := bot.Backup(backupPath, false)
+	r.NoError(err)
+	r.Equal(int64(n-1), m.Seq)
+	r.False(m.Secret)
+	r.Len(m.Indexes, len(indexFolders))
+
+	_, err = os.Stat(filepath.Join(backupPath, "secret"))
+	r.True(os.IsNotExist(err), "secret should not be included")
+
+	_, err = bot.Backup(backupPath, true)
+	r.Error(err, "backup folder not empty")
+
+	// still indexing after the pause
+	_, err = bot.PublishLog.Append(map[string]interface{}{"type": "test", "i": n})
+	r.NoError(err)
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+
+	restorePath := filepath.Join("testrun", t.Name(), "restored")
+	rep, err := Restore(backupPath, restorePath, nil)
+	r.NoError(err)
+	r.Equal(n, rep.Messages)
+	r.Len(rep.Problems, 0)
+
+	restored, err := New(
+		WithInfo(mainLog),
+		WithRepoPath(restorePath),
+		DisableNetworkNode())
+	r.NoError(err)
+
+	testLog, err := restored.MessageTypes.Get(librarian.Addr("test"))
+	r.NoError(err)
+	seqv, err := testLog.Seq().Value()
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(n-1), seqv)
+
+	restored.Shutdown()
+	r.NoError(restored.Close())
+
+	// incomplete backups are refused
+	r.NoError(os.RemoveAll(filepath.Join(backupPath, repo.PrefixMultiLog, "userFeeds", "state.json")))
+	_, err = Restore(backupPath, filepath.Join("testrun", t.Name(), "restored2"), nil)
+	r.Error(err)
+}
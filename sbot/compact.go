@@ -0,0 +1,56 @@
+package sbot
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// Compact removes the nulled entries from the root log of the repo at path and rebuilds all the indexes,
+// since they point to sequences of the log which are shifted by this.
+// The indexes are dropped before the compacted log is moved into place, if this is interrupted they are rebuilt on the next start.
+//
+// The bot must not be running. Compacting while it runs would mean switching the log, every index
+// and every open query on them over to the new sequences at once, while replication keeps appending.
+// Use ScheduleCompaction to have a running bot compact it's log the next time it starts instead.
+func Compact(path string) (*repo.CompactReport, error) {
+	r := repo.New(path)
+
+	lck, err := repo.Lock(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Compact")
+	}
+	defer lck.Close()
+
+	rep, err := repo.CompactLog(r, func() error { return DropIndicies(r) })
+	if err != nil {
+		return nil, errors.Wrap(err, "Compact: failed to compact root log")
+	}
+	log.Printf("compacted log: dropped %d of %d entries", rep.Dropped, rep.Entries)
+	if rep.Dropped == 0 {
+		return rep, nil
+	}
+	return rep, errors.Wrap(RebuildIndicies(path), "Compact: failed to rebuild indexes")
+}
+
+// ScheduleCompaction marks the log to be compacted (see Compact) the next time the bot starts.
+func (s *Sbot) ScheduleCompaction() error {
+	if repo.IsMemory(s.repo) {
+		return errors.Wrap(repo.ErrNeedsDisk, "sbot/compact")
+	}
+
+	s.manifestLock.Lock()
+	defer s.manifestLock.Unlock()
+	if s.manifest.CompactPending {
+		return nil
+	}
+	m := *s.manifest
+	m.CompactPending = true
+	if err := repo.WriteManifest(s.repo, m); err != nil {
+		return errors.Wrap(err, "sbot/compact: failed to update manifest")
+	}
+	s.manifest.CompactPending = true
+	return nil
+}
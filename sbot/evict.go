@@ -0,0 +1,169 @@
+package sbot
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/graph"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// DefaultEvictionInterval is used by WithDiskQuota if no interval is passed
+const DefaultEvictionInterval = 10 * time.Minute
+
+// EvictedFeed is a feed that was nulled by the eviction policy
+type EvictedFeed struct {
+	Feed     *ssb.FeedRef
+	Messages int   // number of entries that were nulled
+	Bytes    int64 // size of the nulled messages
+}
+
+// EvictionReport sums up a run of the eviction policy
+type EvictionReport struct {
+	Usage int64 // bytes used by the root log when the run started
+	Quota int64
+
+	Feeds []EvictedFeed
+}
+
+// Bytes returns how much space is freed once the log is compacted
+func (rep EvictionReport) Bytes() int64 {
+	var sum int64
+	for _, f := range rep.Feeds {
+		sum += f.Bytes
+	}
+	return sum
+}
+
+// Evict checks the size of the root log against the disk quota.
+// If it is exceeded, all the stored feeds that are not within hops of the bot and not pinned are nulled.
+// The sublogs of the evicted feeds are removed by rebuilding the user feeds index.
+// Nulling doesn't shrink the log, the space is reclaimed by compacting it the next time the bot starts.
+func (s *Sbot) Evict() (*EvictionReport, error) {
+	if s.diskQuota <= 0 {
+		return nil, errors.Errorf("sbot/evict: no disk quota configured")
+	}
+
+	s.evictLock.Lock()
+	defer s.evictLock.Unlock()
+
+	usage, err := repo.LogSize(s.repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/evict: failed to get log size")
+	}
+	rep := &EvictionReport{Usage: usage, Quota: s.diskQuota}
+	if usage <= s.diskQuota {
+		return rep, nil
+	}
+
+	keep := s.GraphBuilder.Hops(s.KeyPair.Id, int(s.hopCount))
+	if keep == nil {
+		// better to keep everything than to evict the feeds we follow
+		return nil, errors.Errorf("sbot/evict: failed to compute hops")
+	}
+	pinned := graph.NewFeedSet(len(s.pinned) + 1)
+	if err := pinned.AddRef(s.KeyPair.Id); err != nil {
+		return nil, errors.Wrap(err, "sbot/evict: failed to pin self")
+	}
+	for _, ref := range s.pinned {
+		if err := pinned.AddRef(ref); err != nil {
+			return nil, errors.Wrapf(err, "sbot/evict: failed to pin %s", ref.Ref())
+		}
+	}
+
+	stored, err := s.UserFeeds.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/evict: failed to list stored feeds")
+	}
+
+	for _, addr := range stored {
+		ref := &ssb.FeedRef{
+			Algo: "ed25519",
+			ID:   []byte(addr),
+		}
+		if pinned.Has(ref) || keep.Has(ref) {
+			continue
+		}
+
+		n, size, err := nullFeed(s.serveCtx, s.RootLog, s.UserFeeds, ref)
+		if err != nil {
+			return rep, errors.Wrapf(err, "sbot/evict: failed to null %s", ref.Ref())
+		}
+		if n == 0 {
+			continue // evicted in an earlier run
+		}
+		rep.Feeds = append(rep.Feeds, EvictedFeed{
+			Feed:     ref,
+			Messages: n,
+			Bytes:    size,
+		})
+	}
+
+	if len(rep.Feeds) > 0 {
+		// nulled entries are skipped while indexing, the rebuilt index has no sublogs for the evicted feeds
+		if err := s.Reindex(multilogs.IndexNameFeeds, nil); err != nil {
+			return rep, errors.Wrap(err, "sbot/evict: failed to remove sublogs")
+		}
+		if err := s.ScheduleCompaction(); err != nil {
+			return rep, errors.Wrap(err, "sbot/evict: failed to schedule compaction")
+		}
+	}
+	return rep, nil
+}
+
+// evictLoop runs the eviction policy every interval until ctx is canceled
+func (s *Sbot) evictLoop(ctx context.Context) {
+	tick := time.NewTicker(s.evictInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		rep, err := s.Evict()
+		if err != nil {
+			s.info.Log("event", "eviction failed", "err", err)
+			continue
+		}
+		for _, f := range rep.Feeds {
+			s.info.Log("event", "evicted feed", "feed", f.Feed.Ref(), "msgs", f.Messages, "bytes", f.Bytes)
+		}
+		if len(rep.Feeds) > 0 {
+			s.info.Log("event", "eviction done", "usage", rep.Usage, "quota", rep.Quota, "reclaimable", rep.Bytes())
+		}
+	}
+}
+
+// compactPending compacts the log if feeds were evicted or ScheduleCompaction was called while the bot ran the last time.
+// All the indexes are dropped first, they are rebuilt once the bot is opened.
+// Needs to run before the log and the indexes are opened.
+func (s *Sbot) compactPending() error {
+	// the indexes still hold the evicted feeds, even if the log was compacted already
+	if err := DropIndicies(s.repo); err != nil {
+		return errors.Wrap(err, "failed to drop indexes")
+	}
+
+	rep, err := repo.CompactLog(s.repo, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to compact log")
+	}
+	s.info.Log("event", "compacted log", "dropped", rep.Dropped, "reclaimed", rep.Reclaimed())
+
+	// the compaction selected the new log folder in the manifest
+	m, err := repo.ReadManifest(s.repo)
+	if err != nil {
+		return errors.Wrap(err, "failed to read manifest")
+	}
+	m.CompactPending = false
+	if err := repo.WriteManifest(s.repo, *m); err != nil {
+		return errors.Wrap(err, "failed to update manifest")
+	}
+	s.manifest = m
+	return nil
+}
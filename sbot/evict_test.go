@@ -0,0 +1,124 @@
+package sbot
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cryptix/go/logging/logtest"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/archive"
+)
+
+func TestEvict(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	os.RemoveAll(filepath.Join("testrun", t.Name()))
+
+	mainLog, _ := logtest.KitLogger(t.Name(), t)
+	ali, err := New(
+		WithInfo(mainLog),
+		WithRepoPath(filepath.Join("testrun", t.Name(), "ali")),
+		DisableNetworkNode())
+	r.NoError(err)
+
+	const n = 5
+	for i := 0; i < n; i++ {
+		_, err := ali.PublishLog.Append(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+	}
+
+	var arch bytes.Buffer
+	_, err = archive.Export(ctx, &arch, ali.RootLog, ali.UserFeeds, []*ssb.FeedRef{ali.KeyPair.Id})
+	r.NoError(err)
+	ali.Shutdown()
+	r.NoError(ali.Close())
+
+	bobPath := filepath.Join("testrun", t.Name(), "bob")
+	openBob := func(opts ...Option) *Sbot {
+		opts = append(opts,
+			WithInfo(mainLog),
+			WithRepoPath(bobPath),
+			DisableNetworkNode(),
+			WithDiskQuota(1, time.Hour))
+		bob, err := New(opts...)
+		r.NoError(err)
+		return bob
+	}
+
+	// bob stores ali's feed without following her
+	bob := openBob()
+	_, err = bob.PublishLog.Append(map[string]interface{}{"type": "test", "i": 0})
+	r.NoError(err)
+	_, err = archive.Import(ctx, &arch, bob.RootLog, bob.UserFeeds, nil)
+	r.NoError(err)
+
+	aliLog, err := bob.UserFeeds.Get(librarian.Addr(ali.KeyPair.Id.ID))
+	r.NoError(err)
+	for i := 0; ; i++ {
+		v, err := aliLog.Seq().Value()
+		r.NoError(err)
+		if v.(margaret.Seq).Seq() == n-1 {
+			break
+		}
+		r.True(i < 100, "ali's feed wasn't indexed")
+		time.Sleep(50 * time.Millisecond)
+	}
+	bob.Shutdown()
+	r.NoError(bob.Close())
+
+	// pinned feeds stay
+	bob = openBob(WithPinnedFeeds(ali.KeyPair.Id))
+	rep, err := bob.Evict()
+	r.NoError(err)
+	r.Len(rep.Feeds, 0)
+	bob.Shutdown()
+	r.NoError(bob.Close())
+
+	bob = openBob()
+	rep, err = bob.Evict()
+	r.NoError(err)
+	r.Len(rep.Feeds, 1)
+	r.Equal(ali.KeyPair.Id.Ref(), rep.Feeds[0].Feed.Ref())
+	r.Equal(n, rep.Feeds[0].Messages)
+	r.True(rep.Bytes() > 0)
+
+	// the sublog is removed right away
+	feeds, err := bob.UserFeeds.List()
+	r.NoError(err)
+	r.Equal([]librarian.Addr{librarian.Addr(bob.KeyPair.Id.ID)}, feeds)
+
+	// publishing continues on the rebuilt sublog
+	seq, err := bob.PublishLog.Append(map[string]interface{}{"type": "test", "i": 1})
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(1), seq)
+
+	// nothing left to do on the second run
+	rep, err = bob.Evict()
+	r.NoError(err)
+	r.Len(rep.Feeds, 0)
+	bob.Shutdown()
+	r.NoError(bob.Close())
+
+	// the log is compacted on the next start and the sublog is gone
+	bob = openBob()
+	r.False(bob.manifest.CompactPending)
+	feeds, err = bob.UserFeeds.List()
+	r.NoError(err)
+	r.Len(feeds, 1)
+	r.Equal(librarian.Addr(bob.KeyPair.Id.ID), feeds[0])
+
+	v, err := bob.RootLog.Seq().Value()
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(0), v)
+	bob.Shutdown()
+	r.NoError(bob.Close())
+}
@@ -100,6 +100,18 @@ func TestFeedsOneByOne(t *testing.T) {
 		a.Equal(margaret.BaseSeq(i), seqv, "check run %d", i)
 	}
 
+	// bob got them from ali
+	msg, err := bob.GetByAuthorSeq(*ali.KeyPair.Id, 1)
+	r.NoError(err)
+	prov, err := bob.Provenance(*msg.Key)
+	r.NoError(err)
+	r.Equal(ali.KeyPair.Id.Ref(), prov.From.Ref())
+	r.Equal(msg.Timestamp.Unix(), prov.Received.Unix())
+
+	// ali published it herself
+	_, err = ali.Provenance(*msg.Key)
+	r.Equal(ssb.ErrNotFound, errors.Cause(err))
+
 	ali.Shutdown()
 	bob.Shutdown()
 
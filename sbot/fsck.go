@@ -0,0 +1,411 @@
+package sbot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// FSCKProblem is one inconsistency found by FSCK
+type FSCKProblem struct {
+	// Seq is the root log sequence of the offending entry, -1 if the problem isn't tied to one.
+	// Only the entries of log problems with a sequence are nulled by FSCKRepair.
+	Seq int64
+
+	// Index names the index the problem was found in, empty for problems with the root log itself
+	Index string
+
+	Reason string
+}
+
+func (p FSCKProblem) String() string {
+	where := "log"
+	if p.Index != "" {
+		where = p.Index
+	}
+	return fmt.Sprintf("%s(%d): %s", where, p.Seq, p.Reason)
+}
+
+// FSCKReport is the result of a repository check
+type FSCKReport struct {
+	Messages int // valid messages in the root log
+	Nulled   int // nulled entries in the root log
+
+	Problems []FSCKProblem
+}
+
+// InvalidEntries returns the root log sequences of the entries that didn't pass verification
+func (rep FSCKReport) InvalidEntries() []margaret.Seq {
+	var seqs []margaret.Seq
+	for _, p := range rep.Problems {
+		if p.Index == "" && p.Seq >= 0 {
+			seqs = append(seqs, margaret.BaseSeq(p.Seq))
+		}
+	}
+	return seqs
+}
+
+// BrokenIndexes returns the names of the indexes that don't match the root log
+func (rep FSCKReport) BrokenIndexes() []string {
+	set := make(map[string]struct{})
+	for _, p := range rep.Problems {
+		if p.Index != "" {
+			set[p.Index] = struct{}{}
+		}
+	}
+	var names []string
+	for n := range set {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chainState is the last valid message of a feed seen while walking the root log
+type chainState struct {
+	seq margaret.BaseSeq
+	key *ssb.MessageRef
+
+	rootSeqs []int64
+}
+
+// FSCK walks the root log, verifies the signature of each message and checks the sequence and previous hash continuity of each feed.
+// It then cross-checks the user feeds, the get index and the tangles against it.
+// It holds a read-only lock of the repo while it runs.
+func FSCK(r repo.Interface, hmacSecret *[32]byte) (*FSCKReport, error) {
+	ctx := context.Background()
+
+	lck, err := repo.LockReadOnly(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "fsck")
+	}
+	defer lck.Close()
+
+	rootLog, err := repo.OpenLog(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "fsck: root-log open failed")
+	}
+	if c, ok := rootLog.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	var (
+		rep     FSCKReport
+		feeds   = make(map[string]*chainState)
+		tangles = make(map[string][]int64)
+		msgSeqs = make(map[string]int64)
+	)
+
+	src, err := rootLog.Query(margaret.SeqWrap(true))
+	if err != nil {
+		return nil, errors.Wrap(err, "fsck: failed to query root log")
+	}
+
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return errors.Errorf("fsck: expected sequence wrapper, got %T", v)
+		}
+		rxSeq := sw.Seq().Seq()
+
+		problem := func(format string, args ...interface{}) error {
+			rep.Problems = append(rep.Problems, FSCKProblem{Seq: rxSeq, Reason: fmt.Sprintf(format, args...)})
+			return nil
+		}
+
+		switch tv := sw.Value().(type) {
+		case error:
+			if margaret.IsErrNulled(tv) {
+				rep.Nulled++
+				return nil
+			}
+			return problem("failed to read entry: %s", tv)
+
+		case message.StoredMessage:
+			author := string(tv.Author.ID)
+			state, has := feeds[author]
+			if !has {
+				state = &chainState{}
+				feeds[author] = state
+			}
+			// the chain continues after a broken entry, so that the rest of the feed isn't reported (and nulled) as well.
+			// the next message refers to the key that was stored for it.
+			skip := func() {
+				state.seq = tv.Sequence
+				state.key = tv.Key
+				state.rootSeqs = append(state.rootSeqs, rxSeq)
+			}
+
+			ref, dmsg, err := message.Verify(tv.Raw, hmacSecret)
+			if err != nil {
+				skip()
+				return problem("verify failed: %s", err)
+			}
+			if !bytes.Equal(ref.Hash, tv.Key.Hash) {
+				skip()
+				return problem("stored key %s doesn't match computed %s", tv.Key.Ref(), ref.Ref())
+			}
+			if !bytes.Equal(dmsg.Author.ID, tv.Author.ID) || dmsg.Sequence != tv.Sequence {
+				skip()
+				return problem("stored author or sequence doesn't match the signed message")
+			}
+
+			switch {
+			case state.key == nil && dmsg.Sequence != 1, state.key != nil && dmsg.Sequence > state.seq+1:
+				// the messages in between were nulled, that doesn't make this one invalid
+				rep.Problems = append(rep.Problems, FSCKProblem{Seq: -1, Reason: fmt.Sprintf("feed %s: messages %d to %d are missing", dmsg.Author.Ref(), state.seq+1, dmsg.Sequence-1)})
+			case state.key != nil && dmsg.Sequence <= state.seq:
+				// a fork or a duplicate, the chain continues with the message we already have
+				return problem("feed %s: expected sequence %d, got %d", dmsg.Author.Ref(), state.seq+1, dmsg.Sequence)
+			case state.key != nil && !bytes.Equal(dmsg.Previous.Hash, state.key.Hash):
+				skip()
+				return problem("feed %s:%d: previous %s doesn't match %s", dmsg.Author.Ref(), dmsg.Sequence, dmsg.Previous.Ref(), state.key.Ref())
+			}
+			state.seq = dmsg.Sequence
+			state.key = ref
+			state.rootSeqs = append(state.rootSeqs, rxSeq)
+
+			msgSeqs[string(ref.Hash)] = rxSeq
+
+			for _, l := range multilogs.TangleLinks(tv.Raw) {
+				addr := string(multilogs.TangleAddr(l.Name, l.Root))
+				tangles[addr] = append(tangles[addr], rxSeq)
+			}
+
+			rep.Messages++
+			return nil
+
+		default:
+			return problem("unexpected entry type %T", tv)
+		}
+	})
+
+	if err := luigi.Pump(ctx, snk, src); err != nil {
+		return nil, errors.Wrap(err, "fsck: failed to walk root log")
+	}
+
+	// user feeds
+	expectedFeeds := make(map[string][]int64, len(feeds))
+	for author, state := range feeds {
+		expectedFeeds[author] = state.rootSeqs
+	}
+	ps, err := checkOpenedMultiLog(r, multilogs.OpenUserFeeds, multilogs.IndexNameFeeds, expectedFeeds)
+	if err != nil {
+		return nil, err
+	}
+	rep.Problems = append(rep.Problems, ps...)
+
+	// tangles
+	ps, err = checkOpenedMultiLog(r, multilogs.OpenTangles, multilogs.IndexNameTangles, tangles)
+	if err != nil {
+		return nil, err
+	}
+	rep.Problems = append(rep.Problems, ps...)
+
+	// get
+	ps, err = checkGet(r, msgSeqs)
+	if err != nil {
+		return nil, err
+	}
+	rep.Problems = append(rep.Problems, ps...)
+
+	return &rep, nil
+}
+
+// checkGet looks up each message in the get index and reports the ones that are missing or point to the wrong entry.
+// The index is closed again before it returns, so that FSCKRepair can drop it.
+func checkGet(r repo.Interface, msgSeqs map[string]int64) (problems []FSCKProblem, err error) {
+	getIdx, db, err := indexes.OpenGetDB(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "fsck: failed to open get index")
+	}
+	defer func() {
+		if cerr := db.Close(); err == nil && cerr != nil {
+			err = errors.Wrap(cerr, "fsck: failed to close get index")
+		}
+	}()
+
+	ctx := context.TODO()
+	for hash, rxSeq := range msgSeqs {
+		obs, err := getIdx.Get(ctx, librarian.Addr(hash))
+		if err != nil {
+			return nil, errors.Wrap(err, "fsck: get index lookup failed")
+		}
+		v, err := obs.Value()
+		if err != nil {
+			return nil, errors.Wrap(err, "fsck: get index lookup failed")
+		}
+
+		ref := ssb.MessageRef{Hash: []byte(hash), Algo: ssb.RefAlgoSHA256}
+		switch tv := v.(type) {
+		case librarian.UnsetValue:
+			problems = append(problems, FSCKProblem{Seq: rxSeq, Index: indexes.FolderNameGet, Reason: fmt.Sprintf("%s not indexed", ref.Ref())})
+		case margaret.Seq:
+			if tv.Seq() != rxSeq {
+				problems = append(problems, FSCKProblem{Seq: rxSeq, Index: indexes.FolderNameGet, Reason: fmt.Sprintf("%s points to %d", ref.Ref(), tv.Seq())})
+			}
+		default:
+			problems = append(problems, FSCKProblem{Seq: rxSeq, Index: indexes.FolderNameGet, Reason: fmt.Sprintf("unexpected value type %T", v)})
+		}
+	}
+	return problems, nil
+}
+
+// checkOpenedMultiLog opens a multilog with open, compares it using checkMultiLog and closes it again (which closes it's database, like openMultiLog),
+// so that FSCKRepair can drop it afterwards.
+func checkOpenedMultiLog(r repo.Interface, open func(repo.Interface) (multilog.MultiLog, *badger.DB, repo.ServeFunc, error), name string, expected map[string][]int64) (problems []FSCKProblem, err error) {
+	mlog, _, _, err := open(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fsck: failed to open %s", name)
+	}
+	defer func() {
+		if cerr := mlog.Close(); err == nil && cerr != nil {
+			err = errors.Wrapf(cerr, "fsck: failed to close %s", name)
+		}
+	}()
+	return checkMultiLog(mlog, name, expected)
+}
+
+// checkMultiLog compares each sublog of mlog with the expected root log sequences and reports the first mismatch of each
+func checkMultiLog(mlog multilog.MultiLog, name string, expected map[string][]int64) ([]FSCKProblem, error) {
+	var problems []FSCKProblem
+
+	addrs, err := mlog.List()
+	if err != nil {
+		return nil, errors.Wrapf(err, "fsck: failed to list %s", name)
+	}
+	for _, addr := range addrs {
+		if _, has := expected[string(addr)]; !has {
+			problems = append(problems, FSCKProblem{Seq: -1, Index: name, Reason: fmt.Sprintf("sublog %x has no valid messages in the log", []byte(addr))})
+		}
+	}
+
+	for addr, want := range expected {
+		sublog, err := mlog.Get(librarian.Addr(addr))
+		if err != nil {
+			return nil, errors.Wrapf(err, "fsck: failed to open sublog of %s", name)
+		}
+
+		src, err := sublog.Query()
+		if err != nil {
+			return nil, errors.Wrapf(err, "fsck: failed to query sublog of %s", name)
+		}
+
+		var (
+			i        int
+			mismatch bool
+		)
+		for {
+			v, err := src.Next(context.TODO())
+			if luigi.IsEOS(err) {
+				break
+			} else if err != nil {
+				return nil, errors.Wrapf(err, "fsck: failed to read sublog of %s", name)
+			}
+
+			seq, ok := v.(margaret.Seq)
+			if !ok {
+				problems = append(problems, FSCKProblem{Seq: -1, Index: name, Reason: fmt.Sprintf("sublog %x: unexpected entry type %T", []byte(addr), v)})
+				mismatch = true
+				break
+			}
+			if i >= len(want) {
+				problems = append(problems, FSCKProblem{Seq: seq.Seq(), Index: name, Reason: fmt.Sprintf("sublog %x: unexpected entry %d", []byte(addr), i)})
+				mismatch = true
+				break
+			}
+			if seq.Seq() != want[i] {
+				problems = append(problems, FSCKProblem{Seq: want[i], Index: name, Reason: fmt.Sprintf("sublog %x: entry %d points to %d", []byte(addr), i, seq.Seq())})
+				mismatch = true
+				break
+			}
+			i++
+		}
+		if !mismatch && i < len(want) {
+			problems = append(problems, FSCKProblem{Seq: want[i], Index: name, Reason: fmt.Sprintf("sublog %x: %d entries missing", []byte(addr), len(want)-i)})
+		}
+	}
+	return problems, nil
+}
+
+// FSCKRepair nulls the invalid entries found by FSCK and rebuilds the indexes that don't match the log.
+// If entries are nulled, all indexes are rebuilt since they might contain data from them.
+func FSCKRepair(r repo.Interface, path string, rep *FSCKReport) error {
+	invalid := rep.InvalidEntries()
+	broken := rep.BrokenIndexes()
+	if len(invalid) == 0 && len(broken) == 0 {
+		return nil
+	}
+
+	lck, err := repo.Lock(r)
+	if err != nil {
+		return errors.Wrap(err, "fsck/repair")
+	}
+	defer lck.Close()
+
+	if len(invalid) > 0 {
+		rootLog, err := repo.OpenLog(r)
+		if err != nil {
+			return errors.Wrap(err, "fsck/repair: root-log open failed")
+		}
+
+		alterLog, ok := rootLog.(margaret.Alterer)
+		if !ok {
+			return errors.Errorf("fsck/repair: not an alterer: %T", rootLog)
+		}
+
+		for _, seq := range invalid {
+			if err := alterLog.Null(seq); err != nil {
+				return errors.Wrapf(err, "fsck/repair: failed to null entry %d", seq.Seq())
+			}
+		}
+		log.Printf("fsck/repair: nulled %d invalid entries", len(invalid))
+
+		if c, ok := rootLog.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return errors.Wrap(err, "fsck/repair: failed to close root log")
+			}
+		}
+
+		if err := DropIndicies(r); err != nil {
+			return errors.Wrap(err, "fsck/repair: failed to drop indexes")
+		}
+	} else {
+		for _, name := range broken {
+			dir, ok := indexFolders[name]
+			if !ok {
+				return errors.Errorf("fsck/repair: unknown index %q", name)
+			}
+			if err := os.RemoveAll(r.GetPath(dir...)); err != nil {
+				return errors.Wrapf(err, "fsck/repair: failed to drop %s", name)
+			}
+			log.Printf("fsck/repair: dropped %s", name)
+		}
+	}
+
+	return RebuildIndicies(path)
+}
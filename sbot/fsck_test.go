@@ -0,0 +1,74 @@
+package sbot
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestFSCKBrokenEntry(t *testing.T) {
+	r := require.New(t)
+
+	dir := filepath.Join("testrun", t.Name())
+	os.RemoveAll(dir)
+	rp := repo.New(dir)
+
+	kp, err := ssb.NewKeyPair(bytes.NewReader(bytes.Repeat([]byte{7}, 64)))
+	r.NoError(err)
+
+	rootLog, err := repo.OpenLog(rp)
+	r.NoError(err)
+
+	var prev *ssb.MessageRef
+	for i := 1; i <= 5; i++ {
+		msg := message.LegacyMessage{
+			Previous:  prev,
+			Author:    kp.Id.Ref(),
+			Sequence:  margaret.BaseSeq(i),
+			Timestamp: int64(i),
+			Hash:      "sha256",
+			Content:   map[string]interface{}{"type": "test", "i": i},
+		}
+		key, raw, err := msg.Sign(kp.Pair.Secret[:], nil)
+		r.NoError(err)
+		if i == 3 {
+			// bit rot, the stored key is still the one of the signed message
+			raw = bytes.Replace(raw, []byte(`"i": 3`), []byte(`"i": 4`), 1)
+		}
+		_, err = rootLog.Append(message.StoredMessage{
+			Author:    kp.Id,
+			Previous:  prev,
+			Key:       key,
+			Sequence:  margaret.BaseSeq(i),
+			Timestamp: time.Now(),
+			Raw:       raw,
+		})
+		r.NoError(err)
+		prev = key
+	}
+	if c, ok := rootLog.(io.Closer); ok {
+		r.NoError(c.Close())
+	}
+
+	rep, err := FSCK(rp, nil)
+	r.NoError(err)
+	r.Equal(4, rep.Messages)
+	r.Equal([]margaret.Seq{margaret.BaseSeq(2)}, rep.InvalidEntries(), "only the broken entry, not the rest of the feed")
+
+	// everything FSCK opened is closed again, the repair can drop and rebuild the indexes
+	r.NoError(FSCKRepair(rp, dir, rep))
+	rep, err = FSCK(rp, nil)
+	r.NoError(err)
+	r.Equal(4, rep.Messages)
+	r.Empty(rep.InvalidEntries())
+}
@@ -5,10 +5,13 @@ import (
 	"go.cryptoscope.co/librarian"
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
 	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
 )
 
-func (s Sbot) Get(ref ssb.MessageRef) (*message.StoredMessage, error) {
+// Get returns the message with the key ref. The error is ssb.ErrNotFound if it isn't stored.
+func (s *Sbot) Get(ref ssb.MessageRef) (*message.StoredMessage, error) {
 	obs, err := s.idxGet.Get(s.rootCtx, librarian.Addr(ref.Hash))
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot/get: failed to get seq val from index")
@@ -19,11 +22,69 @@ func (s Sbot) Get(ref ssb.MessageRef) (*message.StoredMessage, error) {
 		return nil, errors.Wrap(err, "sbot/get: failed to get current value from obs")
 	}
 
+	if _, unset := v.(librarian.UnsetValue); unset {
+		return nil, errors.Wrapf(ssb.ErrNotFound, "sbot/get: %s", ref.Ref())
+	}
+
 	seq, ok := v.(margaret.Seq)
 	if !ok {
 		return nil, errors.Errorf("sbot/get: wrong sequence type in index: %T", v)
 	}
 
+	return s.getRootSeq(seq)
+}
+
+// GetByAuthorSeq returns message number seq (starting with 1) of the feed author.
+// The error is ssb.ErrNotFound if we don't have it.
+func (s *Sbot) GetByAuthorSeq(author ssb.FeedRef, seq int64) (*message.StoredMessage, error) {
+	if seq < 1 {
+		return nil, errors.Errorf("sbot/get: invalid sequence %d", seq)
+	}
+
+	userLog, err := s.UserFeeds.Get(librarian.Addr(author.ID))
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/get: failed to open sublog of author")
+	}
+
+	v, err := userLog.Seq().Value()
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/get: failed to get length of sublog")
+	}
+	latest, ok := v.(margaret.Seq) // unset for feeds we have no messages of
+	if !ok || seq-1 > latest.Seq() {
+		return nil, errors.Wrapf(ssb.ErrNotFound, "sbot/get: %s:%d", author.Ref(), seq)
+	}
+
+	// sublogs are 0-indexed
+	rv, err := userLog.Get(margaret.BaseSeq(seq - 1))
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/get: failed to get root sequence from sublog")
+	}
+	rootSeq, ok := rv.(margaret.Seq)
+	if !ok {
+		return nil, errors.Errorf("sbot/get: wrong sequence type in sublog: %T", rv)
+	}
+
+	return s.getRootSeq(rootSeq)
+}
+
+// GetMany looks up all the refs. The returned slice has the same order, with nil for the messages that aren't stored.
+func (s *Sbot) GetMany(refs []ssb.MessageRef) ([]*message.StoredMessage, error) {
+	msgs := make([]*message.StoredMessage, len(refs))
+	for i, ref := range refs {
+		msg, err := s.Get(ref)
+		if err != nil {
+			if errors.Cause(err) == ssb.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+		msgs[i] = msg
+	}
+	return msgs, nil
+}
+
+func (s *Sbot) getRootSeq(seq margaret.Seq) (*message.StoredMessage, error) {
 	storedV, err := s.RootLog.Get(seq)
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot/get: failed to load message")
@@ -31,8 +92,46 @@ func (s Sbot) Get(ref ssb.MessageRef) (*message.StoredMessage, error) {
 
 	msg, ok := storedV.(message.StoredMessage)
 	if !ok {
+		if err, ok := storedV.(error); ok && margaret.IsErrNulled(err) {
+			return nil, errors.Wrapf(ssb.ErrNotFound, "sbot/get: message %d was dropped", seq.Seq())
+		}
 		return nil, errors.Errorf("sbot/get: wrong message type in storeage: %T", storedV)
 	}
 
 	return &msg, nil
 }
+
+// GetFilterStats returns how many lookups the bloom filter in front of the get index answered on it's own
+func (s *Sbot) GetFilterStats() indexes.GetFilterStats {
+	return s.getFilter.Stats()
+}
+
+// Provenance returns which peer sent us the message with the key ref and when.
+// The error is ssb.ErrNotFound if we don't have the message or didn't get it from another peer.
+func (s *Sbot) Provenance(ref ssb.MessageRef) (*indexes.Provenance, error) {
+	obs, err := s.idxProvenance.Get(s.rootCtx, librarian.Addr(ref.Hash))
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/provenance: failed to get value from index")
+	}
+
+	v, err := obs.Value()
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot/provenance: failed to get current value from obs")
+	}
+
+	switch tv := v.(type) {
+	case librarian.UnsetValue:
+		return nil, errors.Wrapf(ssb.ErrNotFound, "sbot/provenance: %s", ref.Ref())
+	case indexes.Provenance:
+		return &tv, nil
+	case *indexes.Provenance:
+		return tv, nil
+	default:
+		return nil, errors.Errorf("sbot/provenance: wrong type in index: %T", v)
+	}
+}
+
+// TangleTips returns the messages that a new message in the named tangle of root lists as previous
+func (s *Sbot) TangleTips(name string, root ssb.MessageRef) ([]*ssb.MessageRef, error) {
+	return multilogs.TangleTips(s.RootLog, s.Tangles, name, &root)
+}
@@ -0,0 +1,438 @@
+package sbot
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cryptix/go/logging"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/internal/ctxutils"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// indexOpener opens an index from the passed repo
+type indexOpener func(r repo.Interface) (*openedIndex, error)
+
+// openedIndex is what an indexOpener returns
+type openedIndex struct {
+	value  interface{}    // handed to the users of the index
+	db     *badger.DB     // the database of the index, used for backups
+	closer io.Closer      // might be nil
+	serve  repo.ServeFunc // updates the index from the root log
+}
+
+// swapper is implemented by the wrappers that are handed out for indexes which can be rebuilt while the bot is running.
+// The lock is held while the old index is closed and the rebuilt one is opened in it's place.
+type swapper interface {
+	sync.Locker
+	swap(interface{})
+}
+
+// indexHandle keeps track of a served index so that it can be stopped and switched over at runtime
+type indexHandle struct {
+	name string
+	dir  []string // relative to the repo, holds all the files of the index
+
+	open    indexOpener
+	wrapper swapper // nil if the index can't be swapped at runtime
+
+	db     *badger.DB
+	closer io.Closer
+	serve  repo.ServeFunc
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// busy is set while the index is rebuilt or backed up
+	busy bool
+}
+
+// indexFolders holds the folder of each index, relative to the repo
+var indexFolders = map[string][]string{
+	indexes.FolderNameGet:           {repo.PrefixIndex, indexes.FolderNameGet},
+	indexes.FolderNameContacts:      {repo.PrefixIndex, indexes.FolderNameContacts},
+	indexes.FolderNameAbout:         {repo.PrefixIndex, indexes.FolderNameAbout},
+	indexes.FolderNameProvenance:    {repo.PrefixIndex, indexes.FolderNameProvenance},
+	indexes.FolderNameTimestamps:    {repo.PrefixIndex, indexes.FolderNameTimestamps},
+	indexes.FolderNameLinks:         {repo.PrefixIndex, indexes.FolderNameLinks},
+	indexes.FolderNameSearch:        {repo.PrefixIndex, indexes.FolderNameSearch},
+	indexes.FolderNameNames:         {repo.PrefixIndex, indexes.FolderNameNames},
+	indexes.FolderNameVotes:         {repo.PrefixIndex, indexes.FolderNameVotes},
+	indexes.FolderNameSubscriptions: {repo.PrefixIndex, indexes.FolderNameSubscriptions},
+	indexes.FolderNameNotifications: {repo.PrefixIndex, indexes.FolderNameNotifications},
+	multilogs.IndexNameFeeds:        {repo.PrefixMultiLog, multilogs.IndexNameFeeds},
+	multilogs.IndexNameTypes:        {repo.PrefixMultiLog, multilogs.IndexNameTypes},
+	multilogs.IndexNameTangles:      {repo.PrefixMultiLog, multilogs.IndexNameTangles},
+	multilogs.IndexNameChannels:     {repo.PrefixMultiLog, multilogs.IndexNameChannels},
+	multilogs.IndexNamePrivates:     {repo.PrefixMultiLog, multilogs.IndexNamePrivates},
+}
+
+// indexVersions need to be increased when the encoding of an index changes.
+// Indexes with a different version in the repo manifest are dropped and rebuilt.
+var indexVersions = map[string]int{
+	indexes.FolderNameGet:           1,
+	indexes.FolderNameContacts:      1,
+	indexes.FolderNameAbout:         2,
+	indexes.FolderNameProvenance:    1,
+	indexes.FolderNameTimestamps:    1,
+	indexes.FolderNameLinks:         1,
+	indexes.FolderNameSearch:        1,
+	indexes.FolderNameNames:         1,
+	indexes.FolderNameVotes:         1,
+	indexes.FolderNameSubscriptions: 1,
+	indexes.FolderNameNotifications: 1,
+	multilogs.IndexNameFeeds:        1,
+	multilogs.IndexNameTypes:        1,
+	multilogs.IndexNameTangles:      2,
+	multilogs.IndexNameChannels:     1,
+	multilogs.IndexNamePrivates:     1,
+}
+
+// addIndex opens the index using open, registers it under name and starts serving it
+func (s *Sbot) addIndex(name string, open indexOpener, sw swapper) (interface{}, error) {
+	dir, ok := indexFolders[name]
+	if !ok {
+		return nil, errors.Errorf("sbot: no folder for index %q", name)
+	}
+	if err := s.checkIndexVersion(name, dir); err != nil {
+		return nil, err
+	}
+
+	oi, err := open(s.repo)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &indexHandle{
+		name:    name,
+		dir:     dir,
+		open:    open,
+		wrapper: sw,
+	}
+	h.use(oi)
+	if sw != nil {
+		sw.swap(oi.value)
+	}
+
+	s.indexLock.Lock()
+	s.indexes[name] = h
+	s.indexLock.Unlock()
+
+	s.serveIndex(h)
+	return oi.value, nil
+}
+
+// use switches the handle over to the opened index
+func (h *indexHandle) use(oi *openedIndex) {
+	h.db = oi.db
+	h.closer = oi.closer
+	h.serve = oi.serve
+}
+
+// checkIndexVersion drops the index if the manifest lists a different version for it
+func (s *Sbot) checkIndexVersion(name string, dir []string) error {
+	want, ok := indexVersions[name]
+	if !ok {
+		return errors.Errorf("sbot: no version for index %q", name)
+	}
+
+	has, ok := s.manifest.Indexes[name]
+	if ok && has != want {
+		s.info.Log("event", "dropping outdated index", "idx", name, "has", has, "want", want)
+		if err := os.RemoveAll(s.repo.GetPath(dir...)); err != nil {
+			return errors.Wrapf(err, "sbot: failed to drop outdated index %s", name)
+		}
+	}
+	s.manifest.Indexes[name] = want
+	return nil
+}
+
+// serveIndex starts serving the index in the background and stops it once the bot shuts down
+func (s *Sbot) serveIndex(h *indexHandle) {
+	ctx, cancel := ctxutils.WithError(s.serveCtx, ssb.ErrShuttingDown)
+	h.cancel = cancel
+	h.done = make(chan struct{})
+
+	s.idxDone.Add(1)
+	go func(wg *sync.WaitGroup, done chan struct{}) {
+		defer close(done)
+		err := h.serve(ctx, s.RootLog, s.liveIndexUpdates)
+		s.info.Log("event", "idx server exited", "idx", h.name, "error", err)
+		if err != nil {
+			err := s.Close()
+			logging.CheckFatal(err)
+			os.Exit(1)
+			return
+		}
+		wg.Done()
+	}(&s.idxDone, h.done)
+}
+
+// pause halts the serving of the index. Indexes that close themselves once serving stops can't be resumed.
+func (h *indexHandle) pause() {
+	h.cancel()
+	<-h.done
+}
+
+// stop halts the serving of the index and closes it
+func (h *indexHandle) stop() error {
+	h.pause()
+	if h.closer == nil {
+		return nil
+	}
+	return h.closer.Close()
+}
+
+type swapMultiLog struct {
+	sync.RWMutex
+	cur multilog.MultiLog
+}
+
+var _ multilog.MultiLog = (*swapMultiLog)(nil)
+
+func (sml *swapMultiLog) swap(v interface{}) { sml.cur = v.(multilog.MultiLog) }
+
+func (sml *swapMultiLog) Get(addr librarian.Addr) (margaret.Log, error) {
+	sml.RLock()
+	defer sml.RUnlock()
+	return sml.cur.Get(addr)
+}
+
+func (sml *swapMultiLog) List() ([]librarian.Addr, error) {
+	sml.RLock()
+	defer sml.RUnlock()
+	return sml.cur.List()
+}
+
+func (sml *swapMultiLog) Close() error {
+	sml.RLock()
+	defer sml.RUnlock()
+	return sml.cur.Close()
+}
+
+type swapIndex struct {
+	sync.RWMutex
+	cur librarian.Index
+}
+
+var _ librarian.Index = (*swapIndex)(nil)
+
+func (si *swapIndex) swap(v interface{}) { si.cur = v.(librarian.Index) }
+
+func (si *swapIndex) Get(ctx context.Context, addr librarian.Addr) (luigi.Observable, error) {
+	si.RLock()
+	defer si.RUnlock()
+	return si.cur.Get(ctx, addr)
+}
+
+func (si *swapIndex) Set(ctx context.Context, addr librarian.Addr, v interface{}) error {
+	si.RLock()
+	defer si.RUnlock()
+	return si.cur.Set(ctx, addr, v)
+}
+
+func (si *swapIndex) Delete(ctx context.Context, addr librarian.Addr) error {
+	si.RLock()
+	defer si.RUnlock()
+	return si.cur.Delete(ctx, addr)
+}
+
+type swapTimestamps struct {
+	sync.RWMutex
+	cur indexes.TimestampIndex
+}
+
+var _ indexes.TimestampIndex = (*swapTimestamps)(nil)
+
+func (st *swapTimestamps) swap(v interface{}) { st.cur = v.(indexes.TimestampIndex) }
+
+func (st *swapTimestamps) Entries(qry indexes.TimestampQuery, from *indexes.TimestampEntry) ([]indexes.TimestampEntry, error) {
+	st.RLock()
+	defer st.RUnlock()
+	return st.cur.Entries(qry, from)
+}
+
+func (st *swapTimestamps) Seq() (int64, error) {
+	st.RLock()
+	defer st.RUnlock()
+	return st.cur.Seq()
+}
+
+type swapLinks struct {
+	sync.RWMutex
+	cur indexes.LinkIndex
+}
+
+var _ indexes.LinkIndex = (*swapLinks)(nil)
+
+func (sl *swapLinks) swap(v interface{}) { sl.cur = v.(indexes.LinkIndex) }
+
+func (sl *swapLinks) Links(qry indexes.LinkQuery, fn func(indexes.Link) error) error {
+	sl.RLock()
+	defer sl.RUnlock()
+	return sl.cur.Links(qry, fn)
+}
+
+type swapSearch struct {
+	sync.RWMutex
+	cur indexes.SearchIndex
+}
+
+var _ indexes.SearchIndex = (*swapSearch)(nil)
+
+func (ss *swapSearch) swap(v interface{}) { ss.cur = v.(indexes.SearchIndex) }
+
+func (ss *swapSearch) Search(terms []string) ([]indexes.SearchResult, error) {
+	ss.RLock()
+	defer ss.RUnlock()
+	return ss.cur.Search(terms)
+}
+
+type swapNames struct {
+	sync.RWMutex
+	cur indexes.NameIndex
+}
+
+var _ indexes.NameIndex = (*swapNames)(nil)
+
+func (sn *swapNames) swap(v interface{}) { sn.cur = v.(indexes.NameIndex) }
+
+func (sn *swapNames) Names(prefix string, fn func(indexes.NameEntry) error) error {
+	sn.RLock()
+	defer sn.RUnlock()
+	return sn.cur.Names(prefix, fn)
+}
+
+type swapVotes struct {
+	sync.RWMutex
+	cur indexes.VoteIndex
+}
+
+var _ indexes.VoteIndex = (*swapVotes)(nil)
+
+func (sv *swapVotes) swap(v interface{}) { sv.cur = v.(indexes.VoteIndex) }
+
+func (sv *swapVotes) Votes(target *ssb.MessageRef) ([]indexes.Vote, error) {
+	sv.RLock()
+	defer sv.RUnlock()
+	return sv.cur.Votes(target)
+}
+
+type swapSubscriptions struct {
+	sync.RWMutex
+	cur indexes.SubscriptionIndex
+}
+
+var _ indexes.SubscriptionIndex = (*swapSubscriptions)(nil)
+
+func (ss *swapSubscriptions) swap(v interface{}) { ss.cur = v.(indexes.SubscriptionIndex) }
+
+func (ss *swapSubscriptions) Subscriptions(feed *ssb.FeedRef) ([]string, error) {
+	ss.RLock()
+	defer ss.RUnlock()
+	return ss.cur.Subscriptions(feed)
+}
+
+func (ss *swapSubscriptions) Subscribers(channel string) ([]*ssb.FeedRef, error) {
+	ss.RLock()
+	defer ss.RUnlock()
+	return ss.cur.Subscribers(channel)
+}
+
+// swapNotifications keeps it's own broadcast, so that the streams that registered on it
+// get the changes of the rebuilt index as well.
+type swapNotifications struct {
+	sync.RWMutex
+	cur    indexes.NotificationIndex
+	sink   luigi.Sink
+	bcast  luigi.Broadcast
+	cancel func()
+}
+
+var _ indexes.NotificationIndex = (*swapNotifications)(nil)
+
+func (sn *swapNotifications) swap(v interface{}) {
+	if sn.bcast == nil {
+		sn.sink, sn.bcast = luigi.NewBroadcast()
+	}
+	if sn.cancel != nil {
+		sn.cancel()
+	}
+	sn.cur = v.(indexes.NotificationIndex)
+	sn.cancel = sn.cur.Changes().Register(luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return nil // the index is closed, the next one takes over
+		}
+		return sn.sink.Pour(ctx, v)
+	}))
+}
+
+func (sn *swapNotifications) Notifications(after int64, fn func(indexes.Notification) error) error {
+	sn.RLock()
+	defer sn.RUnlock()
+	return sn.cur.Notifications(after, fn)
+}
+
+func (sn *swapNotifications) Changes() luigi.Broadcast {
+	sn.RLock()
+	defer sn.RUnlock()
+	return sn.bcast
+}
+
+// closeIndexes closes all the registered indexes. Serving needs to be stopped already.
+func (s *Sbot) closeIndexes() error {
+	s.indexLock.Lock()
+	defer s.indexLock.Unlock()
+
+	var mc multiCloser
+	for _, h := range s.indexes {
+		if h.closer != nil {
+			mc.addCloser(h.closer)
+		}
+	}
+	return mc.Close()
+}
+
+func openGet(r repo.Interface) (*openedIndex, error) {
+	// the get index closes it's database once serving stops
+	idx, db, serve, err := indexes.OpenGet(r)
+	if err != nil {
+		return nil, err
+	}
+	return &openedIndex{value: idx, db: db, serve: serve}, nil
+}
+
+// openIndex is the indexOpener for the indexes that return their database, which is closed with the index
+func openIndex(open func(repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error)) indexOpener {
+	return func(r repo.Interface) (*openedIndex, error) {
+		idx, db, serve, err := open(r)
+		if err != nil {
+			return nil, err
+		}
+		oi := &openedIndex{value: idx, db: db, serve: serve}
+		if db != nil {
+			oi.closer = db
+		}
+		return oi, nil
+	}
+}
+
+func openMultiLog(open func(repo.Interface) (multilog.MultiLog, *badger.DB, repo.ServeFunc, error)) indexOpener {
+	return func(r repo.Interface) (*openedIndex, error) {
+		mlog, db, serve, err := open(r)
+		if err != nil {
+			return nil, err
+		}
+		return &openedIndex{value: mlog, db: db, closer: mlog, serve: serve}, nil
+	}
+}
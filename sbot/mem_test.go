@@ -0,0 +1,149 @@
+package sbot
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/cryptix/go/logging/logtest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestInMemory(t *testing.T) {
+	r := require.New(t)
+
+	mainLog, _ := logtest.KitLogger(t.Name(), t)
+	bot, err := New(
+		WithInfo(mainLog),
+		WithRepo(repo.NewMemory()),
+		DisableNetworkNode())
+	r.NoError(err)
+
+	const n = 10
+	for i := 0; i < n; i++ {
+		_, err := bot.PublishLog.Append(map[string]interface{}{
+			"type": "test",
+			"i":    i,
+		})
+		r.NoError(err)
+	}
+	_, err = bot.PublishLog.Append(map[string]interface{}{
+		"type":  "about",
+		"about": bot.KeyPair.Id.Ref(),
+		"name":  "memory",
+	})
+	r.NoError(err)
+
+	// give the indexes a moment to catch up
+	time.Sleep(time.Second / 2)
+
+	testLog, err := bot.MessageTypes.Get(librarian.Addr("test"))
+	r.NoError(err)
+	seqv, err := testLog.Seq().Value()
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(n-1), seqv)
+
+	lastV, err := bot.RootLog.Get(margaret.BaseSeq(n))
+	r.NoError(err)
+	last := lastV.(message.StoredMessage)
+	msg, err := bot.Get(*last.Key)
+	r.NoError(err)
+	r.Equal(last.Key.Ref(), msg.Key.Ref())
+
+	ai, err := bot.AboutStore.GetName(bot.KeyPair.Id)
+	r.NoError(err)
+	r.Equal("memory", ai.Name.Chosen)
+
+	ref, err := bot.BlobStore.Put(bytes.NewReader([]byte("blob")))
+	r.NoError(err)
+	rd, err := bot.BlobStore.Get(ref)
+	r.NoError(err)
+	b, err := ioutil.ReadAll(rd)
+	r.NoError(err)
+	r.Equal("blob", string(b))
+
+	r.Error(bot.Reindex("msgTypes", nil), "not supported in memory")
+
+	unknown := ssb.FeedRef{Algo: "ed25519", ID: make([]byte, 32)}
+	_, err = bot.GetByAuthorSeq(unknown, 1)
+	r.Equal(ssb.ErrNotFound, errors.Cause(err))
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
+
+func TestInMemoryReplication(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	aliLog, _ := logtest.KitLogger("ali", t)
+	ali, err := New(
+		WithContext(ctx),
+		WithInfo(aliLog),
+		WithRepo(repo.NewMemory()),
+		WithListenAddr(":0"))
+	r.NoError(err)
+
+	bobLog, _ := logtest.KitLogger("bob", t)
+	bob, err := New(
+		WithContext(ctx),
+		WithInfo(bobLog),
+		WithRepo(repo.NewMemory()),
+		WithListenAddr(":0"))
+	r.NoError(err)
+
+	var aliErrc, bobErrc = make(chan error, 1), make(chan error, 1)
+	go func() {
+		aliErrc <- ali.Network.Serve(ctx)
+		close(aliErrc)
+	}()
+	go func() {
+		bobErrc <- bob.Network.Serve(ctx)
+		close(bobErrc)
+	}()
+
+	_, err = ali.PublishLog.Append(ssb.Contact{Type: "contact", Following: true, Contact: bob.KeyPair.Id})
+	r.NoError(err)
+	_, err = bob.PublishLog.Append(ssb.Contact{Type: "contact", Following: true, Contact: ali.KeyPair.Id})
+	r.NoError(err)
+	_, err = ali.PublishLog.Append(map[string]interface{}{"type": "test", "text": "replicated"})
+	r.NoError(err)
+
+	r.NoError(bob.Network.Connect(ctx, ali.Network.GetListenAddr()))
+	// give the indexes a moment to catch up
+	time.Sleep(time.Second)
+
+	// the indexes of bob handled the messages of ali
+	msg, err := bob.GetByAuthorSeq(*ali.KeyPair.Id, 2)
+	r.NoError(err)
+	got, err := bob.Get(*msg.Key)
+	r.NoError(err)
+	r.Equal(msg.Key.Ref(), got.Key.Ref())
+
+	testLog, err := bob.MessageTypes.Get(librarian.Addr("test"))
+	r.NoError(err)
+	seqv, err := testLog.Seq().Value()
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(0), seqv)
+
+	ali.Shutdown()
+	bob.Shutdown()
+	r.NoError(ali.Close())
+	r.NoError(bob.Close())
+	cancel()
+	for err := range mergeErrorChans(aliErrc, bobErrc) {
+		if err != nil && errors.Cause(err) != context.Canceled {
+			t.Log("serve exited:", err)
+		}
+	}
+}
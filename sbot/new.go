@@ -6,33 +6,46 @@ import (
 	"io"
 	"net"
 	"os"
-	"sync"
 	"time"
 
 	"go.cryptoscope.co/netwrap"
 	"go.cryptoscope.co/secretstream"
 
-	"github.com/cryptix/go/logging"
+	"github.com/dgraph-io/badger"
 	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
 	"github.com/pkg/errors"
 	"go.cryptoscope.co/librarian"
 	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
 	"go.cryptoscope.co/muxrpc"
 
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/blobstore"
+	"go.cryptoscope.co/ssb/graph"
 	"go.cryptoscope.co/ssb/indexes"
 	"go.cryptoscope.co/ssb/internal/ctxutils"
+	"go.cryptoscope.co/ssb/internal/mutil"
 	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/names"
 	"go.cryptoscope.co/ssb/network"
+	aboutplug "go.cryptoscope.co/ssb/plugins/about"
+	archiveplug "go.cryptoscope.co/ssb/plugins/archive"
 	"go.cryptoscope.co/ssb/plugins/blobs"
 	"go.cryptoscope.co/ssb/plugins/control"
 	"go.cryptoscope.co/ssb/plugins/get"
 	"go.cryptoscope.co/ssb/plugins/gossip"
+	"go.cryptoscope.co/ssb/plugins/links"
+	namesplug "go.cryptoscope.co/ssb/plugins/names"
+	"go.cryptoscope.co/ssb/plugins/notifications"
 	privplug "go.cryptoscope.co/ssb/plugins/private"
 	"go.cryptoscope.co/ssb/plugins/publish"
+	queryplug "go.cryptoscope.co/ssb/plugins/query"
 	"go.cryptoscope.co/ssb/plugins/rawread"
 	"go.cryptoscope.co/ssb/plugins/replicate"
+	"go.cryptoscope.co/ssb/plugins/search"
+	threadsplug "go.cryptoscope.co/ssb/plugins/threads"
+	"go.cryptoscope.co/ssb/plugins/votes"
 	"go.cryptoscope.co/ssb/plugins/whoami"
 	"go.cryptoscope.co/ssb/private"
 	"go.cryptoscope.co/ssb/repo"
@@ -55,34 +68,66 @@ func (s *Sbot) Close() error {
 	// TODO: timeout?
 	s.info.Log("event", "closing", "msg", "waited")
 
+	if err := s.closeIndexes(); err != nil {
+		return err
+	}
+
 	if err := s.closers.Close(); err != nil {
 		return err
 	}
 	s.info.Log("event", "closing", "msg", "closers closed")
+
+	if s.repoLock != nil {
+		return s.repoLock.Close()
+	}
 	return nil
 }
 
-func initSbot(s *Sbot) (*Sbot, error) {
+func initSbot(s *Sbot) (_ *Sbot, err error) {
 	log := s.info
 	var ctx context.Context
 	ctx, s.Shutdown = ctxutils.WithError(s.rootCtx, ssb.ErrShuttingDown)
+	s.serveCtx = ctx
 
-	goThenLog := func(ctx context.Context, l margaret.Log, name string, f repo.ServeFunc) {
-		s.idxDone.Add(1)
-		go func(wg *sync.WaitGroup) {
-			err := f(ctx, l, s.liveIndexUpdates)
-			log.Log("event", "idx server exited", "idx", name, "error", err)
-			if err != nil {
-				err := s.Close()
-				logging.CheckFatal(err)
-				os.Exit(1)
-				return
-			}
-			wg.Done()
-		}(&s.idxDone)
+	r := s.repo
+	if r == nil {
+		r = repo.New(s.repoPath)
+		s.repo = r
+	}
+
+	lck, err := repo.Lock(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to lock repo")
+	}
+	s.repoLock = lck
+	defer func() {
+		if err == nil {
+			return
+		}
+		// stop what was started so far and let go of the repo, so that opening it can be retried
+		s.Shutdown()
+		if cerr := s.Close(); cerr != nil {
+			log.Log("event", "closing after failed start", "err", cerr)
+		}
+		// Close stops at the first error, releasing twice is fine
+		lck.Close()
+	}()
+
+	m, runs, err := repo.Migrate(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to migrate repo")
+	}
+	for _, run := range runs {
+		s.info.Log("event", "repo migrated", "migration", run.Name, "version", run.Version, "backup", run.Backup, "took", run.Took)
+	}
+	s.manifest = m
+
+	if m.CompactPending && !repo.IsMemory(r) {
+		if err := s.compactPending(); err != nil {
+			return nil, errors.Wrap(err, "sbot: failed to compact evicted feeds")
+		}
 	}
 
-	r := repo.New(s.repoPath)
 	rootLog, err := repo.OpenLog(r)
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot: failed to open rootlog")
@@ -90,54 +135,85 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	s.closers.addCloser(rootLog.(io.Closer))
 	s.RootLog = rootLog
 
-	getIdx, serveGet, err := indexes.OpenGet(r)
+	getIdx := &swapIndex{}
+	_, err = s.addIndex(indexes.FolderNameGet, openGet, getIdx)
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot: failed to open get index")
 	}
-	goThenLog(ctx, rootLog, "get", serveGet)
-	s.idxGet = getIdx
 
-	uf, _, serveUF, err := multilogs.OpenUserFeeds(r)
+	var filterEvents metrics.Counter
+	if s.eventCounter != nil {
+		filterEvents = s.eventCounter
+	}
+	gf, serveFilter, err := indexes.OpenGetFilter(r, rootLog, filterEvents)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open get filter")
+	}
+	s.closers.addCloser(gf)
+	s.getFilter = gf
+	s.idxGet = gf.Wrap(getIdx, rootLog)
+	s.idxDone.Add(1)
+	go func() {
+		defer s.idxDone.Done()
+		// without the filter lookups just go to the index
+		if err := serveFilter(ctx, rootLog, s.liveIndexUpdates); err != nil {
+			log.Log("event", "get filter stopped", "err", err)
+		}
+	}()
+
+	uf := &swapMultiLog{}
+	s.publisher = &publisher{}
+	_, err = s.addIndex(multilogs.IndexNameFeeds, openMultiLog(multilogs.OpenUserFeeds), userFeedsSwapper{uf, s.publisher})
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot: failed to open user sublogs")
 	}
-	s.closers.addCloser(uf)
-	goThenLog(ctx, rootLog, "userFeeds", serveUF)
 	s.UserFeeds = uf
 
-	mt, _, serveMT, err := multilogs.OpenMessageTypes(r)
+	mt := &swapMultiLog{}
+	_, err = s.addIndex(multilogs.IndexNameTypes, openMultiLog(multilogs.OpenMessageTypes), mt)
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot: failed to open message type sublogs")
 	}
-	s.closers.addCloser(mt)
-	goThenLog(ctx, rootLog, "msgTypes", serveMT)
 	s.MessageTypes = mt
 
-	tangles, _, servetangles, err := multilogs.OpenTangles(r)
+	tangles := &swapMultiLog{}
+	_, err = s.addIndex(multilogs.IndexNameTangles, openMultiLog(multilogs.OpenTangles), tangles)
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot: failed to open message type sublogs")
 	}
-	s.closers.addCloser(tangles)
-	goThenLog(ctx, rootLog, "tangles", servetangles)
 	s.Tangles = tangles
 
-	/* new style graph builder
-	contactLog, err := mt.Get(librarian.Addr("contact"))
-	if err != nil {
-		return nil, errors.Wrap(err, "sbot: failed to open message contact sublog")
-	}
-	s.GraphBuilder, err = graph.NewLogBuilder(s.info, mutil.Indirect(s.RootLog, contactLog))
+	channels := &swapMultiLog{}
+	_, err = s.addIndex(multilogs.IndexNameChannels, openMultiLog(multilogs.OpenChannels), channels)
 	if err != nil {
-		return nil, errors.Wrap(err, "sbot: NewLogBuilder failed")
+		return nil, errors.Wrap(err, "sbot: failed to open channel sublogs")
 	}
-	*/
+	s.Channels = channels
 
-	gb, serveContacts, err := indexes.OpenContacts(kitlog.With(log, "module", "graph"), r)
-	if err != nil {
-		return nil, errors.Wrap(err, "sbot: OpenContacts failed")
+	if repo.IsMemory(r) {
+		// the contacts index needs badger, compute the graph from the contact messages instead
+		contactLog, err := s.MessageTypes.Get(librarian.Addr("contact"))
+		if err != nil {
+			return nil, errors.Wrap(err, "sbot: failed to open message contact sublog")
+		}
+		s.GraphBuilder, err = graph.NewLogBuilder(kitlog.With(log, "module", "graph"), mutil.Indirect(s.RootLog, contactLog))
+		if err != nil {
+			return nil, errors.Wrap(err, "sbot: NewLogBuilder failed")
+		}
+	} else {
+		gb, err := s.addIndex(indexes.FolderNameContacts, func(r repo.Interface) (*openedIndex, error) {
+			// closes it's database once serving stops
+			gb, db, serve, err := indexes.OpenContacts(kitlog.With(log, "module", "graph"), r)
+			if err != nil {
+				return nil, err
+			}
+			return &openedIndex{value: gb, db: db, serve: serve}, nil
+		}, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "sbot: OpenContacts failed")
+		}
+		s.GraphBuilder = gb.(graph.Builder)
 	}
-	goThenLog(ctx, rootLog, "contacts", serveContacts)
-	s.GraphBuilder = gb
 
 	bs, err := repo.OpenBlobStore(r)
 	if err != nil {
@@ -156,35 +232,131 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	id := s.KeyPair.Id
 	auth := s.GraphBuilder.Authorizer(id, int(s.hopCount))
 
-	if s.signHMACsecret != nil {
-		publishLog, err := multilogs.OpenPublishLogWithHMAC(s.RootLog, s.UserFeeds, *s.KeyPair, s.signHMACsecret)
-		if err != nil {
-			return nil, errors.Wrap(err, "sbot: failed to create publish log with hmac")
+	s.publisher.open = func(uf multilog.MultiLog) (margaret.Log, error) {
+		if s.signHMACsecret != nil {
+			return multilogs.OpenPublishLogWithHMAC(s.RootLog, uf, *s.KeyPair, s.signHMACsecret)
 		}
-		s.PublishLog = publishLog
-	} else {
-		publishLog, err := multilogs.OpenPublishLog(s.RootLog, s.UserFeeds, *s.KeyPair)
-		if err != nil {
-			return nil, errors.Wrap(err, "sbot: failed to create publish log")
-		}
-		s.PublishLog = publishLog
+		return multilogs.OpenPublishLog(s.RootLog, uf, *s.KeyPair)
 	}
+	s.publisher.cur, err = s.publisher.open(s.UserFeeds)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to create publish log")
+	}
+	s.PublishLog = s.publisher
 
-	pl, _, servePrivs, err := multilogs.OpenPrivateRead(kitlog.With(log, "module", "privLogs"), r, s.KeyPair)
+	privLogs, err := s.addIndex(multilogs.IndexNamePrivates, openMultiLog(func(r repo.Interface) (multilog.MultiLog, *badger.DB, repo.ServeFunc, error) {
+		return multilogs.OpenPrivateRead(kitlog.With(log, "module", "privLogs"), r, s.KeyPair)
+	}), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot: failed to create privte read idx")
 	}
-	s.closers.addCloser(pl)
-	goThenLog(ctx, rootLog, "privLogs", servePrivs)
+	pl := privLogs.(multilog.MultiLog)
 	s.PrivateLogs = pl
 
-	ab, serveAbouts, err := indexes.OpenAbout(kitlog.With(log, "index", "abouts"), r)
+	ab, err := s.addIndex(indexes.FolderNameAbout, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenAbout(kitlog.With(log, "index", "abouts"), r)
+	}), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "sbot: failed to open about idx")
 	}
-	// s.closers.addCloser(ab)
-	goThenLog(ctx, rootLog, "abouts", serveAbouts)
-	s.AboutStore = ab
+	s.AboutStore = ab.(indexes.AboutStore)
+
+	provIdx := &swapIndex{}
+	_, err = s.addIndex(indexes.FolderNameProvenance, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenProvenance(r)
+	}), provIdx)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open provenance index")
+	}
+	s.idxProvenance = provIdx
+
+	ts := &swapTimestamps{}
+	_, err = s.addIndex(indexes.FolderNameTimestamps, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenTimestamps(r)
+	}), ts)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open timestamp index")
+	}
+	s.Timestamps = ts
+
+	linkIdx := &swapLinks{}
+	_, err = s.addIndex(indexes.FolderNameLinks, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenLinks(r)
+	}), linkIdx)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open link index")
+	}
+	s.Links = linkIdx
+
+	searchIdx := &swapSearch{}
+	_, err = s.addIndex(indexes.FolderNameSearch, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenSearch(r)
+	}), searchIdx)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open search index")
+	}
+	s.SearchIndex = searchIdx
+
+	nameIdx := &swapNames{}
+	_, err = s.addIndex(indexes.FolderNameNames, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenNames(r)
+	}), nameIdx)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open names index")
+	}
+	s.NameIndex = nameIdx
+
+	voteIdx := &swapVotes{}
+	_, err = s.addIndex(indexes.FolderNameVotes, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenVotes(r)
+	}), voteIdx)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open vote index")
+	}
+	s.Votes = voteIdx
+
+	subIdx := &swapSubscriptions{}
+	_, err = s.addIndex(indexes.FolderNameSubscriptions, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenSubscriptions(r)
+	}), subIdx)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open subscription index")
+	}
+	s.Subscriptions = subIdx
+
+	notifyIdx := &swapNotifications{}
+	_, err = s.addIndex(indexes.FolderNameNotifications, openIndex(func(r repo.Interface) (interface{}, *badger.DB, repo.ServeFunc, error) {
+		return indexes.OpenNotifications(r, s.KeyPair)
+	}), notifyIdx)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open notification index")
+	}
+	s.Notifications = notifyIdx
+
+	s.Petnames, err = names.OpenPetnames(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open petnames")
+	}
+
+	notifyState, err := notifications.OpenReadState(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to open notification read state")
+	}
+
+	if err := repo.WriteManifest(r, *s.manifest); err != nil {
+		return nil, errors.Wrap(err, "sbot: failed to update index versions")
+	}
+
+	if s.diskQuota > 0 {
+		if repo.IsMemory(r) {
+			return nil, errors.Wrap(repo.ErrNeedsDisk, "sbot: disk quota")
+		}
+		s.idxDone.Add(1)
+		go func() {
+			defer s.idxDone.Done()
+			s.evictLoop(ctx)
+		}()
+	}
 
 	if s.disableNetwork {
 		return s, nil
@@ -239,85 +411,110 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		gossip.Promisc(s.promisc),
 		s.systemGauge, s.eventCounter,
 	}
+	var hmacKey *[32]byte
 	if s.signHMACsecret != nil {
 		var k [32]byte
 		copy(k[:], s.signHMACsecret)
+		hmacKey = &k
 		histOpts = append(histOpts, gossip.HMACSecret(&k))
 	}
 	pmgr.Register(gossip.New(
 		kitlog.With(log, "plugin", "gossip"),
-		id, rootLog, uf, s.GraphBuilder,
+		id, rootLog, s.UserFeeds, s.GraphBuilder,
 		histOpts...))
 
 	// incoming createHistoryStream handler
 	hist := gossip.NewHist(
 		kitlog.With(log, "plugin", "gossip/hist"),
-		id, rootLog, uf, s.GraphBuilder,
+		id, rootLog, s.UserFeeds, s.GraphBuilder,
 		histOpts...)
 	pmgr.Register(hist)
 
 	ctrl.Register(get.New(s))
+	ctrl.Register(get.NewByAuthorSeq(s))
+	ctrl.Register(get.NewMany(s))
 
 	// raw log plugins
 	ctrl.Register(rawread.NewTanglePlug(rootLog, s.Tangles))
-	ctrl.Register(rawread.NewRXLog(rootLog))      // createLogStream
-	ctrl.Register(rawread.NewByType(rootLog, mt)) // messagesByType
-	ctrl.Register(hist)                           // createHistoryStream
+	ctrl.Register(rawread.NewChannelPlug(rootLog, s.Channels, s.Subscriptions))
+	ctrl.Register(rawread.NewRXLog(rootLog))                    // createLogStream
+	ctrl.Register(rawread.NewByType(rootLog, s.MessageTypes))   // messagesByType
+	ctrl.Register(rawread.NewFeedStream(rootLog, s.Timestamps)) // createFeedStream
+	ctrl.Register(hist)                                         // createHistoryStream
+
+	ctrl.Register(queryplug.New(rootLog, s.UserFeeds, s.MessageTypes, s.Tangles)) // query.read
+	ctrl.Register(links.New(rootLog, s.Links))
+	ctrl.Register(links.NewBacklinks(rootLog, s.Links))
+	ctrl.Register(search.New(rootLog, s.SearchIndex, s.GraphBuilder, id, int(s.hopCount)))
+	ctrl.Register(threadsplug.New(s, rootLog, s.Tangles))
+	ctrl.Register(aboutplug.New(rootLog, s.MessageTypes, s.AboutStore))
+	ctrl.Register(namesplug.New(names.Lookup{
+		Petnames: s.Petnames,
+		Names:    s.NameIndex,
+		About:    s.AboutStore,
+		Graph:    s.GraphBuilder,
+		Self:     id,
+		Hops:     int(s.hopCount),
+	}))
+	ctrl.Register(votes.New(rootLog, s.MessageTypes, s.Votes, s.GraphBuilder, id, int(s.hopCount)))
+	ctrl.Register(notifications.New(rootLog, s.Notifications, notifyState))
 
 	ctrl.Register(replicate.NewPlug(s.UserFeeds))
 
-	// local clients (not using network package because we don't want conn limiting or advertising)
-	c, err := net.Dial("unix", r.GetPath("socket"))
-	if err == nil {
-		c.Close()
-		return nil, errors.Errorf("sbot: repo already in use, socket accepted connection")
-	}
-	os.Remove(r.GetPath("socket"))
+	// feed export and import
+	ctrl.Register(archiveplug.NewPlug(kitlog.With(log, "plugin", "archive"), id, rootLog, s.UserFeeds, s.GraphBuilder, hmacKey))
 
-	uxLis, err := net.Listen("unix", r.GetPath("socket"))
-	if err != nil {
-		return nil, err
-	}
-
-	go func() {
-		for {
-			conn, err := uxLis.Accept()
-			if err != nil {
-				err = errors.Wrap(err, "unix sock accept failed")
-				s.info.Log("warn", err)
-				continue
-			}
+	// local clients (not using network package because we don't want conn limiting or advertising)
+	// in-memory repos have no folder for the socket
+	if !repo.IsMemory(r) {
+		// left over from an unclean shutdown, we hold the lock of the repo
+		os.Remove(r.GetPath("socket"))
 
-			go func() {
-				pkr := muxrpc.NewPacker(conn)
-				ctx, cancel := context.WithCancel(ctx)
-				if cn, ok := pkr.(muxrpc.CloseNotifier); ok {
-					go func() {
-						<-cn.Closed()
-						cancel()
-					}()
-				}
+		uxLis, err := net.Listen("unix", r.GetPath("socket"))
+		if err != nil {
+			return nil, err
+		}
 
-				h, err := ctrl.MakeHandler(conn)
+		go func() {
+			for {
+				conn, err := uxLis.Accept()
 				if err != nil {
-					err = errors.Wrap(err, "unix sock make handler")
+					err = errors.Wrap(err, "unix sock accept failed")
 					s.info.Log("warn", err)
-					cancel()
-					return
+					continue
 				}
 
-				// spoof remote as us
-				sameAs := netwrap.WrapAddr(conn.RemoteAddr(), secretstream.Addr{PubKey: id.ID})
-				edp := muxrpc.HandleWithRemote(pkr, h, sameAs)
+				go func() {
+					pkr := muxrpc.NewPacker(conn)
+					ctx, cancel := context.WithCancel(ctx)
+					if cn, ok := pkr.(muxrpc.CloseNotifier); ok {
+						go func() {
+							<-cn.Closed()
+							cancel()
+						}()
+					}
+
+					h, err := ctrl.MakeHandler(conn)
+					if err != nil {
+						err = errors.Wrap(err, "unix sock make handler")
+						s.info.Log("warn", err)
+						cancel()
+						return
+					}
 
-				srv := edp.(muxrpc.Server)
-				if err := srv.Serve(ctx); err != nil {
-					s.info.Log("conn", "serve exited", "err", err, "peer", conn.RemoteAddr())
-				}
-				cancel()
-			}()
-		}
-	}()
+					// spoof remote as us
+					sameAs := netwrap.WrapAddr(conn.RemoteAddr(), secretstream.Addr{PubKey: id.ID})
+					edp := muxrpc.HandleWithRemote(pkr, h, sameAs)
+
+					srv := edp.(muxrpc.Server)
+					if err := srv.Serve(ctx); err != nil {
+						s.info.Log("conn", "serve exited", "err", err, "peer", conn.RemoteAddr())
+					}
+					cancel()
+				}()
+			}
+		}()
+	}
 
 	// tcp+shs
 	opts := network.Options{
@@ -345,7 +542,7 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	s.closers.addCloser(s.Network)
 
 	// TODO: should be gossip.connect but conflicts with our namespace assumption
-	ctrl.Register(control.NewPlug(kitlog.With(log, "plugin", "ctrl"), node))
+	ctrl.Register(control.NewPlug(kitlog.With(log, "plugin", "ctrl"), node, s, s))
 
 	return s, nil
 }
@@ -13,9 +13,10 @@ import (
 	"go.cryptoscope.co/librarian"
 	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
 
 	"go.cryptoscope.co/ssb"
-	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/message"
 	"go.cryptoscope.co/ssb/multilogs"
 	"go.cryptoscope.co/ssb/repo"
 )
@@ -24,6 +25,12 @@ import (
 func NullFeed(r repo.Interface, ref *ssb.FeedRef) error {
 	ctx := context.Background()
 
+	lck, err := repo.Lock(r)
+	if err != nil {
+		return errors.Wrap(err, "NullFeed")
+	}
+	defer lck.Close()
+
 	uf, _, _, err := multilogs.OpenUserFeeds(r)
 	if err != nil {
 		err = errors.Wrap(err, "NullFeed: failed to open multilog")
@@ -40,69 +47,82 @@ func NullFeed(r repo.Interface, ref *ssb.FeedRef) error {
 		defer c.Close()
 	}
 
+	n, _, err := nullFeed(ctx, rootLog, uf, ref)
+	if err != nil {
+		return errors.Wrap(err, "NullFeed")
+	}
+	log.Printf("\ndropped %d entries", n)
+	return nil
+}
+
+// nullFeed overwrites the entries of ref in rootLog that aren't nulled yet.
+// It returns how many entries were nulled and the size of the messages in them.
+func nullFeed(ctx context.Context, rootLog margaret.Log, uf multilog.MultiLog, ref *ssb.FeedRef) (int, int64, error) {
 	alterLog, ok := rootLog.(margaret.Alterer)
 	if !ok {
-		err = errors.Errorf("NullFeed: not an alterer: %T", rootLog)
-		return err
+		return 0, 0, errors.Errorf("not an alterer: %T", rootLog)
 	}
 
 	userSeqs, err := uf.Get(librarian.Addr(ref.ID))
 	if err != nil {
-		err = errors.Wrap(err, "NullFeed: failed to open log for feed argument")
-		return err
+		return 0, 0, errors.Wrap(err, "failed to open log for feed argument")
 	}
 
-	src, err := userSeqs.Query() //margaret.SeqWrap(true))
+	src, err := userSeqs.Query()
 	if err != nil {
-		err = errors.Wrap(err, "NullFeed: failed create user seqs query")
-		return err
+		return 0, 0, errors.Wrap(err, "failed create user seqs query")
 	}
 
-	i := 0
+	var (
+		i     = 0
+		size  int64
+		count int
+	)
 	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
 		defer func() { i++ }()
 		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
 			return err
 		}
 		seq, ok := v.(margaret.Seq)
 		if !ok {
-			return errors.Errorf("")
+			return errors.Errorf("unexpected sublog entry: %T", v)
+		}
+		msgv, err := rootLog.Get(seq)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get entry %d", seq.Seq())
 		}
+		switch tv := msgv.(type) {
+		case error:
+			if margaret.IsErrNulled(tv) {
+				return nil // already done
+			}
+			return tv
+		case message.StoredMessage:
+			size += int64(len(tv.Raw))
+		}
+		count++
 		return alterLog.Null(seq)
 	})
 	err = luigi.Pump(ctx, snk, src)
 	if err != nil {
-		err = errors.Wrapf(err, "failed to pump entries and null them %d", i)
-		return err
+		return count, size, errors.Wrapf(err, "failed to pump entries and null them %d", i)
 	}
-	log.Printf("\ndropped %d entries", i)
-	return nil
+	return count, size, nil
 }
 
-// Drop indicies deletes the following folders of the indexes.
-// TODO: check that sbot isn't running?
+// Drop indicies deletes the folders of all the indexes.
 func DropIndicies(r repo.Interface) error {
-
-	// drop indicies
-	var mlogs = []string{
-		multilogs.IndexNameFeeds,
-		multilogs.IndexNameTypes,
-		multilogs.IndexNamePrivates,
-	}
-	for _, i := range mlogs {
-		dbPath := r.GetPath(repo.PrefixMultiLog, i)
-		err := os.RemoveAll(dbPath)
-		if err != nil {
-			err = errors.Wrapf(err, "mkdir error for %q", dbPath)
-			return err
-		}
-	}
-	var badger = []string{
-		indexes.FolderNameAbout,
-		indexes.FolderNameContacts,
+	lck, err := repo.Lock(r)
+	if err != nil {
+		return errors.Wrap(err, "DropIndicies")
 	}
-	for _, i := range badger {
-		dbPath := r.GetPath(repo.PrefixIndex, i)
+	defer lck.Close()
+
+	for _, dir := range indexFolders {
+		dbPath := r.GetPath(dir...)
 		err := os.RemoveAll(dbPath)
 		if err != nil {
 			err = errors.Wrapf(err, "mkdir error for %q", dbPath)
@@ -3,12 +3,14 @@ package sbot
 import (
 	"context"
 	"encoding/base64"
+	"io"
 	"net"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	kitlog "github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics/prometheus"
@@ -22,7 +24,9 @@ import (
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/graph"
 	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/names"
 	"go.cryptoscope.co/ssb/network"
+	"go.cryptoscope.co/ssb/repo"
 )
 
 type MuxrpcEndpointWrapper func(muxrpc.Endpoint) muxrpc.Endpoint
@@ -38,6 +42,10 @@ type Sbot struct {
 	closers  multiCloser
 	idxDone  sync.WaitGroup
 
+	serveCtx  context.Context
+	indexLock sync.Mutex
+	indexes   map[string]*indexHandle
+
 	promisc  bool
 	hopCount uint
 
@@ -53,20 +61,41 @@ type Sbot struct {
 	enableDiscovery bool
 
 	repoPath         string
+	repo             repo.Interface
+	repoLock         io.Closer
+	manifest         *repo.Manifest
+	manifestLock     sync.Mutex
 	KeyPair          *ssb.KeyPair
 	RootLog          margaret.Log
 	liveIndexUpdates bool
 	UserFeeds        multilog.MultiLog
 	idxGet           librarian.Index
+	getFilter        *indexes.GetFilter
+	idxProvenance    librarian.Index
 	Tangles          multilog.MultiLog
+	Channels         multilog.MultiLog
 	AboutStore       indexes.AboutStore
+	Timestamps       indexes.TimestampIndex
+	Links            indexes.LinkIndex
+	SearchIndex      indexes.SearchIndex
+	NameIndex        indexes.NameIndex
+	Votes            indexes.VoteIndex
+	Subscriptions    indexes.SubscriptionIndex
+	Notifications    indexes.NotificationIndex
+	Petnames         *names.Petnames
 	MessageTypes     multilog.MultiLog
 	PrivateLogs      multilog.MultiLog
 	PublishLog       margaret.Log
+	publisher        *publisher
 	signHMACsecret   []byte
 
 	GraphBuilder graph.Builder
 
+	diskQuota     int64
+	evictInterval time.Duration
+	evictLock     sync.Mutex
+	pinned        []*ssb.FeedRef
+
 	BlobStore   ssb.BlobStore
 	WantManager ssb.WantManager
 
@@ -94,6 +123,15 @@ func WithRepoPath(path string) Option {
 	}
 }
 
+// WithRepo uses r instead of opening the repo at the repo path.
+// Pass repo.NewMemory() to run the bot without touching the disk.
+func WithRepo(r repo.Interface) Option {
+	return func(s *Sbot) error {
+		s.repo = r
+		return nil
+	}
+}
+
 func DisableNetworkNode() Option {
 	return func(s *Sbot) error {
 		s.disableNetwork = true
@@ -218,9 +256,35 @@ func WithPromisc(yes bool) Option {
 	}
 }
 
+// WithDiskQuota enables the eviction policy.
+// Every interval the size of the root log is compared to quota (in bytes).
+// Once it is exceeded, the feeds that are out of hops and not pinned are nulled. See Evict.
+func WithDiskQuota(quota int64, interval time.Duration) Option {
+	return func(s *Sbot) error {
+		if quota <= 0 {
+			return errors.Errorf("WithDiskQuota: quota needs to be positive (%d)", quota)
+		}
+		if interval <= 0 {
+			interval = DefaultEvictionInterval
+		}
+		s.diskQuota = quota
+		s.evictInterval = interval
+		return nil
+	}
+}
+
+// WithPinnedFeeds keeps the passed feeds from being evicted, even if they are out of hops
+func WithPinnedFeeds(refs ...*ssb.FeedRef) Option {
+	return func(s *Sbot) error {
+		s.pinned = append(s.pinned, refs...)
+		return nil
+	}
+}
+
 func New(fopts ...Option) (*Sbot, error) {
 	var s Sbot
 	s.liveIndexUpdates = true
+	s.indexes = make(map[string]*indexHandle)
 
 	for i, opt := range fopts {
 		err := opt(&s)
@@ -0,0 +1,91 @@
+package sbot
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+)
+
+// publisher is the publish log handed out by the bot.
+// The publish log finds the latest message of our feed through the user feeds index,
+// so publishing is blocked (by taking the lock) while that index isn't updated, otherwise our feed would fork.
+type publisher struct {
+	sync.RWMutex
+	cur margaret.Log
+
+	open func(multilog.MultiLog) (margaret.Log, error) // opens the publish log on the passed user feeds
+	err  error                                         // set if that failed after a switch over
+}
+
+var _ margaret.Log = (*publisher)(nil)
+
+// reopen opens the publish log on the user feeds they were switched over to, the caller needs to hold the lock
+func (p *publisher) reopen(uf multilog.MultiLog) {
+	if p.open == nil {
+		return // not set up yet
+	}
+	pl, err := p.open(uf)
+	if err != nil {
+		p.err = errors.Wrap(err, "sbot: failed to reopen publish log")
+		return
+	}
+	p.cur, p.err = pl, nil
+}
+
+func (p *publisher) Seq() luigi.Observable {
+	p.RLock()
+	defer p.RUnlock()
+	return p.cur.Seq()
+}
+
+func (p *publisher) Get(seq margaret.Seq) (interface{}, error) {
+	p.RLock()
+	defer p.RUnlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.cur.Get(seq)
+}
+
+func (p *publisher) Query(specs ...margaret.QuerySpec) (luigi.Source, error) {
+	p.RLock()
+	defer p.RUnlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.cur.Query(specs...)
+}
+
+func (p *publisher) Append(v interface{}) (margaret.Seq, error) {
+	p.RLock()
+	defer p.RUnlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.cur.Append(v)
+}
+
+// userFeedsSwapper switches the publisher over together with the user feeds,
+// the publish log holds on to the sublog of our feed.
+type userFeedsSwapper struct {
+	*swapMultiLog
+	pub *publisher
+}
+
+func (us userFeedsSwapper) Lock() {
+	us.swapMultiLog.Lock()
+	us.pub.Lock()
+}
+
+func (us userFeedsSwapper) Unlock() {
+	us.pub.Unlock()
+	us.swapMultiLog.Unlock()
+}
+
+func (us userFeedsSwapper) swap(v interface{}) {
+	us.swapMultiLog.swap(v)
+	us.pub.reopen(v.(multilog.MultiLog))
+}
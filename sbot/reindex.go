@@ -0,0 +1,166 @@
+package sbot
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/luigi/mfr"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/ctxutils"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// Reindex rebuilds the index with the passed name from the root log into a fresh folder next to the current one.
+// Once it caught up, the current index is stopped, replaced by the new one and serving resumes.
+// Users of the index are blocked for the duration of the switch over.
+// progress is called periodically with the sequence of the root log that was processed.
+func (s *Sbot) Reindex(name string, progress func(done, total int64)) error {
+	if repo.IsMemory(s.repo) {
+		return errors.Wrap(repo.ErrNeedsDisk, "sbot/reindex")
+	}
+
+	s.indexLock.Lock()
+	h, has := s.indexes[name]
+	if !has {
+		s.indexLock.Unlock()
+		return errors.Errorf("sbot/reindex: no such index: %q", name)
+	}
+	if h.wrapper == nil {
+		s.indexLock.Unlock()
+		return errors.Errorf("sbot/reindex: %q can't be switched over at runtime, stop the bot and use -reindex", name)
+	}
+	if h.busy {
+		s.indexLock.Unlock()
+		return errors.Errorf("sbot/reindex: %q is already being rebuilt or backed up", name)
+	}
+	h.busy = true
+	s.indexLock.Unlock()
+
+	defer func() {
+		s.indexLock.Lock()
+		h.busy = false
+		s.indexLock.Unlock()
+	}()
+
+	staging := stagingRepo{Interface: s.repo, dir: h.dir}
+	if err := os.RemoveAll(staging.stagingPath()); err != nil {
+		return errors.Wrap(err, "sbot/reindex: failed to clear staging folder")
+	}
+
+	fresh, err := h.open(staging)
+	if err != nil {
+		return errors.Wrapf(err, "sbot/reindex: failed to open fresh %s index", name)
+	}
+
+	currSeq, err := s.RootLog.Seq().Value()
+	if err != nil {
+		return errors.Wrap(err, "sbot/reindex: failed to get current root log sequence")
+	}
+	total := currSeq.(margaret.Seq).Seq() + 1
+
+	if progress == nil {
+		progress = func(int64, int64) {}
+	}
+	report := func(done int64) {
+		s.info.Log("event", "reindex", "idx", name, "done", done, "total", total)
+		progress(done, total)
+	}
+
+	// catch up in the background without blocking the current index
+	ctx, cancel := ctxutils.WithError(s.serveCtx, ssb.ErrShuttingDown)
+	defer cancel()
+	err = fresh.serve(ctx, progressLog{Log: s.RootLog, report: report}, false)
+	if fresh.closer != nil {
+		if cerr := fresh.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "sbot/reindex: rebuilding %s failed", name)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// switch over
+	h.wrapper.Lock()
+	defer h.wrapper.Unlock()
+
+	if err := h.stop(); err != nil {
+		return errors.Wrapf(err, "sbot/reindex: failed to close current %s index", name)
+	}
+
+	activePath := s.repo.GetPath(h.dir...)
+	if err := os.RemoveAll(activePath); err != nil {
+		return errors.Wrapf(err, "sbot/reindex: failed to remove current %s index", name)
+	}
+	if err := os.Rename(staging.stagingPath(), activePath); err != nil {
+		return errors.Wrapf(err, "sbot/reindex: failed to move rebuilt %s index into place", name)
+	}
+
+	rebuilt, err := h.open(s.repo)
+	if err != nil {
+		return errors.Wrapf(err, "sbot/reindex: failed to open rebuilt %s index", name)
+	}
+	h.wrapper.swap(rebuilt.value)
+	h.use(rebuilt)
+	s.serveIndex(h)
+
+	report(total)
+	return nil
+}
+
+// stagingRepo resolves the paths of one index into a folder next to it
+type stagingRepo struct {
+	repo.Interface
+	dir []string
+}
+
+func (sr stagingRepo) stagingPath() string {
+	return sr.Interface.GetPath(sr.stagingDir()...)
+}
+
+func (sr stagingRepo) stagingDir() []string {
+	n := len(sr.dir)
+	dir := append([]string{}, sr.dir[:n-1]...)
+	return append(dir, sr.dir[n-1]+".reindex")
+}
+
+func (sr stagingRepo) GetPath(rel ...string) string {
+	if len(rel) < len(sr.dir) {
+		return sr.Interface.GetPath(rel...)
+	}
+	for i, d := range sr.dir {
+		if rel[i] != d {
+			return sr.Interface.GetPath(rel...)
+		}
+	}
+	return sr.Interface.GetPath(append(sr.stagingDir(), rel[len(sr.dir):]...)...)
+}
+
+// progressLog reports the sequence of every thousandth entry that passes through queries on it
+type progressLog struct {
+	margaret.Log
+	report func(int64)
+}
+
+func (pl progressLog) Query(specs ...margaret.QuerySpec) (luigi.Source, error) {
+	src, err := pl.Log.Query(specs...)
+	if err != nil {
+		return nil, err
+	}
+	var cnt int64
+	return mfr.SourceMap(src, func(ctx context.Context, v interface{}) (interface{}, error) {
+		if sw, ok := v.(margaret.SeqWrapper); ok {
+			if atomic.AddInt64(&cnt, 1)%1000 == 0 {
+				pl.report(sw.Seq().Seq())
+			}
+		}
+		return v, nil
+	}), nil
+}
@@ -0,0 +1,84 @@
+package sbot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cryptix/go/logging/logtest"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/indexes"
+)
+
+func TestReindexOnline(t *testing.T) {
+	r := require.New(t)
+
+	os.RemoveAll("testrun")
+
+	mainLog, _ := logtest.KitLogger(t.Name(), t)
+	bot, err := New(
+		WithInfo(mainLog),
+		WithRepoPath(filepath.Join("testrun", t.Name())),
+		DisableNetworkNode())
+	r.NoError(err)
+
+	const n = 25
+	for i := 0; i < n; i++ {
+		_, err := bot.PublishLog.Append(map[string]interface{}{
+			"type": "test",
+			"i":    i,
+		})
+		r.NoError(err)
+	}
+
+	var lastDone, lastTotal int64
+	err = bot.Reindex("msgTypes", func(done, total int64) {
+		lastDone, lastTotal = done, total
+	})
+	r.NoError(err)
+	r.Equal(int64(n), lastTotal)
+	r.Equal(lastTotal, lastDone)
+
+	// the publish log is switched over with them
+	err = bot.Reindex("userFeeds", nil)
+	r.NoError(err)
+
+	for _, name := range []string{
+		indexes.FolderNameTimestamps,
+		indexes.FolderNameLinks,
+		indexes.FolderNameSearch,
+		indexes.FolderNameNames,
+		indexes.FolderNameVotes,
+		indexes.FolderNameSubscriptions,
+		indexes.FolderNameNotifications,
+	} {
+		r.NoError(bot.Reindex(name, nil), "reindex %s", name)
+	}
+	err = bot.Reindex("nope", nil)
+	r.Error(err)
+
+	testLog, err := bot.MessageTypes.Get(librarian.Addr("test"))
+	r.NoError(err)
+	seqv, err := testLog.Seq().Value()
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(n-1), seqv)
+
+	// still live after the switch over
+	seq, err := bot.PublishLog.Append(map[string]interface{}{
+		"type": "test",
+		"i":    n,
+	})
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(n), seq)
+	time.Sleep(250 * time.Millisecond)
+	seqv, err = testLog.Seq().Value()
+	r.NoError(err)
+	r.Equal(margaret.BaseSeq(n), seqv)
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
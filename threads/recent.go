@@ -0,0 +1,112 @@
+package threads
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+)
+
+// Summary describes the activity in a thread
+type Summary struct {
+	Root         *ssb.MessageRef `json:"root"`
+	Replies      int             `json:"replies"`
+	Participants []*ssb.FeedRef  `json:"participants"` // in the order they joined, the author of the root first
+	Latest       *ssb.MessageRef `json:"latest"`       // the reply we received last
+	Timestamp    int64           `json:"timestamp"`    // when we received it, in milliseconds
+}
+
+// Recent returns the summaries of the limit threads with the latest replies, newest first.
+// A negative limit returns all of them.
+func Recent(g Getter, rootLog margaret.Log, tangles multilog.MultiLog, limit int) ([]Summary, error) {
+	addrs, err := tangles.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "threads: failed to list tangles")
+	}
+
+	// the root log sequence of the last reply tells which threads are active
+	type active struct {
+		root *ssb.MessageRef
+		last int64
+	}
+	var threads []active
+	for _, addr := range addrs {
+		name, root, err := multilogs.SplitTangleAddr(addr)
+		if err != nil || name != "" {
+			continue // not a thread
+		}
+		sublog, err := tangles.Get(addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "threads: failed to open tangle")
+		}
+		sv, err := sublog.Seq().Value()
+		if err != nil {
+			return nil, errors.Wrap(err, "threads: failed to get tangle length")
+		}
+		seq, ok := sv.(margaret.Seq)
+		if !ok || seq.Seq() < 0 {
+			continue // empty
+		}
+		rv, err := sublog.Get(seq)
+		if err != nil {
+			return nil, errors.Wrap(err, "threads: failed to get latest reply")
+		}
+		rootSeq, ok := rv.(margaret.Seq)
+		if !ok {
+			return nil, errors.Errorf("threads: wrong sequence type in tangle: %T", rv)
+		}
+		threads = append(threads, active{root, rootSeq.Seq()})
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i].last > threads[j].last })
+	if limit >= 0 && len(threads) > limit {
+		threads = threads[:limit]
+	}
+
+	sums := make([]Summary, 0, len(threads))
+	for _, t := range threads {
+		replies, err := readTangle(rootLog, tangles, t.root)
+		if err != nil {
+			return nil, err
+		}
+		if len(replies) == 0 {
+			continue // all of them were deleted
+		}
+		sums = append(sums, Summarize(g, t.root, replies))
+	}
+	return sums, nil
+}
+
+// Summarize counts the replies (in receive order) of root and who wrote them
+func Summarize(g Getter, root *ssb.MessageRef, replies []message.StoredMessage) Summary {
+	s := Summary{
+		Root:    root,
+		Replies: len(replies),
+	}
+
+	seen := make(map[string]bool)
+	join := func(author *ssb.FeedRef) {
+		if author == nil || seen[author.Ref()] {
+			return
+		}
+		seen[author.Ref()] = true
+		s.Participants = append(s.Participants, author)
+	}
+	if rootMsg, err := g.Get(*root); err == nil {
+		join(rootMsg.Author)
+	}
+	for _, msg := range replies {
+		join(msg.Author)
+	}
+
+	if len(replies) > 0 {
+		last := replies[len(replies)-1]
+		s.Latest = last.Key
+		s.Timestamp = last.Timestamp.UnixNano() / 1000000
+	}
+	return s
+}
@@ -0,0 +1,205 @@
+// Package threads assembles discussion threads from the replies that the tangles multilog collects for a root message.
+//
+// Replies name the message that started the thread in content.root and the latest messages they have seen in content.branch,
+// which can be a single ref or a list of them. That is enough to order a thread causally, independent of when we received the messages.
+package threads
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/indexes"
+	"go.cryptoscope.co/ssb/internal/mutil"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/multilogs"
+)
+
+// Getter finds messages by their key
+type Getter interface {
+	Get(ssb.MessageRef) (*message.StoredMessage, error)
+}
+
+// Thread is a root message and the replies to it
+type Thread struct {
+	Root    *message.StoredMessage  // nil if we don't have it
+	Replies []message.StoredMessage // in causal order
+	Missing []*ssb.MessageRef       // ancestors that replies refer to but we don't have, the root included
+}
+
+// Get loads the thread of root from the tangles multilog
+func Get(g Getter, rootLog margaret.Log, tangles multilog.MultiLog, root *ssb.MessageRef) (*Thread, error) {
+	var t Thread
+
+	rootMsg, err := g.Get(*root)
+	if err != nil {
+		if errors.Cause(err) != ssb.ErrNotFound {
+			return nil, errors.Wrap(err, "threads: failed to get root message")
+		}
+	} else {
+		t.Root = rootMsg
+	}
+
+	replies, err := readTangle(rootLog, tangles, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown []*ssb.MessageRef
+	t.Replies, unknown = Sort(root, replies)
+
+	if t.Root == nil {
+		t.Missing = append(t.Missing, root)
+	}
+	for _, ref := range unknown {
+		if ref.Ref() == root.Ref() {
+			continue // reported above
+		}
+		_, err := g.Get(*ref)
+		if err == nil {
+			continue // not part of this thread but we have it
+		} else if errors.Cause(err) != ssb.ErrNotFound {
+			return nil, errors.Wrapf(err, "threads: failed to look up %s", ref.Ref())
+		}
+		t.Missing = append(t.Missing, ref)
+	}
+	return &t, nil
+}
+
+// readTangle returns the messages that name root as their root, in receive order
+func readTangle(rootLog margaret.Log, tangles multilog.MultiLog, root *ssb.MessageRef) ([]message.StoredMessage, error) {
+	sublog, err := tangles.Get(multilogs.TangleAddr("", root))
+	if err != nil {
+		return nil, errors.Wrap(err, "threads: failed to open tangle")
+	}
+	src, err := mutil.Indirect(rootLog, sublog).Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "threads: failed to query tangle")
+	}
+
+	var msgs []message.StoredMessage
+	for {
+		v, err := src.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "threads: failed to read tangle")
+		}
+		msg, ok := v.(message.StoredMessage)
+		if !ok {
+			if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, errors.Errorf("threads: wrong message type. expected %T - got %T", msg, v)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// Branches returns the refs in content.branch of a message
+func Branches(raw []byte) []*ssb.MessageRef {
+	var value struct {
+		Content struct {
+			Branch json.RawMessage `json:"branch"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &value); err != nil || len(value.Content.Branch) == 0 {
+		return nil
+	}
+
+	var strs []string
+	var one string
+	if err := json.Unmarshal(value.Content.Branch, &one); err == nil {
+		strs = []string{one}
+	} else if err := json.Unmarshal(value.Content.Branch, &strs); err != nil {
+		return nil
+	}
+
+	var refs []*ssb.MessageRef
+	for _, s := range strs {
+		ref, err := ssb.ParseMessageRef(s)
+		if err != nil {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// Sort orders the replies of root so that every message comes after the ones in it's branch.
+// Messages that don't depend on each other are ordered by their claimed timestamp and then by the order we received them in.
+// unknown lists the refs in branches that are neither root nor one of the replies.
+func Sort(root *ssb.MessageRef, replies []message.StoredMessage) (sorted []message.StoredMessage, unknown []*ssb.MessageRef) {
+	byKey := make(map[string]int, len(replies))
+	for i, msg := range replies {
+		byKey[msg.Key.Ref()] = i
+	}
+
+	// the number of parents in the thread of every message and who waits for them
+	waiting := make([]int, len(replies))
+	children := make(map[int][]int)
+	seen := make(map[string]bool)
+	for i, msg := range replies {
+		for _, b := range Branches(msg.Raw) {
+			if p, has := byKey[b.Ref()]; has {
+				if p != i {
+					waiting[i]++
+					children[p] = append(children[p], i)
+				}
+				continue
+			}
+			if b.Ref() == root.Ref() || seen[b.Ref()] {
+				continue
+			}
+			seen[b.Ref()] = true
+			unknown = append(unknown, b)
+		}
+	}
+
+	timestamps := make([]int64, len(replies))
+	for i, msg := range replies {
+		timestamps[i], _ = indexes.FeedTimestamp(msg)
+	}
+	before := func(a, b int) bool {
+		if timestamps[a] != timestamps[b] {
+			return timestamps[a] < timestamps[b]
+		}
+		return a < b
+	}
+
+	var ready []int
+	for i := range replies {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	done := make([]bool, len(replies))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(x, y int) bool { return before(ready[x], ready[y]) })
+		next := ready[0]
+		ready = ready[1:]
+		done[next] = true
+		sorted = append(sorted, replies[next])
+		for _, c := range children[next] {
+			waiting[c]--
+			if waiting[c] == 0 {
+				ready = append(ready, c)
+			}
+		}
+	}
+
+	// cycles can't be created with real hashes, keep whatever is left in receive order
+	for i, msg := range replies {
+		if !done[i] {
+			sorted = append(sorted, msg)
+		}
+	}
+	return sorted, unknown
+}
@@ -0,0 +1,57 @@
+package threads
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+func testRef(name string) *ssb.MessageRef {
+	return &ssb.MessageRef{Algo: ssb.RefAlgoSHA256, Hash: []byte(fmt.Sprintf("%32s", name))}
+}
+
+func testReply(name string, ts int, root string, branch ...string) message.StoredMessage {
+	refs := make([]string, len(branch))
+	for i, b := range branch {
+		refs[i] = fmt.Sprintf("%q", testRef(b).Ref())
+	}
+	return message.StoredMessage{
+		Key:       testRef(name),
+		Timestamp: time.Unix(10000, 0),
+		Raw: []byte(fmt.Sprintf(`{"timestamp":%d,"content":{"type":"post","root":%q,"branch":[%s]}}`,
+			ts, testRef(root).Ref(), strings.Join(refs, ","))),
+	}
+}
+
+func TestSort(t *testing.T) {
+	r := require.New(t)
+
+	root := testRef("root")
+	replies := []message.StoredMessage{
+		// received out of order and with wrong timestamps
+		testReply("c", 1, "root", "b"),
+		testReply("b", 5, "root", "a"),
+		testReply("a", 9, "root", "root"),
+		testReply("x", 2, "root", "root"),
+		testReply("d", 3, "root", "c", "gone"),
+		testReply("e", 3, "root", "c"),
+	}
+
+	sorted, unknown := Sort(root, replies)
+	var names []string
+	for _, msg := range sorted {
+		names = append(names, strings.TrimSpace(string(msg.Key.Hash)))
+	}
+	r.Equal([]string{"x", "a", "b", "c", "d", "e"}, names)
+	r.Equal([]*ssb.MessageRef{testRef("gone")}, unknown)
+
+	r.Equal([]*ssb.MessageRef{testRef("a")}, Branches(testReply("b", 0, "root", "a").Raw))
+	r.Equal([]*ssb.MessageRef{testRef("a")}, Branches([]byte(fmt.Sprintf(`{"content":{"branch":%q}}`, testRef("a").Ref()))))
+	r.Nil(Branches([]byte(`{"content":"box"}`)))
+}